@@ -0,0 +1,10 @@
+// Package api holds the contracts of the service, the OpenAPI document of the http api
+// and the protobuf definitions of the grpc api in user/v1
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3.1 document of every http route
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_lower_name_idx;
+DROP INDEX IF EXISTS users_name_id_idx;
+DROP INDEX IF EXISTS users_inserted_at_id_idx;
\ No newline at end of file
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS users_inserted_at_id_idx ON users (inserted_at, id);
+CREATE INDEX IF NOT EXISTS users_name_id_idx ON users (name, id);
+CREATE INDEX IF NOT EXISTS users_lower_name_idx ON users (lower(name) text_pattern_ops);
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	prefix VARCHAR(16) NOT NULL,
+	key_hash CHAR(64) NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL DEFAULT '{}',
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	expires_at timestamptz NULL,
+	last_used_at timestamptz NULL,
+	revoked_at timestamptz NULL
+);
\ No newline at end of file
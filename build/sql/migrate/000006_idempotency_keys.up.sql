@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	owner VARCHAR(64) NOT NULL,
+	key VARCHAR(255) NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	status_code INTEGER NULL,
+	response_headers JSONB NULL,
+	response_body BYTEA NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	expires_at timestamptz NOT NULL,
+	PRIMARY KEY (owner, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_search_trgm_idx;
+DROP INDEX IF EXISTS users_search_tsv_idx;
+DROP FUNCTION IF EXISTS users_search_document(text, text);
+DROP FUNCTION IF EXISTS users_search_normalize(text);
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- lowercases and folds letters so names typed without ё or Kazakh letters still match,
+-- the folding table of pkg/search must stay the same
+CREATE OR REPLACE FUNCTION users_search_normalize(value text) RETURNS text
+	LANGUAGE sql IMMUTABLE PARALLEL SAFE
+	AS $$ SELECT translate(lower(value), 'ёәғқңөұүһі', 'еагкноуухи') $$;
+
+CREATE OR REPLACE FUNCTION users_search_document(name text, surname text) RETURNS text
+	LANGUAGE sql IMMUTABLE PARALLEL SAFE
+	AS $$ SELECT users_search_normalize(name || ' ' || coalesce(surname, '')) $$;
+
+CREATE INDEX IF NOT EXISTS users_search_tsv_idx ON users
+	USING gin (to_tsvector('simple', users_search_document(name, surname)))
+	WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS users_search_trgm_idx ON users
+	USING gin (users_search_document(name, surname) gin_trgm_ops)
+	WHERE deleted_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS user_audit (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	operation VARCHAR(16) NOT NULL,
+	actor VARCHAR(64) NOT NULL,
+	request_id VARCHAR(128) NULL,
+	changes JSONB NOT NULL DEFAULT '{}',
+	created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+-- no foreign key to users, the history of purged users is kept
+CREATE INDEX IF NOT EXISTS user_audit_user_id_idx ON user_audit (user_id, id);
+CREATE INDEX IF NOT EXISTS user_audit_actor_idx ON user_audit (actor, id);
+CREATE INDEX IF NOT EXISTS user_audit_created_at_idx ON user_audit (created_at);
\ No newline at end of file
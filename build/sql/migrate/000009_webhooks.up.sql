@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event_type VARCHAR(32) NOT NULL,
+	payload JSONB NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	dispatched_at timestamptz NULL
+);
+
+-- the dispatcher polls events not yet queued for webhooks
+CREATE INDEX IF NOT EXISTS outbox_undispatched_idx ON outbox (id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+	id SERIAL PRIMARY KEY,
+	url VARCHAR(2048) NOT NULL,
+	secret VARCHAR(128) NOT NULL,
+	event_types TEXT[] NOT NULL DEFAULT '{}',
+	created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event_id BIGINT NOT NULL REFERENCES outbox (id),
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at timestamptz NOT NULL DEFAULT NOW(),
+	last_status_code INTEGER NULL,
+	last_error TEXT NULL,
+	delivered_at timestamptz NULL,
+	created_at timestamptz NOT NULL DEFAULT NOW(),
+	UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, id);
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- every committed outbox event is announced to all instances listening on user_events,
+-- the payload is the event as the api renders it, well below the 8000 bytes limit of NOTIFY
+CREATE OR REPLACE FUNCTION outbox_notify() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('user_events', json_build_object(
+		'id', NEW.id,
+		'type', NEW.event_type,
+		'data', NEW.payload,
+		'created_at', NEW.created_at
+	)::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS outbox_notify ON outbox;
+CREATE TRIGGER outbox_notify AFTER INSERT ON outbox FOR EACH ROW EXECUTE FUNCTION outbox_notify();
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- buckets are cheap to lose, unlogged skips the wal for the write on every request
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+	key TEXT PRIMARY KEY,
+	tat timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_tat_idx ON rate_limits (tat);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- a request in progress holds its key until locked_until only, separate from the replay ttl,
+-- rows written before are taken over right away
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until timestamptz NOT NULL DEFAULT NOW();
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_created_at_idx;
+DROP INDEX IF EXISTS webhook_deliveries_event_id_idx;
+DROP INDEX IF EXISTS webhook_deliveries_finished_idx;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- retention cleanup finds finished deliveries by their last attempt and old events by age,
+-- the event_id index also serves the check that no delivery refers to an event any more
+CREATE INDEX IF NOT EXISTS webhook_deliveries_finished_idx ON webhook_deliveries (next_attempt_at) WHERE status <> 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_event_id_idx ON webhook_deliveries (event_id);
+CREATE INDEX IF NOT EXISTS outbox_created_at_idx ON outbox (created_at);
\ No newline at end of file
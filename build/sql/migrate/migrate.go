@@ -0,0 +1,9 @@
+package migrate
+
+import "embed"
+
+// Files holds the migrations compiled into the binary,
+// named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var Files embed.FS
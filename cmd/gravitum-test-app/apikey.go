@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/repository/postgres"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const apiKeyUsage = `usage: gravitum-test-app apikey <command>
+
+commands:
+  create -name NAME [-scopes users:read,users:write,admin,*] [-expires 720h]
+  list
+  revoke ID
+`
+
+// go run ./cmd/gravitum-test-app apikey create -name backoffice -scopes users:read
+func runApiKey(ctx context.Context, cfg *config.Config, log *logger.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, apiKeyUsage)
+		return exitUsage
+	}
+
+	a, err := connect(ctx, cfg, log)
+	if err != nil {
+		return exitUnavailable
+	}
+	defer a.Db.Close()
+
+	services := service.NewService(cfg, postgres.NewRepository(cfg, a.Db))
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := flags.String("name", "", "key owner, e.g. service name")
+		scopes := flags.String("scopes", "users:read", "comma separated scopes")
+		expires := flags.Duration("expires", 0, "lifetime of the key, never expires if 0")
+		if flags.Parse(args[1:]) != nil {
+			return exitUsage
+		}
+
+		if strings.TrimSpace(*name) == "" {
+			fmt.Fprintln(os.Stderr, "-name is required")
+			return exitUsage
+		}
+
+		var expiresAt *time.Time
+		if *expires > 0 {
+			t := time.Now().Add(*expires)
+			expiresAt = &t
+		}
+
+		key, secret, err := services.ApiKey.Create(ctx, strings.TrimSpace(*name), splitScopes(*scopes), expiresAt)
+		if err != nil {
+			log.Errorf("apikey create: %s", err)
+			return exitError
+		}
+
+		fmt.Printf("id: %d\nname: %s\nscopes: %s\n", key.Id, key.Name, strings.Join(key.Scopes, ","))
+		fmt.Printf("secret: %s\n\nstore the secret now, it can't be shown again\n", secret)
+	case "list":
+		keys, err := services.ApiKey.GetList(ctx)
+		if err != nil {
+			log.Errorf("apikey list: %s", err)
+			return exitError
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tCREATED AT\tEXPIRES AT\tLAST USED AT\tSTATUS")
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != nil {
+				status = "revoked"
+			} else if !key.IsActive(time.Now()) {
+				status = "expired"
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				key.Id,
+				key.Name,
+				key.Prefix,
+				strings.Join(key.Scopes, ","),
+				key.CreatedAt.Format("2006-01-02 15:04:05"),
+				formatTime(key.ExpiresAt),
+				formatTime(key.LastUsedAt),
+				status,
+			)
+		}
+		w.Flush()
+	case "revoke":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, apiKeyUsage)
+			return exitUsage
+		}
+
+		id, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid id: %s\n", args[1])
+			return exitUsage
+		}
+
+		err = services.ApiKey.Revoke(ctx, uint(id))
+		if err != nil {
+			log.Errorf("apikey revoke: %s", err)
+			return exitError
+		}
+
+		fmt.Printf("api key %d revoked\n", id)
+	default:
+		fmt.Fprint(os.Stderr, apiKeyUsage)
+		return exitUsage
+	}
+
+	return exitOk
+}
+
+func splitScopes(value string) []string {
+	result := []string{}
+	for _, scope := range strings.Split(value, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/app"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository/memory"
+	"gravitum-test-app/internal/repository/postgres"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exit codes of the subcommands, scripts can tell a missing user from a broken db
+const (
+	exitOk          = 0
+	exitError       = 1 // unexpected failure
+	exitUsage       = 2 // unknown command or invalid flags
+	exitConfig      = 3 // config can't be loaded or is invalid
+	exitUnavailable = 4 // db is unreachable
+	exitNotFound    = 5 // no entity with such id
+	exitInvalid     = 6 // input rejected, e.g. a blank name or rejected import rows
+	exitConflict    = 7 // version mismatch or the entity is in another state
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+	outputYaml  = "yaml"
+)
+
+// connect opens the db pool for subcommands, the caller closes a.Db
+func connect(ctx context.Context, cfg *config.Config, log *logger.Logger) (*app.App, error) {
+	a := app.New(cfg, log)
+	err := a.ConnectDB(ctx, cfg.GetDbConfig().GetDsn())
+	if err != nil {
+		log.Errorf("couldn't instantiate db: %s", err)
+		return nil, err
+	}
+	return a, nil
+}
+
+// openServices builds the service layer on the configured driver, the memory one starts empty
+// and is lost on exit. close releases the db pool
+func openServices(ctx context.Context, cfg *config.Config, log *logger.Logger) (*service.Service, func(), error) {
+	if cfg.Db.Driver == config.DriverMemory {
+		return service.NewService(cfg, memory.NewRepository(cfg)), func() {}, nil
+	}
+
+	a, err := connect(ctx, cfg, log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return service.NewService(cfg, postgres.NewRepository(cfg, a.Db)), a.Db.Close, nil
+}
+
+// exitCode maps a service error through the error catalog, like the api picks the http status
+func exitCode(err error) int {
+	switch model.LookupError(err).Status {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return exitInvalid
+	case http.StatusNotFound, http.StatusUnprocessableEntity:
+		return exitNotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return exitConflict
+	case http.StatusServiceUnavailable:
+		return exitUnavailable
+	}
+
+	return exitError
+}
+
+// outputFlag registers -output on flags, the value is checked by parseFlags
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("output", outputTable, "output format: table, json or yaml")
+}
+
+// parseFlags parses args and checks -output when registered, flags may follow positional arguments:
+//
+//	users get 5 -output json
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, bool) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, false
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if output := flags.Lookup("output"); output != nil {
+		switch output.Value.String() {
+		case outputTable, outputJson, outputYaml:
+		default:
+			fmt.Fprintf(flags.Output(), "invalid -output %q, must be table, json or yaml\n", output.Value.String())
+			return nil, false
+		}
+	}
+
+	return positional, true
+}
+
+func parseId(value string) (uint, error) {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid id: %s", value)
+	}
+	return uint(id), nil
+}
+
+// encode writes v as json or yaml, yaml keys keep the json names and order
+func encode(w io.Writer, output string, v interface{}) error {
+	if output == outputJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// json is yaml, the node keeps the key order, only the flow style is reset
+	var node yaml.Node
+	if err = yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	resetStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
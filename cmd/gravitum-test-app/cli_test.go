@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository/memory"
+	"gravitum-test-app/internal/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cliOutput struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+func newUsersCli() func(stdin string, args ...string) cliOutput {
+	cfg := &config.Config{}
+	cfg.Db.Driver = config.DriverMemory
+	cfg.Db.Limit = 20
+	cfg.Db.InsertBatchSize = 100
+
+	services := service.NewService(cfg, memory.NewRepository(cfg))
+
+	return func(stdin string, args ...string) cliOutput {
+		var stdout, stderr bytes.Buffer
+		cli := &usersCli{
+			services: services,
+			stdin:    strings.NewReader(stdin),
+			stdout:   &stdout,
+			stderr:   &stderr,
+		}
+
+		code := cli.run(context.Background(), args)
+		return cliOutput{code: code, stdout: stdout.String(), stderr: stderr.String()}
+	}
+}
+
+func TestUsersCli(t *testing.T) {
+	run := newUsersCli()
+
+	result := run("", "create", "-name", "Ada", "-surname", "Lovelace", "-output", "json")
+	require.Equal(t, exitOk, result.code, result.stderr)
+
+	var created model.User
+	require.NoError(t, json.Unmarshal([]byte(result.stdout), &created))
+	assert.Equal(t, "Ada", created.Name)
+	assert.Equal(t, "Lovelace", *created.Surname)
+
+	// flags may follow the id
+	result = run("", "get", "1", "-output", "yaml")
+	require.Equal(t, exitOk, result.code, result.stderr)
+	assert.Contains(t, result.stdout, "name: Ada\n")
+	assert.Contains(t, result.stdout, "surname: Lovelace\n")
+
+	result = run("", "update", "1", "-name", "Grace", "-version", "1")
+	require.Equal(t, exitOk, result.code, result.stderr)
+	assert.Regexp(t, `(?m)^ID\s+NAME\s+SURNAME`, result.stdout)
+	assert.Regexp(t, `(?m)^1\s+Grace\s+-\s+`, result.stdout, "absent surname clears it")
+
+	result = run("", "update", "1", "-name", "Ada", "-version", "1")
+	assert.Equal(t, exitConflict, result.code)
+	assert.Contains(t, result.stderr, "err.user.version_mismatch")
+
+	result = run("", "create", "-name", " ")
+	assert.Equal(t, exitInvalid, result.code)
+
+	result = run("", "delete", "1")
+	require.Equal(t, exitOk, result.code, result.stderr)
+
+	result = run("", "get", "1")
+	assert.Equal(t, exitNotFound, result.code)
+
+	result = run("", "get", "1", "-include-deleted", "-output", "json")
+	assert.Equal(t, exitOk, result.code)
+
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"get"},
+		{"get", "abc"},
+		{"get", "1", "-output", "xml"},
+		{"list", "-sort", "age"},
+		{"create", "-bogus"},
+	} {
+		assert.Equal(t, exitUsage, run("", args...).code, args)
+	}
+}
+
+func TestUsersCliList(t *testing.T) {
+	run := newUsersCli()
+
+	result := run("name,surname\nCarol,\nAlice,A\nBob,\n,Nobody\n", "import", "-output", "json")
+	assert.Equal(t, exitInvalid, result.code, "rejected rows")
+
+	var report model.ImportReport
+	require.NoError(t, json.Unmarshal([]byte(result.stdout), &report))
+	assert.Equal(t, 3, report.Accepted)
+	assert.Equal(t, 1, report.Rejected)
+
+	result = run("", "list", "-sort", "name", "-limit", "2", "-output", "json")
+	require.Equal(t, exitOk, result.code, result.stderr)
+
+	var page struct {
+		Data []*model.User `json:"data"`
+		Page *model.Page   `json:"page"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(result.stdout), &page))
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, "Alice", page.Data[0].Name)
+	assert.EqualValues(t, 3, page.Page.Total)
+	require.NotNil(t, page.Page.NextCursor)
+
+	// the cursor carries the sort
+	result = run("", "list", "-cursor", *page.Page.NextCursor)
+	require.Equal(t, exitOk, result.code, result.stderr)
+	assert.Regexp(t, `(?m)^\d+\s+Carol\s+`, result.stdout)
+	assert.NotContains(t, result.stdout, "Alice")
+
+	result = run("", "list", "-all", "-has-surname", "false", "-order", "desc", "-output", "json")
+	require.Equal(t, exitOk, result.code, result.stderr)
+
+	var users []*model.User
+	require.NoError(t, json.Unmarshal([]byte(result.stdout), &users))
+	require.Len(t, users, 2)
+	assert.Equal(t, "Bob", users[0].Name)
+	assert.Equal(t, "Carol", users[1].Name)
+
+	result = run("", "export", "-format", "csv", "-sort", "name", "-name-prefix", "a")
+	require.Equal(t, exitOk, result.code, result.stderr)
+	lines := strings.Split(strings.TrimSpace(result.stdout), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "id,name,surname,inserted_at,updated_at,deleted_at,version", lines[0])
+	assert.Contains(t, lines[1], ",Alice,A,")
+
+	assert.Equal(t, exitUsage, run("", "export", "-format", "pdf").code)
+}
+
+func TestConfigCli(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.Profile = "test"
+	cfg.App.Port = "8080"
+	cfg.App.ShutdownTimeout = 30
+	cfg.App.IdempotencyTtl = 24
+	cfg.App.IdempotencyLease = 60
+	cfg.Webhook.Retention = 168
+	cfg.Log.Level = "info"
+	cfg.Db.Driver = config.DriverMemory
+	cfg.Db.Pass = "secret"
+	cfg.Db.Limit = 20
+	cfg.Db.MaxLimit = 1000
+	cfg.Db.Timeout = 30
+	cfg.Db.SoftDeleteRetention = 720
+	cfg.Db.InsertBatchSize = 10000
+	cfg.Stream.BufferSize = 1000
+	cfg.Stream.Heartbeat = 15
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOk, runConfig(cfg, nil, []string{"validate"}, &stdout, &stderr), stderr.String())
+
+	stdout.Reset()
+	require.Equal(t, exitOk, runConfig(cfg, nil, []string{"print", "-output", "json"}, &stdout, &stderr))
+	var printed map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &printed))
+	assert.Equal(t, "8080", printed["app"]["port"])
+	assert.Equal(t, "***", printed["db"]["pass"], "the password is masked")
+	assert.Equal(t, "secret", cfg.Db.Pass)
+
+	invalid := *cfg
+	invalid.Db.Driver = "mysql"
+	invalid.Log.Level = "loud"
+	invalid.Security.RateLimitEnabled = true
+	invalid.Security.RateLimitRoutes = "POST /api/users/=fast"
+	stderr.Reset()
+	assert.Equal(t, exitConfig, runConfig(&invalid, nil, []string{"validate"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "DB_DRIVER")
+	assert.Contains(t, stderr.String(), "LOG_LEVEL")
+	assert.Contains(t, stderr.String(), "SECURITY_RATE_LIMIT_ROUTES")
+
+	assert.Equal(t, exitConfig, runConfig(cfg, assert.AnError, []string{"validate"}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, runConfig(cfg, nil, []string{"print", "-output", "xml"}, &stdout, &stderr))
+	assert.Equal(t, exitUsage, runConfig(cfg, nil, nil, &stdout, &stderr))
+}
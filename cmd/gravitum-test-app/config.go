@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gravitum-test-app/config"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `usage: gravitum-test-app config <command>
+
+commands:
+  print     [-output table|json|yaml]   effective config after env overrides, the db password is masked
+  validate  exit code 3 when the config can't be loaded or has invalid values
+`
+
+// go run ./cmd/gravitum-test-app config validate
+//
+// runConfig takes the config.New error instead of failing on it, so validate can report it
+func runConfig(cfg *config.Config, loadErr error, args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, configUsage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	switch args[0] {
+	case "print":
+		output := outputFlag(flags)
+		if _, ok := parseFlags(flags, args[1:]); !ok {
+			return exitUsage
+		}
+
+		if loadErr != nil {
+			fmt.Fprintf(stderr, "config error: %s\n", loadErr)
+			return exitConfig
+		}
+
+		masked := *cfg
+		if masked.Db.Pass != "" {
+			masked.Db.Pass = "***"
+		}
+
+		if *output == outputTable {
+			masked.Print()
+			return exitOk
+		}
+
+		if err := printConfig(stdout, *output, masked); err != nil {
+			fmt.Fprintf(stderr, "config print: %s\n", err)
+			return exitError
+		}
+	case "validate":
+		if _, ok := parseFlags(flags, args[1:]); !ok {
+			return exitUsage
+		}
+
+		if loadErr != nil {
+			fmt.Fprintf(stderr, "config error: %s\n", loadErr)
+			return exitConfig
+		}
+
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(stderr, "config is invalid:\n%s\n", err)
+			return exitConfig
+		}
+
+		fmt.Fprintln(stdout, "config is valid")
+	default:
+		fmt.Fprint(stderr, configUsage)
+		return exitUsage
+	}
+
+	return exitOk
+}
+
+// printConfig keeps the yaml names of config.yml, the structs have no json tags
+func printConfig(w io.Writer, output string, cfg config.Config) error {
+	if output == outputYaml {
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(cfg); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	var document map[string]interface{}
+	if err = yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+
+	return encode(w, output, document)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/migration"
+	"gravitum-test-app/pkg/logger"
+	"os"
+	"time"
+)
+
+const dbUsage = `usage: gravitum-test-app db <command>
+
+commands:
+  ping  [-output table|json|yaml]   connect, measure a round trip and compare the schema version
+                                    with the binary, exit code 4 when the db is unreachable
+`
+
+type pingResult struct {
+	Status        string  `json:"status"`
+	LatencyMs     float64 `json:"latency_ms"`
+	SchemaVersion uint    `json:"schema_version"`
+	LatestVersion uint    `json:"latest_version"` // migrations embedded in the binary
+}
+
+// go run ./cmd/gravitum-test-app db ping
+func runDb(ctx context.Context, cfg *config.Config, log *logger.Logger, args []string) int {
+	if len(args) == 0 || args[0] != "ping" {
+		fmt.Fprint(os.Stderr, dbUsage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet("db ping", flag.ContinueOnError)
+	output := outputFlag(flags)
+	if _, ok := parseFlags(flags, args[1:]); !ok {
+		return exitUsage
+	}
+
+	if cfg.Db.Driver == config.DriverMemory {
+		fmt.Fprintln(os.Stderr, "db ping: DB_DRIVER is memory, there is no db to ping")
+		return exitUsage
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	a, err := connect(timeoutCtx, cfg, log)
+	if err != nil {
+		return exitUnavailable
+	}
+	defer a.Db.Close()
+
+	startedAt := time.Now()
+	if err = a.Db.Ping(timeoutCtx); err != nil {
+		log.Errorf("db ping: %s", err)
+		return exitUnavailable
+	}
+	result := pingResult{
+		Status:    "ok",
+		LatencyMs: float64(time.Since(startedAt).Microseconds()) / 1000,
+	}
+
+	migrator, err := migration.New(a.Db, log)
+	if err != nil {
+		log.Errorf("couldn't load migrations: %s", err)
+		return exitError
+	}
+
+	result.LatestVersion = migrator.Latest()
+	result.SchemaVersion, err = migrator.Version(timeoutCtx)
+	if err != nil {
+		log.Errorf("db ping: %s", err)
+		return exitUnavailable
+	}
+
+	if *output != outputTable {
+		if err = encode(os.Stdout, *output, result); err != nil {
+			log.Errorf("db ping: %s", err)
+			return exitError
+		}
+		return exitOk
+	}
+
+	fmt.Printf("ok, latency %.3fms, schema version %d, latest %d\n", result.LatencyMs, result.SchemaVersion, result.LatestVersion)
+	if result.SchemaVersion < result.LatestVersion {
+		fmt.Println("pending migrations, run: gravitum-test-app migrate up")
+	}
+
+	return exitOk
+}
@@ -10,44 +10,115 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
+const usage = `usage: gravitum-test-app [command]
+
+commands:
+  serve     run the http and grpc servers, the default without a command
+  users     list, get, create, update, delete, import and export users
+  apikey    create, list and revoke api keys
+  migrate   apply or roll back db migrations
+  db        ping the db
+  config    print or validate the config
+
+run a command without arguments for its usage
+`
+
 func main() {
-	defer fmt.Println("Server shutdown")
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx := context.Background()
+
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
 
 	cfg, err := config.New()
-	if err != nil {
-		slog.Fatalf("config error: %s", err)
+
+	// config commands report load errors themselves
+	if command == "config" {
+		os.Exit(runConfig(&cfg, err, os.Args[2:], os.Stdout, os.Stderr))
 	}
 
-	cfg.Print()
+	if err != nil {
+		slog.Printf("config error: %s", err)
+		os.Exit(exitConfig)
+	}
 
 	log := logger.New(logger.GetLevelByString(cfg.Log.Level))
-	a := app.New(&cfg, log)
+
+	if command == "serve" {
+		if err = cfg.Validate(); err != nil {
+			slog.Printf("config is invalid:\n%s", err)
+			os.Exit(exitConfig)
+		}
+
+		cfg.Print()
+
+		os.Exit(serve(ctx, &cfg, log))
+	}
+
+	// other commands stop at the first signal, e.g. a long export
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case "migrate":
+		os.Exit(runMigrate(ctx, &cfg, log, os.Args[2:]))
+	case "apikey":
+		os.Exit(runApiKey(ctx, &cfg, log, os.Args[2:]))
+	case "users":
+		os.Exit(runUsers(ctx, &cfg, log, os.Args[2:]))
+	case "db":
+		os.Exit(runDb(ctx, &cfg, log, os.Args[2:]))
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		os.Exit(exitOk)
+	}
+
+	fmt.Fprint(os.Stderr, usage)
+	os.Exit(exitUsage)
+}
+
+// serve runs the server until SIGINT/SIGTERM, a second signal exits immediately
+func serve(ctx context.Context, cfg *config.Config, log *logger.Logger) int {
+	defer fmt.Println("Server shutdown")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a := app.New(cfg, log)
 
 	// Channel to listen for OS signals
-	osSignal := make(chan os.Signal, 1)
+	osSignal := make(chan os.Signal, 2)
 	signal.Notify(osSignal, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	// Run the app in a goroutine
+	runErr := make(chan error, 1)
 	go func() {
-		if err := a.Run(ctx); err != nil {
-			log.Error(fmt.Sprintf("app run: %s", err))
-		}
+		runErr <- a.Run(ctx)
 	}()
 
-	// Wait for shutdown signal
-	<-osSignal
-	log.Info("Received shutdown signal, waiting for ongoing transactions to complete...")
+	var err error
+	select {
+	case err = <-runErr: // failed to start
+	case <-osSignal:
+		log.Info("Received shutdown signal, waiting for ongoing transactions to complete...")
 
-	// signal all services using ctx to stop
-	cancel()
+		go func() {
+			<-osSignal
+			log.Error("Received second shutdown signal, terminating immediately")
+			os.Exit(1)
+		}()
 
-	time.Sleep(1 * time.Second)
+		// signal the app to stop accepting requests and drain the in-flight ones
+		cancel()
+		err = <-runErr
+	}
+
+	if err != nil {
+		log.Error(fmt.Sprintf("app run: %s", err))
+		return exitError
+	}
 
-	log.Info("terminating server")
-	a.Server.Shutdown(context.Background())
+	return exitOk
 }
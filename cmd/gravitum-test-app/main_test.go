@@ -5,25 +5,28 @@ import (
 	"fmt"
 	"gravitum-test-app/config"
 	"gravitum-test-app/internal/app"
+	"gravitum-test-app/internal/model"
 	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/internal/repository/memory"
 	"gravitum-test-app/internal/repository/postgres"
 	"gravitum-test-app/internal/service"
 	"gravitum-test-app/pkg/logger"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
-	once              sync.Once
-	cfg               *config.Config
-	repos             *repository.Repository
-	services          *service.Service
-	DbInsertBatchSize int = 10000
+	once     sync.Once
+	cfg      *config.Config
+	repos    *repository.Repository
+	services *service.Service
 )
 
 func setupTestApp(t *testing.T) {
@@ -48,13 +51,24 @@ func setupTestApp(t *testing.T) {
 
 		ctx := context.Background()
 
-		appInstance := app.New(cfg, log)
-		err = appInstance.ConnectDB(ctx, cfg.GetDbConfig().GetDsn())
-		if err != nil {
-			t.Fatalf("couldn't instantiate db: %v", err)
+		switch cfg.Db.Driver {
+		case config.DriverMemory:
+			repos = memory.NewRepository(cfg)
+		default:
+			// postgres scenario writes into the configured db, so it runs with APP_PROFILE=dev only
+			if cfg.App.Profile != "dev" {
+				return
+			}
+
+			appInstance := app.New(cfg, log)
+			err = appInstance.ConnectDB(ctx, cfg.GetDbConfig().GetDsn())
+			if err != nil {
+				t.Fatalf("couldn't instantiate db: %v", err)
+			}
+
+			repos = postgres.NewRepository(cfg, appInstance.Db)
 		}
 
-		repos = postgres.NewRepository(cfg, appInstance.Db)
 		services = service.NewService(cfg, repos)
 	})
 }
@@ -64,44 +78,82 @@ func handleTestError(t *testing.T, err error) {
 }
 
 // go clean -testcache && go test -v -run ^TestScenario$ cmd/gravitum-test-app/main_test.go
+// DB_DRIVER=memory go test -v -run ^TestScenario$ cmd/gravitum-test-app/main_test.go
 func TestScenario(t *testing.T) {
 	setupTestApp(t)
 
-	if cfg.App.Profile != "dev" {
-		return
+	if services == nil {
+		t.Skip("scenario runs with DB_DRIVER=memory or APP_PROFILE=dev")
 	}
 
 	ctx := context.Background()
 
-	list, err := services.User.GetList(ctx)
+	_, page, err := services.User.GetList(ctx, model.UserListParams{})
 	if err != nil {
 		handleTestError(t, err)
 		return
 	}
 
-	n := len(list)
+	n := page.Total
 
 	// create
 	name := "John"
 	surname := "Smith"
 
-	err = services.User.Create(ctx, name, &surname)
+	created, err := services.User.Create(ctx, &name, &surname)
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	_, page, err = services.User.GetList(ctx, model.UserListParams{})
 	if err != nil {
 		handleTestError(t, err)
 		return
 	}
 
-	list, err = services.User.GetList(ctx)
+	assert.Equal(t, n+1, page.Total, "user creation does not work")
+
+	// the newest user goes first when sorted by id descending
+	list, page, err := services.User.GetList(ctx, model.UserListParams{
+		Limit:    1,
+		SortBy:   model.UserSortId,
+		SortDesc: true,
+	})
 	if err != nil {
 		handleTestError(t, err)
 		return
 	}
 
-	assert.Equal(t, n+1, len(list), "user creation does not work")
+	assert.Equal(t, 1, len(list), "limit does not work")
+	assert.Equal(t, created.Id, list[0].Id, "created user must be the newest one")
 
-	id := list[len(list)-1].Id
+	id := created.Id
 
-	user, err := services.User.Get(ctx, id)
+	if page.NextCursor != nil {
+		cursor, err := model.DecodeUserCursor(*page.NextCursor)
+		if err != nil {
+			handleTestError(t, err)
+			return
+		}
+
+		next, _, err := services.User.GetList(ctx, model.UserListParams{
+			Limit:    1,
+			SortBy:   model.UserSortId,
+			SortDesc: true,
+			Cursor:   cursor,
+		})
+		if err != nil {
+			handleTestError(t, err)
+			return
+		}
+
+		if len(next) > 0 {
+			assert.Less(t, next[0].Id, id, "cursor pagination does not work")
+		}
+	}
+
+	user, err := services.User.Get(ctx, id, false)
 	if err != nil {
 		handleTestError(t, err)
 		return
@@ -118,18 +170,19 @@ func TestScenario(t *testing.T) {
 	// update
 	newName := "Kevin"
 	newSurname := "Tierney"
-	err = services.User.Update(ctx, id, newName, &newSurname)
+	updated, err := services.User.Update(ctx, id, &newName, &newSurname, 0)
 	if err != nil {
 		handleTestError(t, err)
 		return
 	}
 
-	user, err = services.User.Get(ctx, id)
+	user, err = services.User.Get(ctx, id, false)
 	if err != nil {
 		handleTestError(t, err)
 		return
 	}
 
+	assert.Equal(t, user, updated, "update must return the stored user")
 	assert.Equal(t, newName, user.Name, "name is incorrect")
 
 	if user.Surname == nil {
@@ -138,4 +191,154 @@ func TestScenario(t *testing.T) {
 		assert.Equal(t, newSurname, *user.Surname, "surname is incorrect")
 	}
 
+	// patch, surname is cleared and name is kept
+	patched, err := services.User.Patch(ctx, id, "application/merge-patch+json", []byte(`{"surname":null}`), 0)
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	assert.Equal(t, newName, patched.Name, "merge patch must keep name")
+	assert.Nil(t, patched.Surname, "merge patch must clear surname")
+
+	patched, err = services.User.Patch(ctx, id, "application/json-patch+json", []byte(`[
+		{"op":"test","path":"/surname","value":null},
+		{"op":"replace","path":"/surname","value":"Smith"}
+	]`), patched.Version)
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	if assert.NotNil(t, patched.Surname, "json patch must set surname") {
+		assert.Equal(t, "Smith", *patched.Surname)
+	}
+
+	// stale version is rejected
+	_, err = services.User.Patch(ctx, id, "application/merge-patch+json", []byte(`{"name":"Stale"}`), patched.Version-1)
+	assert.ErrorIs(t, err, model.ErrUserVersionMismatch, "stale version must be rejected")
+
+	err = services.User.Delete(ctx, id, patched.Version-1)
+	assert.ErrorIs(t, err, model.ErrUserVersionMismatch, "stale version must be rejected")
+
+	_, err = services.User.Patch(ctx, id, "application/json-patch+json", []byte(`[{"op":"test","path":"/name","value":"nobody"}]`), 0)
+	assert.ErrorIs(t, err, model.ErrRequestPatchConflict, "failed test op must be a conflict")
+
+	_, err = services.User.Patch(ctx, id, "text/plain", []byte(`{}`), 0)
+	assert.ErrorIs(t, err, model.ErrRequestUnsupportedMediaType)
+
+	// soft delete
+	err = services.User.Delete(ctx, id, 0)
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	_, err = services.User.Get(ctx, id, false)
+	assert.ErrorIs(t, err, model.ErrNoUserWithSuchId, "deleted user must be hidden")
+
+	user, err = services.User.Get(ctx, id, true)
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	assert.NotNil(t, user.DeletedAt, "deleted_at must be set")
+
+	// restore
+	err = services.User.Restore(ctx, id)
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	user, err = services.User.Get(ctx, id, false)
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	assert.Nil(t, user.DeletedAt, "deleted_at must be cleared")
+
+	err = services.User.Restore(ctx, id)
+	assert.ErrorIs(t, err, model.ErrUserNotDeleted, "restoring active user must fail")
+}
+
+// DB_DRIVER=memory go test -v -run ^TestImport$ cmd/gravitum-test-app/main_test.go
+func TestImport(t *testing.T) {
+	setupTestApp(t)
+
+	if services == nil {
+		t.Skip("scenario runs with DB_DRIVER=memory or APP_PROFILE=dev")
+	}
+
+	ctx := context.Background()
+	prefix := fmt.Sprintf("import%d", time.Now().UnixNano())
+
+	// small batches, so the rows go through several copies
+	batchSize := cfg.Db.InsertBatchSize
+	cfg.Db.InsertBatchSize = 2
+	defer func() { cfg.Db.InsertBatchSize = batchSize }()
+
+	csv := "\ufeffName,Surname\n" +
+		prefix + "a,Smith\n" +
+		" ,Smith\n" +
+		prefix + "b,\n" +
+		prefix + "c,Smith,extra\n" +
+		"\"" + prefix + "d\nmultiline\",Doe\n" +
+		prefix + "e," + strings.Repeat("x", model.UserNameMaxLength+1) + "\n"
+
+	report, err := services.User.Import(ctx, model.ImportCsvContentType, strings.NewReader(csv))
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	assert.Equal(t, 3, report.Accepted, "csv accepted rows")
+	assert.Equal(t, 3, report.Rejected, "csv rejected rows")
+	assert.Equal(t, []model.ImportRowError{
+		{Line: 3, Code: model.ErrRequestNameRequired.Error(), Field: "name", Reason: "must not be blank"},
+		{Line: 5, Code: model.ErrRequestInvalidBodyParams.Error(), Field: "row", Reason: "wrong number of fields"},
+		{Line: 8, Code: model.ErrRequestInvalidBodyParams.Error(), Field: "surname", Reason: "must be at most 100 characters"},
+	}, report.Errors)
+
+	ndjson := `{"name":"` + prefix + `f","surname":"Doe"}` + "\n" +
+		"\n" +
+		`{"surname":"Doe"}` + "\n" +
+		`not json` + "\n" +
+		`{"name":"<script>alert(1)</script>` + prefix + `g"}`
+
+	report, err = services.User.Import(ctx, model.ImportNdjsonContentType, strings.NewReader(ndjson))
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	assert.Equal(t, 2, report.Accepted, "ndjson accepted rows")
+	assert.Equal(t, 2, report.Rejected, "ndjson rejected rows")
+	assert.Equal(t, []model.ImportRowError{
+		{Line: 3, Code: model.ErrRequestNameRequired.Error(), Field: "name", Reason: "is required"},
+		{Line: 4, Code: model.ErrRequestInvalidBodyParams.Error(), Field: "row", Reason: "must be a json object"},
+	}, report.Errors)
+
+	list, _, err := services.User.GetList(ctx, model.UserListParams{
+		SortBy:     model.UserSortName,
+		NamePrefix: &prefix,
+	})
+	if err != nil {
+		handleTestError(t, err)
+		return
+	}
+
+	names := []string{}
+	for _, user := range list {
+		names = append(names, user.Name)
+	}
+	assert.Equal(t, []string{prefix + "a", prefix + "b", prefix + "d\nmultiline", prefix + "f", prefix + "g"}, names, "imported users")
+
+	_, err = services.User.Import(ctx, "application/json", strings.NewReader(`[]`))
+	assert.ErrorIs(t, err, model.ErrRequestUnsupportedMediaType)
+
+	_, err = services.User.Import(ctx, model.ImportCsvContentType, strings.NewReader("name,age\n"))
+	assert.ErrorIs(t, err, model.ErrRequestInvalidBodyParams, "unknown csv column")
 }
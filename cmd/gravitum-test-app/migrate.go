@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/migration"
+	"gravitum-test-app/pkg/logger"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: gravitum-test-app migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    roll back the last N applied migrations, 1 by default
+  goto V      migrate up or down to version V
+  status      list migrations and whether they are applied
+  force V     mark migrations up to V as applied without running them
+`
+
+// go run ./cmd/gravitum-test-app migrate up
+func runMigrate(ctx context.Context, cfg *config.Config, log *logger.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	a, err := connect(ctx, cfg, log)
+	if err != nil {
+		return exitUnavailable
+	}
+	defer a.Db.Close()
+
+	migrator, err := migration.New(a.Db, log)
+	if err != nil {
+		log.Errorf("couldn't load migrations: %s", err)
+		return exitError
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of migrations: %s\n", args[1])
+				return exitUsage
+			}
+		}
+		err = migrator.Down(ctx, n)
+	case "goto", "force":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return exitUsage
+		}
+
+		version, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "invalid version: %s\n", args[1])
+			return exitUsage
+		}
+
+		if args[0] == "goto" {
+			err = migrator.Goto(ctx, uint(version))
+		} else {
+			err = migrator.Force(ctx, uint(version))
+		}
+	case "status":
+		err = printMigrationStatus(ctx, migrator)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	if err != nil {
+		log.Errorf("migrate %s: %s", args[0], err)
+		return exitError
+	}
+
+	return exitOk
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migration.Migrator) error {
+	list, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, item := range list {
+		appliedAt := "pending"
+		if item.AppliedAt != nil {
+			appliedAt = item.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", item.Version, item.Name, appliedAt)
+	}
+	fmt.Fprintf(w, "\nlatest: %d\n", migrator.Latest())
+	return w.Flush()
+}
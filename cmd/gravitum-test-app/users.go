@@ -0,0 +1,530 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/export"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usersUsage = `usage: gravitum-test-app users <command> [flags]
+
+commands:
+  list    [-limit N] [-offset N] [-cursor C] [-sort FIELD] [-order asc|desc] [-all] [filters]
+  get     ID [-include-deleted]
+  create  -name NAME [-surname SURNAME]
+  update  ID -name NAME [-surname SURNAME] [-version V]
+  delete  ID [-version V]
+  import  [-format csv|ndjson] [FILE]        reads stdin without FILE
+  export  [-format csv|ndjson|xlsx] [-file FILE] [filters]   writes stdout without -file
+
+filters: -name-prefix P -has-surname true|false -inserted-from T -inserted-to T -include-deleted
+list, get, create, update and import accept -output table|json|yaml
+
+exit codes: 0 ok, 1 error, 2 usage, 4 db unavailable, 5 not found, 6 invalid input, 7 conflict
+`
+
+// usersCli runs the users commands on services, streams are fields so tests can capture them
+type usersCli struct {
+	services *service.Service
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+// go run ./cmd/gravitum-test-app users list -sort name -output json
+func runUsers(ctx context.Context, cfg *config.Config, log *logger.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usersUsage)
+		return exitUsage
+	}
+
+	services, closeDb, err := openServices(ctx, cfg, log)
+	if err != nil {
+		return exitUnavailable
+	}
+	defer closeDb()
+
+	cli := &usersCli{
+		services: services,
+		stdin:    os.Stdin,
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+	}
+
+	return cli.run(ctx, args)
+}
+
+func (c *usersCli) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usersUsage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return c.list(ctx, args[1:])
+	case "get":
+		return c.get(ctx, args[1:])
+	case "create":
+		return c.create(ctx, args[1:])
+	case "update":
+		return c.update(ctx, args[1:])
+	case "delete":
+		return c.delete(ctx, args[1:])
+	case "import":
+		return c.importUsers(ctx, args[1:])
+	case "export":
+		return c.export(ctx, args[1:])
+	}
+
+	fmt.Fprint(c.stderr, usersUsage)
+	return exitUsage
+}
+
+func (c *usersCli) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("users "+name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	return flags
+}
+
+// fail reports err and maps it to the exit code
+func (c *usersCli) fail(command string, err error) int {
+	fmt.Fprintf(c.stderr, "users %s: %s\n", command, err)
+	return exitCode(err)
+}
+
+func (c *usersCli) usage(flags *flag.FlagSet, format string, args ...interface{}) int {
+	fmt.Fprintf(c.stderr, format+"\n", args...)
+	flags.Usage()
+	return exitUsage
+}
+
+func (c *usersCli) list(ctx context.Context, args []string) int {
+	flags := c.flagSet("list")
+	output := outputFlag(flags)
+	limit := flags.Uint("limit", 0, "page size, DB_LIMIT when 0")
+	offset := flags.Uint("offset", 0, "users to skip")
+	cursor := flags.String("cursor", "", "next cursor printed with the previous page")
+	sort := flags.String("sort", "", "one of "+strings.Join(model.UserSortFields, ", "))
+	order := flags.String("order", "asc", "asc or desc")
+	all := flags.Bool("all", false, "list every matching user, pagination flags are ignored")
+	params := listFilterFlags(flags)
+
+	if _, ok := parseFlags(flags, args); !ok {
+		return exitUsage
+	}
+
+	if *sort != "" && !model.IsValidUserSortField(*sort) {
+		return c.usage(flags, "invalid -sort %q", *sort)
+	}
+	params.SortBy = *sort
+
+	switch strings.ToLower(*order) {
+	case "asc":
+	case "desc":
+		params.SortDesc = true
+	default:
+		return c.usage(flags, "invalid -order %q, must be asc or desc", *order)
+	}
+
+	if *all {
+		users := []*model.User{}
+		err := c.services.User.Export(ctx, *params, func(user *model.User) error {
+			users = append(users, user)
+			return nil
+		})
+		if err != nil {
+			return c.fail("list", err)
+		}
+		return c.printUsers(*output, users, nil)
+	}
+
+	params.Limit = *limit
+	params.Offset = *offset
+
+	if *cursor != "" {
+		var err error
+		params.Cursor, err = model.DecodeUserCursor(*cursor)
+		if err != nil {
+			return c.usage(flags, "invalid -cursor")
+		}
+
+		// sorting is carried by the cursor when it is not given explicitly, like the api does
+		explicit := map[string]bool{}
+		flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		if !explicit["sort"] && !explicit["order"] {
+			params.SortBy = params.Cursor.SortBy
+			params.SortDesc = params.Cursor.SortDesc
+		}
+	}
+
+	users, page, err := c.services.User.GetList(ctx, *params)
+	if err != nil {
+		return c.fail("list", err)
+	}
+
+	return c.printUsers(*output, users, page)
+}
+
+// listFilterFlags registers the filters shared by list and export
+func listFilterFlags(flags *flag.FlagSet) *model.UserListParams {
+	params := &model.UserListParams{}
+
+	flags.Func("name-prefix", "case insensitive prefix of the name", func(value string) error {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			params.NamePrefix = &value
+		}
+		return nil
+	})
+	flags.Func("has-surname", "true or false", func(value string) error {
+		hasSurname, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		params.HasSurname = &hasSurname
+		return nil
+	})
+	flags.Func("inserted-from", "RFC 3339 timestamp, inclusive", func(value string) error {
+		insertedFrom, err := time.Parse(time.RFC3339, value)
+		params.InsertedFrom = &insertedFrom
+		return err
+	})
+	flags.Func("inserted-to", "RFC 3339 timestamp, exclusive", func(value string) error {
+		insertedTo, err := time.Parse(time.RFC3339, value)
+		params.InsertedTo = &insertedTo
+		return err
+	})
+	flags.BoolVar(&params.IncludeDeleted, "include-deleted", false, "include soft deleted users")
+
+	return params
+}
+
+func (c *usersCli) get(ctx context.Context, args []string) int {
+	flags := c.flagSet("get")
+	output := outputFlag(flags)
+	includeDeleted := flags.Bool("include-deleted", false, "find soft deleted users too")
+
+	positional, ok := parseFlags(flags, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return c.usage(flags, "users get takes one ID")
+	}
+
+	id, err := parseId(positional[0])
+	if err != nil {
+		return c.usage(flags, "%s", err)
+	}
+
+	user, err := c.services.User.Get(ctx, id, *includeDeleted)
+	if err != nil {
+		return c.fail("get", err)
+	}
+
+	return c.printUser(*output, user)
+}
+
+func (c *usersCli) create(ctx context.Context, args []string) int {
+	flags := c.flagSet("create")
+	output := outputFlag(flags)
+	name := flags.String("name", "", "required")
+	surname := optionalString(flags, "surname", "omitted when not set")
+
+	positional, ok := parseFlags(flags, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 0 {
+		return c.usage(flags, "users create takes no arguments")
+	}
+
+	user, err := c.services.User.Create(ctx, name, *surname)
+	if err != nil {
+		return c.fail("create", err)
+	}
+
+	return c.printUser(*output, user)
+}
+
+func (c *usersCli) update(ctx context.Context, args []string) int {
+	flags := c.flagSet("update")
+	output := outputFlag(flags)
+	name := flags.String("name", "", "required")
+	surname := optionalString(flags, "surname", "cleared when not set")
+	version := flags.Uint("version", 0, "fail with exit code 7 when the user has another version, 0 skips the check")
+
+	positional, ok := parseFlags(flags, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return c.usage(flags, "users update takes one ID")
+	}
+
+	id, err := parseId(positional[0])
+	if err != nil {
+		return c.usage(flags, "%s", err)
+	}
+
+	user, err := c.services.User.Update(ctx, id, name, *surname, *version)
+	if err != nil {
+		return c.fail("update", err)
+	}
+
+	return c.printUser(*output, user)
+}
+
+func (c *usersCli) delete(ctx context.Context, args []string) int {
+	flags := c.flagSet("delete")
+	version := flags.Uint("version", 0, "fail with exit code 7 when the user has another version, 0 skips the check")
+
+	positional, ok := parseFlags(flags, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return c.usage(flags, "users delete takes one ID")
+	}
+
+	id, err := parseId(positional[0])
+	if err != nil {
+		return c.usage(flags, "%s", err)
+	}
+
+	err = c.services.User.Delete(ctx, id, *version)
+	if err != nil {
+		return c.fail("delete", err)
+	}
+
+	fmt.Fprintf(c.stdout, "user %d deleted\n", id)
+	return exitOk
+}
+
+// importUsers exits with exitInvalid when rows were rejected, the accepted ones are kept
+func (c *usersCli) importUsers(ctx context.Context, args []string) int {
+	flags := c.flagSet("import")
+	output := outputFlag(flags)
+	format := flags.String("format", "", "csv or ndjson, taken from the file extension by default")
+
+	positional, ok := parseFlags(flags, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) > 1 {
+		return c.usage(flags, "users import takes at most one FILE")
+	}
+
+	input := c.stdin
+	if len(positional) == 1 && positional[0] != "-" {
+		file, err := os.Open(positional[0])
+		if err != nil {
+			return c.usage(flags, "%s", err)
+		}
+		defer file.Close()
+		input = file
+
+		if *format == "" {
+			*format = strings.TrimPrefix(filepath.Ext(positional[0]), ".")
+		}
+	}
+
+	var contentType string
+	switch *format {
+	case export.Csv, "":
+		contentType = model.ImportCsvContentType
+	case export.Ndjson:
+		contentType = model.ImportNdjsonContentType
+	default:
+		return c.usage(flags, "invalid -format %q, must be csv or ndjson", *format)
+	}
+
+	report, importErr := c.services.User.Import(ctx, contentType, input)
+
+	// an interrupted import still prints the rows kept so it can be resumed
+	var partial *model.ImportError
+	if errors.As(importErr, &partial) {
+		report = &partial.Report
+	}
+	if report == nil {
+		return c.fail("import", importErr)
+	}
+
+	var err error
+	if *output != outputTable {
+		err = encode(c.stdout, *output, report)
+	} else {
+		err = printImportReport(c.stdout, report)
+	}
+	if err == nil {
+		err = importErr
+	}
+	if err != nil {
+		return c.fail("import", err)
+	}
+
+	if report.Rejected > 0 {
+		return exitInvalid
+	}
+	return exitOk
+}
+
+func (c *usersCli) export(ctx context.Context, args []string) int {
+	flags := c.flagSet("export")
+	format := flags.String("format", export.Csv, "csv, ndjson or xlsx")
+	path := flags.String("file", "", "written instead of stdout")
+	sort := flags.String("sort", "", "one of "+strings.Join(model.UserSortFields, ", "))
+	desc := flags.Bool("desc", false, "sort descending")
+	params := listFilterFlags(flags)
+
+	positional, ok := parseFlags(flags, args)
+	if !ok {
+		return exitUsage
+	}
+	if len(positional) != 0 {
+		return c.usage(flags, "users export takes no arguments")
+	}
+
+	if _, err := export.ContentType(*format); err != nil {
+		return c.usage(flags, "invalid -format %q, must be csv, ndjson or xlsx", *format)
+	}
+	if *sort != "" && !model.IsValidUserSortField(*sort) {
+		return c.usage(flags, "invalid -sort %q", *sort)
+	}
+	params.SortBy = *sort
+	params.SortDesc = *desc
+
+	out := c.stdout
+	if *path != "" {
+		file, err := os.Create(*path)
+		if err != nil {
+			return c.fail("export", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer, err := export.NewWriter(*format, out)
+	if err != nil {
+		return c.fail("export", err)
+	}
+
+	count := 0
+	err = c.services.User.Export(ctx, *params, func(user *model.User) error {
+		count++
+		return writer.Write(user)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return c.fail("export", err)
+	}
+
+	if *path != "" {
+		fmt.Fprintf(c.stderr, "%d users exported to %s\n", count, *path)
+	}
+	return exitOk
+}
+
+// printUser renders one user, json and yaml print the object itself
+func (c *usersCli) printUser(output string, user *model.User) int {
+	if output == outputTable {
+		return c.printUsers(output, []*model.User{user}, nil)
+	}
+
+	if err := encode(c.stdout, output, user); err != nil {
+		fmt.Fprintf(c.stderr, "users: %s\n", err)
+		return exitError
+	}
+	return exitOk
+}
+
+// printUsers renders users as a table, page is printed under it when set
+func (c *usersCli) printUsers(output string, users []*model.User, page *model.Page) int {
+	var err error
+
+	switch {
+	case output != outputTable && page != nil:
+		err = encode(c.stdout, output, struct {
+			Data []*model.User `json:"data"`
+			Page *model.Page   `json:"page"`
+		}{users, page})
+	case output != outputTable:
+		err = encode(c.stdout, output, users)
+	default:
+		err = printUserTable(c.stdout, users, page)
+	}
+	if err != nil {
+		fmt.Fprintf(c.stderr, "users: %s\n", err)
+		return exitError
+	}
+
+	return exitOk
+}
+
+func printUserTable(out io.Writer, users []*model.User, page *model.Page) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSURNAME\tINSERTED AT\tUPDATED AT\tDELETED AT\tVERSION")
+	for _, user := range users {
+		surname := "-"
+		if user.Surname != nil {
+			surname = *user.Surname
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			user.Id,
+			user.Name,
+			surname,
+			formatTime(&user.InsertedAt),
+			formatTime(user.UpdatedAt),
+			formatTime(user.DeletedAt),
+			user.Version,
+		)
+	}
+
+	if page != nil {
+		fmt.Fprintf(w, "\ntotal: %d\n", page.Total)
+		if page.NextCursor != nil {
+			fmt.Fprintf(w, "next cursor: %s\n", *page.NextCursor)
+		}
+	}
+
+	return w.Flush()
+}
+
+func printImportReport(out io.Writer, report *model.ImportReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "accepted: %d\nrejected: %d\ncommitted line: %d\n", report.Accepted, report.Rejected, report.CommittedLine)
+	if len(report.Errors) > 0 {
+		fmt.Fprintln(w, "\nLINE\tCODE\tFIELD\tREASON")
+		for _, row := range report.Errors {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", row.Line, row.Code, row.Field, row.Reason)
+		}
+	}
+	return w.Flush()
+}
+
+// optionalString is a string flag that stays nil until it is set, so an empty surname can be told from none
+func optionalString(flags *flag.FlagSet, name string, usage string) **string {
+	var value *string
+	flags.Func(name, usage, func(s string) error {
+		value = &s
+		return nil
+	})
+	return &value
+}
@@ -1,42 +1,163 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
 )
 
 type App struct {
-	Profile string `yaml:"profile" env:"APP_PROFILE" env-default:"test"` // dev, test, prod
-	Host    string `yaml:"host" env:"APP_HOST" env-default:"localhost"`
-	Port    string `yaml:"port" env:"APP_PORT" env-default:"8080"`
+	Profile          string `yaml:"profile" env:"APP_PROFILE" env-default:"test"` // dev, test, prod
+	Host             string `yaml:"host" env:"APP_HOST" env-default:"localhost"`
+	Port             string `yaml:"port" env:"APP_PORT" env-default:"8080"`
+	AutoMigrate      bool   `yaml:"autoMigrate" env:"APP_AUTO_MIGRATE" env-default:"false"`        // apply pending migrations on start
+	ShutdownTimeout  int    `yaml:"shutdownTimeout" env:"APP_SHUTDOWN_TIMEOUT" env-default:"30"`   // seconds to drain in-flight requests
+	ProblemJson      bool   `yaml:"problemJson" env:"APP_PROBLEM_JSON" env-default:"false"`        // always render errors as application/problem+json
+	IdempotencyTtl   int    `yaml:"idempotencyTtl" env:"APP_IDEMPOTENCY_TTL" env-default:"24"`     // hours a recorded response is replayed
+	IdempotencyWait  int    `yaml:"idempotencyWait" env:"APP_IDEMPOTENCY_WAIT" env-default:"10"`   // seconds a retry waits for the request in progress
+	IdempotencyLease int    `yaml:"idempotencyLease" env:"APP_IDEMPOTENCY_LEASE" env-default:"60"` // seconds a request in progress holds its key, a retry takes over after that
+}
+
+type Grpc struct {
+	Enabled bool   `yaml:"enabled" env:"GRPC_ENABLED" env-default:"true"` // serve the grpc api next to http
+	Port    string `yaml:"port" env:"GRPC_PORT" env-default:"9090"`       // bound on app.host
 }
 
 type Security struct {
 	CorsEnabled      bool   `yaml:"corsEnabled" env:"SECURITY_CORS_ENABLED" env-default:"false"`
 	CorsAllowOrigins string `yaml:"corsAllowOrigins" env:"SECURITY_CORS_ALLOW_ORIGINS" env-default:""`
+	ApiKeyEnabled    bool   `yaml:"apiKeyEnabled" env:"SECURITY_API_KEY_ENABLED" env-default:"false"`
+	TrustedProxies   string `yaml:"trustedProxies" env:"SECURITY_TRUSTED_PROXIES" env-default:""` // ips or cidrs whose X-Forwarded-For is believed
+
+	RateLimitEnabled bool    `yaml:"rateLimitEnabled" env:"SECURITY_RATE_LIMIT_ENABLED" env-default:"false"`
+	RateLimitRate    float64 `yaml:"rateLimitRate" env:"SECURITY_RATE_LIMIT_RATE" env-default:"10"`       // requests per second a client gets back
+	RateLimitBurst   int     `yaml:"rateLimitBurst" env:"SECURITY_RATE_LIMIT_BURST" env-default:"20"`     // requests a client may send at once
+	RateLimitRoutes  string  `yaml:"rateLimitRoutes" env:"SECURITY_RATE_LIMIT_ROUTES" env-default:""`     // overrides, e.g. POST /api/users/=1:5,GET /api/users/export=0.1:2
+	RateLimitStore   string  `yaml:"rateLimitStore" env:"SECURITY_RATE_LIMIT_STORE" env-default:"memory"` // memory, postgres to share limits across replicas
+
+	AuthFailureRate  float64 `yaml:"authFailureRate" env:"SECURITY_AUTH_FAILURE_RATE" env-default:"0.1"`  // failed authentications per second a client ip gets back
+	AuthFailureBurst int     `yaml:"authFailureBurst" env:"SECURITY_AUTH_FAILURE_BURST" env-default:"10"` // failed authentications a client ip may make at once
+}
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+// RateLimit is a token bucket refilled with Rate tokens per second up to Burst
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitDefault is the bucket of routes without an override
+func (s Security) RateLimitDefault() RateLimit {
+	return RateLimit{Rate: s.RateLimitRate, Burst: s.RateLimitBurst}
+}
+
+// AuthFailureLimit is the bucket of failed authentications per client ip, used while api keys are enabled
+func (s Security) AuthFailureLimit() RateLimit {
+	return RateLimit{Rate: s.AuthFailureRate, Burst: s.AuthFailureBurst}
+}
+
+// RateLimitOverrides parses security.rateLimitRoutes, a comma separated list of
+// "METHOD route=rate:burst" where route is the gin route template, e.g. /api/users/:id
+func (s Security) RateLimitOverrides() (map[string]RateLimit, error) {
+	result := map[string]RateLimit{}
+
+	for _, entry := range strings.Split(s.RateLimitRoutes, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, limit, ok := strings.Cut(entry, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		rate, burst, hasBurst := strings.Cut(limit, ":")
+		if !ok || !hasPath || !hasBurst {
+			return nil, fmt.Errorf("invalid route limit %q, must be \"METHOD route=rate:burst\"", entry)
+		}
+
+		parsed := RateLimit{}
+		var err error
+		if parsed.Rate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || parsed.Rate <= 0 {
+			return nil, fmt.Errorf("invalid rate of route limit %q", entry)
+		}
+		if parsed.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || parsed.Burst < 1 {
+			return nil, fmt.Errorf("invalid burst of route limit %q", entry)
+		}
+
+		result[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = parsed
+	}
+
+	return result, nil
+}
+
+// TrustedProxyList is nil when no proxy is trusted, the client ip is the remote address then
+func (s Security) TrustedProxyList() []string {
+	var result []string
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			result = append(result, proxy)
+		}
+	}
+	return result
 }
 
 type Log struct {
-	Level string `yaml:"level" env:"LOG_LEVEL" env-default:"INFO"`
+	Level     string `yaml:"level" env:"LOG_LEVEL" env-default:"INFO"`
+	AccessLog bool   `yaml:"accessLog" env:"LOG_ACCESS_LOG" env-default:"true"`
 }
 
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory" // data lives in process memory, for tests and demos
+)
+
 type Db struct {
-	Host    string `yaml:"host" env:"DB_HOST" env-default:"postgres"`
-	Port    string `yaml:"port" env:"DB_PORT" env-default:"5432"`
-	Name    string `yaml:"name" env:"DB_NAME" env-default:"postgres"`
-	User    string `yaml:"user" env:"DB_USER" env-default:"postgres"`
-	Pass    string `yaml:"pass" env:"DB_PASS" env-default:"test"`
-	Schema  string `yaml:"schema" env:"DB_SCHEMA" env-default:"public"`
-	Limit   uint   `yaml:"limit" env:"DB_LIMIT" env-default:"20"`
-	Timeout int    `yaml:"timeout" env:"DB_TIMEOUT" env-default:"30"`
+	Driver              string `yaml:"driver" env:"DB_DRIVER" env-default:"postgres"` // postgres, memory
+	Host                string `yaml:"host" env:"DB_HOST" env-default:"postgres"`
+	Port                string `yaml:"port" env:"DB_PORT" env-default:"5432"`
+	Name                string `yaml:"name" env:"DB_NAME" env-default:"postgres"`
+	User                string `yaml:"user" env:"DB_USER" env-default:"postgres"`
+	Pass                string `yaml:"pass" env:"DB_PASS" env-default:"test"`
+	Schema              string `yaml:"schema" env:"DB_SCHEMA" env-default:"public"`
+	Limit               uint   `yaml:"limit" env:"DB_LIMIT" env-default:"20"`
+	MaxLimit            uint   `yaml:"maxLimit" env:"DB_MAX_LIMIT" env-default:"1000"`
+	Timeout             int    `yaml:"timeout" env:"DB_TIMEOUT" env-default:"30"`
+	SoftDeleteRetention int    `yaml:"softDeleteRetention" env:"DB_SOFT_DELETE_RETENTION" env-default:"720"` // hours
+	InsertBatchSize     int    `yaml:"insertBatchSize" env:"DB_INSERT_BATCH_SIZE" env-default:"10000"`       // rows per COPY of an import
+}
+
+type Webhook struct {
+	Enabled      bool `yaml:"enabled" env:"WEBHOOK_ENABLED" env-default:"true"`             // run the outbox dispatcher
+	PollInterval int  `yaml:"pollInterval" env:"WEBHOOK_POLL_INTERVAL" env-default:"1"`     // seconds between outbox polls
+	BatchSize    int  `yaml:"batchSize" env:"WEBHOOK_BATCH_SIZE" env-default:"100"`         // events and deliveries handled per poll
+	Timeout      int  `yaml:"timeout" env:"WEBHOOK_TIMEOUT" env-default:"10"`               // seconds a receiver has to respond
+	MaxAttempts  int  `yaml:"maxAttempts" env:"WEBHOOK_MAX_ATTEMPTS" env-default:"10"`      // failed deliveries are dead after that
+	BackoffBase  int  `yaml:"backoffBase" env:"WEBHOOK_BACKOFF_BASE" env-default:"5"`       // seconds before the first retry, doubled by every next one
+	BackoffMax   int  `yaml:"backoffMax" env:"WEBHOOK_BACKOFF_MAX" env-default:"3600"`      // seconds, upper bound of the retry delay
+	AllowPrivate bool `yaml:"allowPrivate" env:"WEBHOOK_ALLOW_PRIVATE" env-default:"false"` // deliver to loopback, private and link-local addresses, for local development
+	Retention    int  `yaml:"retention" env:"WEBHOOK_RETENTION" env-default:"168"`          // hours dispatched events and finished deliveries are kept
+}
+
+type Stream struct {
+	BufferSize int `yaml:"bufferSize" env:"STREAM_BUFFER_SIZE" env-default:"1000"` // latest events kept for Last-Event-ID resume
+	Heartbeat  int `yaml:"heartbeat" env:"STREAM_HEARTBEAT" env-default:"15"`      // seconds between keep-alive comments on idle streams
 }
 
 type Config struct {
 	App      `yaml:"app"`
+	Grpc     `yaml:"grpc"`
 	Security `yaml:"security"`
 	Db       `yaml:"db"`
+	Webhook  `yaml:"webhook"`
+	Stream   `yaml:"stream"`
 	Log      `yaml:"log"`
 }
 
@@ -48,19 +169,142 @@ func (cfg Config) Print() {
 	fmt.Println("CONFIG VARIABLES:")
 	fmt.Printf("APP_PROFILE - %s\n", cfg.App.Profile)
 	fmt.Printf("APP_HOST - %s\n", cfg.App.Host)
-	fmt.Printf("APP_PORT - %s\n\n", cfg.App.Port)
+	fmt.Printf("APP_PORT - %s\n", cfg.App.Port)
+	fmt.Printf("APP_AUTO_MIGRATE - %t\n", cfg.App.AutoMigrate)
+	fmt.Printf("APP_SHUTDOWN_TIMEOUT - %d\n", cfg.App.ShutdownTimeout)
+	fmt.Printf("APP_PROBLEM_JSON - %t\n", cfg.App.ProblemJson)
+	fmt.Printf("APP_IDEMPOTENCY_TTL - %d\n", cfg.App.IdempotencyTtl)
+	fmt.Printf("APP_IDEMPOTENCY_WAIT - %d\n", cfg.App.IdempotencyWait)
+	fmt.Printf("APP_IDEMPOTENCY_LEASE - %d\n\n", cfg.App.IdempotencyLease)
+
+	fmt.Printf("GRPC_ENABLED - %t\n", cfg.Grpc.Enabled)
+	fmt.Printf("GRPC_PORT - %s\n\n", cfg.Grpc.Port)
 
 	fmt.Printf("SECURITY_CORS_ENABLED - %t\n", cfg.Security.CorsEnabled)
-	fmt.Printf("SECURITY_CORS_ALLOW_ORIGINS - %s\n\n", cfg.Security.CorsAllowOrigins)
+	fmt.Printf("SECURITY_CORS_ALLOW_ORIGINS - %s\n", cfg.Security.CorsAllowOrigins)
+	fmt.Printf("SECURITY_API_KEY_ENABLED - %t\n", cfg.Security.ApiKeyEnabled)
+	fmt.Printf("SECURITY_TRUSTED_PROXIES - %s\n", cfg.Security.TrustedProxies)
+	fmt.Printf("SECURITY_RATE_LIMIT_ENABLED - %t\n", cfg.Security.RateLimitEnabled)
+	fmt.Printf("SECURITY_RATE_LIMIT_RATE - %g\n", cfg.Security.RateLimitRate)
+	fmt.Printf("SECURITY_RATE_LIMIT_BURST - %d\n", cfg.Security.RateLimitBurst)
+	fmt.Printf("SECURITY_RATE_LIMIT_ROUTES - %s\n", cfg.Security.RateLimitRoutes)
+	fmt.Printf("SECURITY_RATE_LIMIT_STORE - %s\n", cfg.Security.RateLimitStore)
+	fmt.Printf("SECURITY_AUTH_FAILURE_RATE - %g\n", cfg.Security.AuthFailureRate)
+	fmt.Printf("SECURITY_AUTH_FAILURE_BURST - %d\n\n", cfg.Security.AuthFailureBurst)
 
+	fmt.Printf("DB_DRIVER - %s\n", cfg.Db.Driver)
 	fmt.Printf("DB_HOST - %s\n", cfg.Db.Host)
 	fmt.Printf("DB_PORT - %s\n", cfg.Db.Port)
 	fmt.Printf("DB_NAME - %s\n", cfg.Db.Name)
 	fmt.Printf("DB_SCHEMA - %s\n", cfg.Db.Schema)
 	fmt.Printf("DB_LIMIT - %d\n", cfg.Db.Limit)
-	fmt.Printf("DB_TIMEOUT - %d\n\n", cfg.Db.Timeout)
+	fmt.Printf("DB_MAX_LIMIT - %d\n", cfg.Db.MaxLimit)
+	fmt.Printf("DB_TIMEOUT - %d\n", cfg.Db.Timeout)
+	fmt.Printf("DB_SOFT_DELETE_RETENTION - %d\n", cfg.Db.SoftDeleteRetention)
+	fmt.Printf("DB_INSERT_BATCH_SIZE - %d\n\n", cfg.Db.InsertBatchSize)
+
+	fmt.Printf("WEBHOOK_ENABLED - %t\n", cfg.Webhook.Enabled)
+	fmt.Printf("WEBHOOK_POLL_INTERVAL - %d\n", cfg.Webhook.PollInterval)
+	fmt.Printf("WEBHOOK_BATCH_SIZE - %d\n", cfg.Webhook.BatchSize)
+	fmt.Printf("WEBHOOK_TIMEOUT - %d\n", cfg.Webhook.Timeout)
+	fmt.Printf("WEBHOOK_MAX_ATTEMPTS - %d\n", cfg.Webhook.MaxAttempts)
+	fmt.Printf("WEBHOOK_BACKOFF_BASE - %d\n", cfg.Webhook.BackoffBase)
+	fmt.Printf("WEBHOOK_BACKOFF_MAX - %d\n", cfg.Webhook.BackoffMax)
+	fmt.Printf("WEBHOOK_ALLOW_PRIVATE - %t\n", cfg.Webhook.AllowPrivate)
+	fmt.Printf("WEBHOOK_RETENTION - %d\n\n", cfg.Webhook.Retention)
+
+	fmt.Printf("STREAM_BUFFER_SIZE - %d\n", cfg.Stream.BufferSize)
+	fmt.Printf("STREAM_HEARTBEAT - %d\n\n", cfg.Stream.Heartbeat)
+
+	fmt.Printf("LOG_LEVEL - %s\n", cfg.Log.Level)
+	fmt.Printf("LOG_ACCESS_LOG - %t\n\n", cfg.Log.AccessLog)
+}
+
+// Validate reports every setting the app can't run with, cleanenv only checks the types
+func (cfg Config) Validate() error {
+	var errs []error
+
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(oneOf(cfg.App.Profile, "dev", "test", "prod"), "APP_PROFILE must be dev, test or prod, got %q", cfg.App.Profile)
+	check(isPort(cfg.App.Port), "APP_PORT must be a port number, got %q", cfg.App.Port)
+	check(cfg.App.ShutdownTimeout > 0, "APP_SHUTDOWN_TIMEOUT must be positive")
+	check(cfg.App.IdempotencyTtl > 0, "APP_IDEMPOTENCY_TTL must be positive")
+	check(cfg.App.IdempotencyWait >= 0, "APP_IDEMPOTENCY_WAIT must not be negative")
+	check(cfg.App.IdempotencyLease > 0, "APP_IDEMPOTENCY_LEASE must be positive")
+
+	check(!cfg.Grpc.Enabled || isPort(cfg.Grpc.Port), "GRPC_PORT must be a port number, got %q", cfg.Grpc.Port)
+	check(!cfg.Grpc.Enabled || cfg.Grpc.Port != cfg.App.Port || cfg.App.Port == "0", "GRPC_PORT must differ from APP_PORT")
+
+	check(!cfg.Security.CorsEnabled || strings.TrimSpace(cfg.Security.CorsAllowOrigins) != "", "SECURITY_CORS_ALLOW_ORIGINS is required when cors is enabled")
+	for _, proxy := range cfg.Security.TrustedProxyList() {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "SECURITY_TRUSTED_PROXIES must list ips or cidrs, got %q", proxy)
+	}
+	if cfg.Security.RateLimitEnabled {
+		check(cfg.Security.RateLimitRate > 0, "SECURITY_RATE_LIMIT_RATE must be positive")
+		check(cfg.Security.RateLimitBurst > 0, "SECURITY_RATE_LIMIT_BURST must be positive")
+		_, routesErr := cfg.Security.RateLimitOverrides()
+		check(routesErr == nil, "SECURITY_RATE_LIMIT_ROUTES: %v", routesErr)
+	}
+	if cfg.Security.ApiKeyEnabled {
+		check(cfg.Security.AuthFailureRate > 0, "SECURITY_AUTH_FAILURE_RATE must be positive")
+		check(cfg.Security.AuthFailureBurst > 0, "SECURITY_AUTH_FAILURE_BURST must be positive")
+	}
+	// the store also holds the auth failure buckets
+	if cfg.Security.RateLimitEnabled || cfg.Security.ApiKeyEnabled {
+		check(oneOf(cfg.Security.RateLimitStore, RateLimitStoreMemory, RateLimitStorePostgres), "SECURITY_RATE_LIMIT_STORE must be memory or postgres, got %q", cfg.Security.RateLimitStore)
+		check(cfg.Security.RateLimitStore != RateLimitStorePostgres || cfg.Db.Driver == DriverPostgres, "SECURITY_RATE_LIMIT_STORE postgres requires DB_DRIVER postgres")
+	}
+
+	check(oneOf(strings.ToLower(cfg.Log.Level), "debug", "info", "warn", "error", "fatal", "panic"), "LOG_LEVEL must be debug, info, warn, error, fatal or panic, got %q", cfg.Log.Level)
+
+	check(oneOf(cfg.Db.Driver, DriverPostgres, DriverMemory), "DB_DRIVER must be postgres or memory, got %q", cfg.Db.Driver)
+	if cfg.Db.Driver == DriverPostgres {
+		check(cfg.Db.Host != "", "DB_HOST is required")
+		check(isPort(cfg.Db.Port), "DB_PORT must be a port number, got %q", cfg.Db.Port)
+		check(cfg.Db.Name != "", "DB_NAME is required")
+		check(cfg.Db.User != "", "DB_USER is required")
+	}
+	check(cfg.Db.Limit > 0, "DB_LIMIT must be positive")
+	check(cfg.Db.MaxLimit == 0 || cfg.Db.MaxLimit >= cfg.Db.Limit, "DB_MAX_LIMIT must not be less than DB_LIMIT")
+	check(cfg.Db.Timeout > 0, "DB_TIMEOUT must be positive")
+	check(cfg.Db.SoftDeleteRetention > 0, "DB_SOFT_DELETE_RETENTION must be positive")
+	check(cfg.Db.InsertBatchSize > 0, "DB_INSERT_BATCH_SIZE must be positive")
+
+	check(cfg.Webhook.Retention > 0, "WEBHOOK_RETENTION must be positive")
+	if cfg.Webhook.Enabled {
+		check(cfg.Webhook.PollInterval > 0, "WEBHOOK_POLL_INTERVAL must be positive")
+		check(cfg.Webhook.BatchSize > 0, "WEBHOOK_BATCH_SIZE must be positive")
+		check(cfg.Webhook.Timeout > 0, "WEBHOOK_TIMEOUT must be positive")
+		check(cfg.Webhook.MaxAttempts > 0, "WEBHOOK_MAX_ATTEMPTS must be positive")
+		check(cfg.Webhook.BackoffBase > 0, "WEBHOOK_BACKOFF_BASE must be positive")
+		check(cfg.Webhook.BackoffMax >= cfg.Webhook.BackoffBase, "WEBHOOK_BACKOFF_MAX must not be less than WEBHOOK_BACKOFF_BASE")
+	}
+
+	check(cfg.Stream.BufferSize > 0, "STREAM_BUFFER_SIZE must be positive")
+	check(cfg.Stream.Heartbeat > 0, "STREAM_HEARTBEAT must be positive")
+
+	return errors.Join(errs...)
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
 
-	fmt.Printf("LOG_LEVEL - %s\n\n", cfg.Log.Level)
+// isPort accepts 0, the os picks a free port then
+func isPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port >= 0 && port <= 65535
 }
 
 func (c Db) GetDsn() string {
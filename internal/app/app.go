@@ -2,12 +2,24 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"gravitum-test-app/config"
+	"gravitum-test-app/internal/grpcserver"
 	"gravitum-test-app/internal/handler"
+	"gravitum-test-app/internal/handler/problem"
+	"gravitum-test-app/internal/health"
+	"gravitum-test-app/internal/metrics"
+	"gravitum-test-app/internal/migration"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/internal/repository/instrumented"
+	"gravitum-test-app/internal/repository/memory"
+	memoryratelimit "gravitum-test-app/internal/repository/memory/ratelimit"
 	"gravitum-test-app/internal/repository/postgres"
 	"gravitum-test-app/internal/service"
 	"gravitum-test-app/pkg/logger"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -16,13 +28,34 @@ import (
 	"github.com/gin-contrib/secure"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"google.golang.org/grpc"
 )
 
+var ErrShutdownTimeout = errors.New("err.app.shutdown_timeout")
+
+const idempotencyCleanupInterval = time.Hour
+
+const webhookCleanupInterval = time.Hour
+
+// rateLimitCleanupInterval is short, a bucket refills within seconds and every client ip has one
+const rateLimitCleanupInterval = time.Minute
+
+// streamRetryInterval is the pause before listening for user events again after a failure
+const streamRetryInterval = time.Second
+
 type App struct {
-	cfg    *config.Config
-	log    *logger.Logger
-	Db     *pgxpool.Pool
-	Server *http.Server
+	cfg      *config.Config
+	log      *logger.Logger
+	Db       *pgxpool.Pool
+	Server   *http.Server
+	Grpc     *grpc.Server // nil when grpc.enabled is off
+	Health   *health.Checker
+	router   *gin.Engine
+	stream   service.StreamService
+	services *service.Service
+	addr     net.Addr
+	grpcAddr net.Addr
+	started  chan struct{}
 }
 
 func New(
@@ -30,31 +63,94 @@ func New(
 	log *logger.Logger,
 ) *App {
 	return &App{
-		cfg: cfg,
-		log: log,
+		cfg:     cfg,
+		log:     log,
+		Health:  health.New(),
+		started: make(chan struct{}),
 	}
 }
 
+// Run serves http until ctx is cancelled, then shuts down gracefully:
+// readiness goes false, the listener stops accepting, in-flight requests are drained
+// up to app.shutdownTimeout and only then the db pool is closed.
+// ErrShutdownTimeout is returned when requests didn't finish in time.
 func (app *App) Run(ctx context.Context) error {
+	err := app.build(ctx)
+	if err != nil {
+		return err
+	}
 
-	err := app.ConnectDB(ctx, app.cfg.GetDbConfig().GetDsn())
+	return app.serve(ctx)
+}
+
+// Started is closed once the listener accepts connections
+func (app *App) Started() <-chan struct{} {
+	return app.started
+}
+
+// Addr is the bound listener address, useful with port 0, valid after Started
+func (app *App) Addr() net.Addr {
+	return app.addr
+}
+
+// GrpcAddr is the bound grpc listener address, nil when grpc is disabled, valid after Started
+func (app *App) GrpcAddr() net.Addr {
+	return app.grpcAddr
+}
+
+func (app *App) build(ctx context.Context) error {
+	repo, err := app.newRepository(ctx)
 	if err != nil {
-		app.log.Error(fmt.Sprintf("couldn't instantiate db: %s", err))
 		return err
 	}
-	defer app.Db.Close()
 
-	repo := postgres.NewRepository(app.cfg, app.Db)
+	repo.User = instrumented.NewUserRepository(repo.User, app.log)
+
+	// buckets are shared through postgres only on request, a write per api call is not free
+	if app.cfg.Security.RateLimitStore != config.RateLimitStorePostgres {
+		repo.RateLimit = memoryratelimit.NewRepository(app.cfg)
+	}
 
 	service := service.NewService(
 		app.cfg,
 		repo,
 	)
 
-	handler := handler.NewHandler(app.cfg, service, app.log)
+	go app.deleteExpiredIdempotencyKeys(ctx, service.Idempotency)
+
+	// the store also holds the auth failure buckets
+	if app.cfg.Security.RateLimitEnabled || app.cfg.Security.ApiKeyEnabled {
+		go app.deleteExpiredRateLimits(ctx, service.RateLimit)
+	}
+
+	if app.cfg.Webhook.Enabled {
+		go app.dispatchWebhooks(ctx, service.Webhook)
+	}
+
+	go app.deleteExpiredWebhookEvents(ctx, service.Webhook)
+	go app.listenUserEvents(ctx, service.Stream)
+	app.stream = service.Stream
+	app.services = service
+
+	if app.cfg.Grpc.Enabled {
+		app.Grpc = grpcserver.New(app.cfg, service, app.log)
+	}
+
+	handler := handler.NewHandler(app.cfg, service, app.Health, app.log)
 
 	r := gin.New()
-	r.Use(gin.Recovery()) // recovery middleware
+
+	// gin trusts every proxy by default, anyone could pick the client ip with X-Forwarded-For
+	err = r.SetTrustedProxies(app.cfg.Security.TrustedProxyList())
+	if err != nil {
+		app.closeDB()
+		return err
+	}
+
+	r.Use(handler.Middleware.Recovery()) // recovery middleware
+	r.Use(handler.Middleware.RequestId())
+	r.Use(handler.Middleware.AccessLog())
+	r.Use(handler.Middleware.Metrics())
 	r.Use(secure.New(secure.Config{
 		BrowserXssFilter:   true,
 		ContentTypeNosniff: true,
@@ -62,12 +158,280 @@ func (app *App) Run(ctx context.Context) error {
 	}))
 	app.setupRouter(r, handler)
 
+	app.router = r
 	app.Server = &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", app.cfg.App.Host, app.cfg.App.Port),
 		Handler: r,
 	}
 
-	return app.Server.ListenAndServe()
+	return nil
+}
+
+func (app *App) serve(ctx context.Context) error {
+	ln, err := net.Listen("tcp", app.Server.Addr)
+	if err != nil {
+		app.closeDB()
+		return err
+	}
+
+	app.addr = ln.Addr()
+	app.log.Infof("listening on %s", app.addr)
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- app.Server.Serve(ln)
+	}()
+
+	if app.Grpc != nil {
+		grpcLn, err := net.Listen("tcp", fmt.Sprintf("%s:%s", app.cfg.App.Host, app.cfg.Grpc.Port))
+		if err != nil {
+			_ = app.Server.Close()
+			app.closeDB()
+			return err
+		}
+
+		app.grpcAddr = grpcLn.Addr()
+		app.log.Infof("grpc listening on %s", app.grpcAddr)
+
+		go func() {
+			serveErr <- app.Grpc.Serve(grpcLn)
+		}()
+	}
+	close(app.started)
+
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		if app.Grpc != nil {
+			app.Grpc.Stop()
+		}
+		_ = app.Server.Close()
+		app.closeDB()
+		return err
+	case <-ctx.Done():
+	}
+
+	return app.shutdown()
+}
+
+func (app *App) shutdown() error {
+	app.Health.SetShuttingDown()
+	app.log.Info("shutting down, draining in-flight requests")
+
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(app.cfg.App.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	var result error
+
+	// streams never become idle, the servers would wait for them until the timeout
+	app.stream.Close()
+
+	// GracefulStop stops accepting and waits for in-flight calls, both servers drain concurrently
+	var grpcStopped chan struct{}
+	if app.Grpc != nil {
+		grpcStopped = make(chan struct{})
+		go func() {
+			app.Grpc.GracefulStop()
+			close(grpcStopped)
+		}()
+	}
+
+	// Shutdown closes the listener first, then waits for active connections to become idle
+	err := app.Server.Shutdown(timeoutCtx)
+	if err != nil {
+		app.log.Errorf("http server shutdown: %s", err)
+		result = errors.Join(ErrShutdownTimeout, err)
+
+		// connections still active after the deadline are dropped
+		err = app.Server.Close()
+		if err != nil {
+			app.log.Errorf("http server close: %s", err)
+		}
+	}
+
+	if grpcStopped != nil {
+		select {
+		case <-grpcStopped:
+		case <-timeoutCtx.Done():
+			app.log.Error("grpc server shutdown: calls still running after the timeout")
+			if result == nil {
+				result = ErrShutdownTimeout
+			}
+
+			// calls still running after the deadline are cancelled
+			app.Grpc.Stop()
+		}
+	}
+
+	app.closeDB()
+	app.log.Info("shutdown complete")
+
+	return result
+}
+
+// deleteExpiredIdempotencyKeys runs until ctx is cancelled, expired keys are already ignored
+// on reuse, this only keeps the table small
+func (app *App) deleteExpiredIdempotencyKeys(ctx context.Context, idempotency service.IdempotencyService) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := idempotency.DeleteExpired(ctx)
+			if err != nil {
+				app.log.Errorf("delete expired idempotency keys: %s", err)
+				continue
+			}
+			app.log.Debugf("expired idempotency keys deleted, count=%d", deleted)
+		}
+	}
+}
+
+// deleteExpiredWebhookEvents trims the outbox and the deliveries until ctx is cancelled,
+// every user write adds an event even without webhooks
+func (app *App) deleteExpiredWebhookEvents(ctx context.Context, webhook service.WebhookService) {
+	ticker := time.NewTicker(webhookCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			events, deliveries, err := webhook.DeleteExpired(ctx)
+			if err != nil {
+				app.log.Errorf("delete expired webhook events: %s", err)
+				continue
+			}
+			app.log.Debugf("expired webhook events deleted, events=%d, deliveries=%d", events, deliveries)
+		}
+	}
+}
+
+// deleteExpiredRateLimits forgets full buckets until ctx is cancelled, so clients seen once
+// don't stay in memory or in the table
+func (app *App) deleteExpiredRateLimits(ctx context.Context, rateLimit service.RateLimitService) {
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := rateLimit.DeleteExpired(ctx)
+			if err != nil {
+				app.log.Errorf("delete expired rate limits: %s", err)
+				continue
+			}
+			app.log.Debugf("expired rate limits deleted, count=%d", deleted)
+		}
+	}
+}
+
+// dispatchWebhooks delivers outbox events every webhook.pollInterval until ctx is cancelled
+func (app *App) dispatchWebhooks(ctx context.Context, webhook service.WebhookService) {
+	interval := time.Duration(app.cfg.Webhook.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sent, err := webhook.Dispatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				app.log.Errorf("dispatch webhooks: %s", err)
+			}
+			if sent > 0 {
+				app.log.Debugf("webhook deliveries attempted, count=%d", sent)
+			}
+		}
+	}
+}
+
+// listenUserEvents feeds the user event stream until ctx is cancelled, listening again after failures
+func (app *App) listenUserEvents(ctx context.Context, stream service.StreamService) {
+	for {
+		err := stream.Listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		app.log.Errorf("listen user events: %s", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(streamRetryInterval):
+		}
+	}
+}
+
+func (app *App) closeDB() {
+	if app.Db == nil {
+		return
+	}
+
+	metrics.ObservePool(nil)
+	app.Db.Close()
+}
+
+func (app *App) newRepository(ctx context.Context) (*repository.Repository, error) {
+	switch app.cfg.Db.Driver {
+	case config.DriverMemory:
+		app.log.Warn("db driver is memory, data will be lost on shutdown")
+		return memory.NewRepository(app.cfg), nil
+	case config.DriverPostgres, "":
+	default:
+		return nil, fmt.Errorf("unknown db driver: %s", app.cfg.Db.Driver)
+	}
+
+	err := app.ConnectDB(ctx, app.cfg.GetDbConfig().GetDsn())
+	if err != nil {
+		app.log.Error(fmt.Sprintf("couldn't instantiate db: %s", err))
+		return nil, err
+	}
+
+	migrator, err := migration.New(app.Db, app.log)
+	if err != nil {
+		app.Db.Close()
+		return nil, err
+	}
+
+	if app.cfg.App.AutoMigrate {
+		err = migrator.Up(ctx)
+		if err != nil {
+			app.log.Error(fmt.Sprintf("couldn't apply migrations: %s", err))
+			app.Db.Close()
+			return nil, err
+		}
+	}
+
+	app.Health.Add("db", func(ctx context.Context) error {
+		return app.Db.Ping(ctx)
+	})
+	app.Health.Add("migrations", func(ctx context.Context) error {
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if version != migrator.Latest() {
+			return fmt.Errorf("%w: applied %d, latest %d", model.ErrHealthMigrationsOutdated, version, migrator.Latest())
+		}
+		return nil
+	})
+
+	return postgres.NewRepository(app.cfg, app.Db), nil
 }
 
 func (app *App) ConnectDB(ctx context.Context, dsn string) error {
@@ -76,8 +440,14 @@ func (app *App) ConnectDB(ctx context.Context, dsn string) error {
 		return err
 	}
 
-	dbpool.Ping(ctx)
+	err = dbpool.Ping(ctx)
+	if err != nil {
+		dbpool.Close()
+		return err
+	}
+
 	app.Db = dbpool
+	metrics.ObservePool(dbpool)
 	return nil
 }
 
@@ -91,9 +461,9 @@ func (app *App) setupRouter(r *gin.Engine, h *handler.Handler) {
 			if len(allowOrigins) > 0 {
 				corsMiddleware := cors.New(cors.Config{
 					AllowOrigins:     allowOrigins,
-					AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-					AllowHeaders:     []string{"Origin", "Content-Type", "Content-Language", "Accept", "Authorization", "X-API-SECRET-KEY"},
-					ExposeHeaders:    []string{"Content-Length", "Authorization"},
+					AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+					AllowHeaders:     []string{"Origin", "Content-Type", "Content-Language", "Accept", "Authorization", "X-API-SECRET-KEY", "X-Request-ID", "If-Match", "If-None-Match", "Idempotency-Key"},
+					ExposeHeaders:    []string{"Content-Length", "Authorization", "X-Request-ID", "ETag", "Location", "Content-Disposition", "Idempotent-Replayed", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 					AllowCredentials: true,
 					MaxAge:           12 * time.Hour,
 				})
@@ -103,8 +473,8 @@ func (app *App) setupRouter(r *gin.Engine, h *handler.Handler) {
 				// Add OPTIONS handler to users group for preflight requests
 				api.OPTIONS("/*path", func(c *gin.Context) {
 					c.Header("Access-Control-Allow-Origin", c.Request.Header.Get("Origin"))
-					c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-					c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-SECRET-KEY, Content-Language")
+					c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+					c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-SECRET-KEY, Content-Language, X-Request-ID, If-Match, If-None-Match, Idempotency-Key")
 					c.Header("Access-Control-Allow-Credentials", "true")
 					c.Status(204) // No Content
 				})
@@ -112,13 +482,62 @@ func (app *App) setupRouter(r *gin.Engine, h *handler.Handler) {
 		}
 	}
 
+	if app.cfg.Security.ApiKeyEnabled {
+		api.Use(h.Middleware.ApiKey())
+	}
+
+	// after the api key, so callers are limited by key and not by the ip they share
+	if app.cfg.Security.RateLimitEnabled {
+		api.Use(h.Middleware.RateLimit())
+	}
+
+	read := h.Middleware.RequireScope(model.ScopeUsersRead)
+	write := h.Middleware.RequireScope(model.ScopeUsersWrite)
+	idempotent := h.Middleware.Idempotency()
+
 	users := api.Group("/users")
 
 	// user routes
-	users.GET("/", h.User.GetList)   // api - get user list
-	users.GET("/:id", h.User.Get)    // api - get user
-	users.POST("/", h.User.Create)   // api - create user
-	users.PUT("/:id", h.User.Update) // api - update user method
+	users.GET("/", read, h.User.GetList)              // api - get user list
+	users.GET("/export", read, h.User.Export)         // api - stream users as csv, ndjson or xlsx
+	users.GET("/search", read, h.User.Search)         // api - full-text and fuzzy search
+	users.GET("/stream", read, h.Stream.Users)        // api - user events as server-sent events
+	users.GET("/:id", read, h.User.Get)               // api - get user
+	users.GET("/:id/history", read, h.Audit.History)  // api - audit log of the user, kept after purge
+	users.POST("/", write, idempotent, h.User.Create) // api - create user, retries with Idempotency-Key are safe
+	users.PUT("/:id", write, h.User.Update)           // api - update user method
+	users.PATCH("/:id", write, h.User.Patch)          // api - partial update, merge patch or json patch
+	users.DELETE("/:id", write, h.User.Delete)        // api - soft delete user
+	users.POST("/:id/restore", write, h.User.Restore) // api - restore soft deleted user
+	users.POST("/import", write, h.User.Import)       // api - bulk create from csv or ndjson
+
+	admin := api.Group("/admin", h.Middleware.RequireScope(model.ScopeAdmin))
+
+	// admin routes
+	admin.POST("/users/purge", h.User.Purge)                       // api - hard delete users soft deleted longer than retention
+	admin.GET("/webhooks", h.Webhook.GetList)                      // api - list webhook subscriptions
+	admin.POST("/webhooks", h.Webhook.Create)                      // api - register a webhook, responds with its signing secret
+	admin.DELETE("/webhooks/:id", h.Webhook.Delete)                // api - unsubscribe, pending deliveries are dropped
+	admin.GET("/webhooks/:id/deliveries", h.Webhook.GetDeliveries) // api - delivery log, ?status=dead lists dead letters
+	admin.POST("/webhooks/:id/test", h.Webhook.Test)               // api - send a webhook.test event now
+	admin.POST("/webhooks/:id/replay", h.Webhook.Replay)           // api - queue dead deliveries again
+
+	api.GET("/audit", h.Middleware.RequireScope(model.ScopeAdmin), h.Audit.GetList) // api - audit log of all user writes
+
+	// probes, outside of /api so they never require an api key
+	r.GET("/healthz", h.Health.Liveness) // process is alive
+	r.GET("/readyz", h.Health.Readiness) // ready to serve traffic
+	r.GET("/health", h.Health.Health)    // detailed report with per check latency
+
+	r.GET("/metrics", gin.WrapH(metrics.Registry.Handler())) // prometheus text format
+
+	// docs, outside of the api group so browsing them needs no api key
+	r.GET("/api/openapi.json", h.Docs.Spec) // OpenAPI 3.1 document of these routes
+	r.GET("/api/docs", h.Docs.Explorer)     // explorer page of the document
+
+	r.NoRoute(func(c *gin.Context) {
+		problem.Abort(c, app.cfg, app.log, model.ErrRequestRouteNotFound)
+	})
 
 	// Public API root
 	r.GET("/api", func(c *gin.Context) { // api - root(it works)
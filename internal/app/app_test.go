@@ -0,0 +1,548 @@
+package app
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	userv1 "gravitum-test-app/api/user/v1"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/handler/middleware"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/logger"
+	"gravitum-test-app/pkg/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestApp(t *testing.T, shutdownTimeout int) *App {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.App.Host = "127.0.0.1"
+	cfg.App.Port = "0"
+	cfg.App.ShutdownTimeout = shutdownTimeout
+	cfg.Db.Driver = config.DriverMemory
+	cfg.Db.Limit = 20
+
+	a := New(cfg, logger.New(logger.GetLevelByString("error")))
+	err := a.build(context.Background())
+	require.NoError(t, err)
+
+	return a
+}
+
+type result struct {
+	status int
+	body   string
+	err    error
+}
+
+func get(url string) <-chan result {
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			ch <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		ch <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+	return ch
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	a := newTestApp(t, 5)
+
+	entered := make(chan struct{})
+	a.router.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		time.Sleep(300 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.serve(ctx)
+	}()
+	<-a.Started()
+
+	base := fmt.Sprintf("http://%s", a.Addr())
+	slow := get(base + "/slow")
+	<-entered
+
+	cancel()
+
+	r := <-slow
+	require.NoError(t, r.err)
+	assert.Equal(t, http.StatusOK, r.status)
+	assert.Equal(t, "done", r.body, "in-flight request must complete during shutdown")
+
+	select {
+	case err := <-runErr:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after shutdown")
+	}
+
+	assert.True(t, a.Health.IsShuttingDown(), "readiness must be off after shutdown")
+
+	_, err := http.Get(base + "/healthz")
+	assert.Error(t, err, "listener must be closed after shutdown")
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	a := newTestApp(t, 1)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	a.router.GET("/stuck", func(c *gin.Context) {
+		close(entered)
+		select {
+		case <-release:
+		case <-c.Request.Context().Done():
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.serve(ctx)
+	}()
+	<-a.Started()
+
+	get(fmt.Sprintf("http://%s/stuck", a.Addr()))
+	<-entered
+
+	cancel()
+
+	select {
+	case err := <-runErr:
+		assert.ErrorIs(t, err, ErrShutdownTimeout)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after shutdown timeout")
+	}
+}
+
+func TestExport(t *testing.T) {
+	a := newTestApp(t, 5)
+
+	for _, body := range []string{`{"name":"Ann","surname":"Lee"}`, `{"name":"Bob"}`, `{"name":"Cid, the third"}`} {
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users/", strings.NewReader(body)))
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	export := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/export"+query, nil))
+		return w
+	}
+
+	w := export("?sort=name&order=desc&has_surname=false")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="users-\d{8}T\d{6}Z\.csv"$`, w.Header().Get("Content-Disposition"))
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3, "header and users without surname")
+	assert.Equal(t, []string{"id", "name", "surname", "inserted_at", "updated_at", "deleted_at", "version"}, records[0])
+	assert.Equal(t, []string{"3", "Cid, the third", ""}, records[1][:3], "filters and sorting of the list apply")
+	assert.Equal(t, "Bob", records[2][1])
+
+	w = export("?format=ndjson&limit=1")
+	require.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 3, "pagination is ignored")
+	assert.Contains(t, lines[0], `"name":"Ann","surname":"Lee"`)
+
+	w = export("?format=xlsx")
+	require.Equal(t, http.StatusOK, w.Code)
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	assert.Len(t, archive.File, 6)
+
+	w = export("?format=xml")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+}
+
+func TestListInvalidOrder(t *testing.T) {
+	a := newTestApp(t, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/?order=sideways", nil)
+	req.Header.Set("Accept", model.ProblemContentType)
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var problem model.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, model.ErrRequestInvalidSortOrder.Error(), problem.Code)
+	assert.Equal(t, []model.InvalidParam{{Name: "order", Reason: "must be one of asc, desc"}}, problem.InvalidParams)
+}
+
+// authenticated returns a caller of the app router sending a new api key with scopes
+func authenticated(t *testing.T, a *App, scopes ...string) func(method string, path string, body string) *httptest.ResponseRecorder {
+	_, secret, err := a.services.ApiKey.Create(context.Background(), "test", scopes, nil)
+	require.NoError(t, err)
+
+	return func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(middleware.ApiKeyHeader, secret)
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, req)
+		return w
+	}
+}
+
+func TestAdminRequiresApiKeys(t *testing.T) {
+	a := newTestApp(t, 1)
+
+	for _, path := range []string{"/api/admin/webhooks", "/api/audit"} {
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+		assert.Contains(t, w.Body.String(), "err.security.api-key-required", path)
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "user routes stay open without api keys")
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+
+	deliveries := make(chan received, 10)
+	var fail atomic.Bool
+	fail.Store(true)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook.EventHeader) != model.EventWebhookTest && fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		deliveries <- received{header: r.Header.Clone(), body: body}
+	}))
+	defer receiver.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Db.Driver = config.DriverMemory
+	cfg.Db.Limit = 20
+	cfg.Webhook.Enabled = true
+	cfg.Webhook.PollInterval = 1
+	cfg.Webhook.MaxAttempts = 1
+	cfg.Webhook.AllowPrivate = true   // the receiver listens on loopback
+	cfg.Security.ApiKeyEnabled = true // admin routes are refused without api keys
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := New(cfg, logger.New(logger.GetLevelByString("error")))
+	require.NoError(t, a.build(ctx))
+
+	call := authenticated(t, a, model.ScopeAll)
+
+	w := call(http.MethodPost, "/api/admin/webhooks", `{"url":"`+receiver.URL+`","event_types":["user.created"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var registered struct {
+		Data model.Webhook `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &registered))
+	secret := registered.Data.Secret
+	require.NotEmpty(t, secret, "secret must be returned on create")
+
+	w = call(http.MethodGet, "/api/admin/webhooks", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), secret, "list must not expose secrets")
+
+	w = call(http.MethodPost, "/api/admin/webhooks", `{"url":"ftp://example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call(http.MethodPost, "/api/admin/webhooks", `{"url":"http://example.com","event_types":["user.renamed"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// test event is sent synchronously
+	path := fmt.Sprintf("/api/admin/webhooks/%d", registered.Data.Id)
+	w = call(http.MethodPost, path+"/test", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status_code":200`)
+	test := <-deliveries
+	assert.Equal(t, model.EventWebhookTest, test.header.Get(webhook.EventHeader))
+
+	verify := func(d received) {
+		err := webhook.Verify(secret, d.header.Get(webhook.TimestampHeader), d.header.Get(webhook.SignatureHeader), d.body, time.Minute)
+		assert.NoError(t, err, "signature must verify")
+	}
+	verify(test)
+
+	// the only attempt fails, the delivery is dead
+	w = call(http.MethodPost, "/api/users/", `{"name":"Ann"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = call(http.MethodPut, "/api/users/1", `{"name":"Bob"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Eventually(t, func() bool {
+		w := call(http.MethodGet, path+"/deliveries?status=dead", "")
+		return strings.Contains(w.Body.String(), `"type":"user.created"`)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	w = call(http.MethodGet, path+"/deliveries", "")
+	assert.NotContains(t, w.Body.String(), "user.updated", "only subscribed events must be delivered")
+	assert.Contains(t, w.Body.String(), `"last_status_code":500`)
+
+	// replay once the receiver is back
+	fail.Store(false)
+	w = call(http.MethodPost, path+"/replay", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"replayed":1`)
+
+	select {
+	case d := <-deliveries:
+		verify(d)
+		assert.Equal(t, model.EventUserCreated, d.header.Get(webhook.EventHeader))
+		assert.NotEmpty(t, d.header.Get(webhook.IdHeader))
+
+		var event model.Event
+		require.NoError(t, json.Unmarshal(d.body, &event))
+		assert.Equal(t, model.EventUserCreated, event.Type)
+		assert.Contains(t, string(event.Data), `"name":"Ann"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("replayed delivery was not sent")
+	}
+
+	w = call(http.MethodDelete, path, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	w = call(http.MethodPost, path+"/replay", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestWebhookPrivateDestination(t *testing.T) {
+	var received atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer receiver.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Db.Driver = config.DriverMemory
+	cfg.Db.Limit = 20
+	cfg.Security.ApiKeyEnabled = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := New(cfg, logger.New(logger.GetLevelByString("error")))
+	require.NoError(t, a.build(ctx))
+
+	call := authenticated(t, a, model.ScopeAdmin)
+
+	for _, url := range []string{
+		receiver.URL,
+		"http://localhost:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		w := call(http.MethodPost, "/api/admin/webhooks", `{"url":"`+url+`"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+		assert.Contains(t, w.Body.String(), "err.webhook.forbidden_destination", url)
+	}
+
+	// registered while allowed, like a host whose dns record was changed afterwards
+	cfg.Webhook.AllowPrivate = true
+	w := call(http.MethodPost, "/api/admin/webhooks", `{"url":"`+receiver.URL+`"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	cfg.Webhook.AllowPrivate = false
+
+	w = call(http.MethodPost, "/api/admin/webhooks/1/test", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "err.webhook.forbidden_destination", "the dialer must refuse the address")
+	assert.Zero(t, received.Load())
+}
+
+func TestUserStream(t *testing.T) {
+	a := newTestApp(t, 5)
+	a.cfg.Stream.Heartbeat = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.serve(ctx)
+	}()
+	<-a.Started()
+
+	base := "http://" + a.Addr().String()
+
+	// open reads the stream up to the retry field, the subscription exists by then
+	open := func(lastEventId string) (*http.Response, *bufio.Reader) {
+		req, err := http.NewRequest(http.MethodGet, base+"/api/users/stream", nil)
+		require.NoError(t, err)
+		if lastEventId != "" {
+			req.Header.Set("Last-Event-ID", lastEventId)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "retry: 3000\n", line)
+		_, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		return resp, reader
+	}
+
+	// next returns the fields of the next event, a heartbeat is returned as a comment
+	next := func(reader *bufio.Reader) map[string]string {
+		fields := map[string]string{}
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				if len(fields) == 0 {
+					continue
+				}
+				return fields
+			}
+			name, value, _ := strings.Cut(line, ":")
+			fields[name] = strings.TrimPrefix(value, " ")
+		}
+	}
+
+	create := func(name string) {
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users/", strings.NewReader(`{"name":"`+name+`"}`)))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	resp, reader := open("")
+	create("Ada")
+	first := next(reader)
+	assert.Equal(t, model.EventUserCreated, first["event"])
+	assert.NotEmpty(t, first["id"])
+
+	var event model.Event
+	require.NoError(t, json.Unmarshal([]byte(first["data"]), &event))
+	assert.Equal(t, first["id"], fmt.Sprint(event.Id))
+	assert.Contains(t, string(event.Data), `"Ada"`)
+	resp.Body.Close()
+
+	// events committed while disconnected are replayed after the last seen id
+	create("Grace")
+	resp, reader = open(first["id"])
+	replayed := next(reader)
+	assert.Equal(t, model.EventUserCreated, replayed["event"])
+	assert.Contains(t, replayed["data"], `"Grace"`)
+	resp.Body.Close()
+
+	// an id out of the buffer asks the client to reload, idle streams get heartbeats
+	resp, reader = open("999")
+	assert.Equal(t, "reset", next(reader)["event"])
+	assert.Equal(t, "heartbeat", next(reader)[""], "heartbeat comment expected")
+
+	// open streams don't hold the shutdown
+	cancel()
+	select {
+	case err := <-runErr:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("shutdown waited for the open stream")
+	}
+	resp.Body.Close()
+}
+
+func TestGrpcServedAlongsideHttp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.App.Host = "127.0.0.1"
+	cfg.App.Port = "0"
+	cfg.App.ShutdownTimeout = 5
+	cfg.Grpc.Enabled = true
+	cfg.Grpc.Port = "0"
+	cfg.Db.Driver = config.DriverMemory
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := New(cfg, logger.New(logger.GetLevelByString("error")))
+	require.NoError(t, a.build(ctx))
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.serve(ctx)
+	}()
+	<-a.Started()
+	require.NotNil(t, a.GrpcAddr())
+
+	conn, err := grpc.NewClient(a.GrpcAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := userv1.NewUserServiceClient(conn)
+
+	created, err := client.Create(ctx, &userv1.CreateUserRequest{Name: "Ada"})
+	require.NoError(t, err)
+
+	// written over grpc, read over http
+	resp, err := http.Get(fmt.Sprintf("http://%s/api/users/%d", a.Addr(), created.GetId()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	watch, err := client.Watch(context.Background(), &userv1.WatchUsersRequest{LastEventId: proto.Uint64(0)})
+	require.NoError(t, err)
+	_, err = watch.Recv()
+	require.NoError(t, err)
+
+	// an open watch doesn't hold the shutdown, the client is told to reconnect
+	cancel()
+	select {
+	case err := <-runErr:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("shutdown waited for the open watch")
+	}
+
+	_, err = watch.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"gravitum-test-app/api"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+
+// TestOpenApiCoversRoutes fails when a route is registered without being documented, or the other way around
+func TestOpenApiCoversRoutes(t *testing.T) {
+	a := newTestApp(t, 1)
+
+	var spec struct {
+		OpenApi string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(api.OpenAPI, &spec))
+	assert.Equal(t, "3.1.0", spec.OpenApi)
+
+	documented := map[string]bool{}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	registered := map[string]bool{}
+	for _, route := range a.router.Routes() {
+		if route.Method == http.MethodOptions { // cors preflight
+			continue
+		}
+		registered[route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+
+	var missing, stale []string
+	for route := range registered {
+		if !documented[route] {
+			missing = append(missing, route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			stale = append(stale, route)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+
+	assert.Empty(t, missing, "routes missing from api/openapi.json")
+	assert.Empty(t, stale, "documented routes that are not registered")
+}
+
+func TestOpenApiRefsResolve(t *testing.T) {
+	var spec interface{}
+	require.NoError(t, json.Unmarshal(api.OpenAPI, &spec))
+
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch value := node.(type) {
+		case map[string]interface{}:
+			if ref, ok := value["$ref"].(string); ok {
+				assert.NotNil(t, lookup(spec, ref), "unresolved %s", ref)
+			}
+			for _, child := range value {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range value {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+}
+
+func TestOpenApiServed(t *testing.T) {
+	a := newTestApp(t, 1)
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, api.OpenAPI, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	a.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `fetch("openapi.json")`)
+}
+
+// lookup resolves a local json pointer like #/components/schemas/User
+func lookup(spec interface{}, ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+
+	node := spec
+	for _, name := range strings.Split(ref[2:], "/") {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = object[strings.NewReplacer("~1", "/", "~0", "~").Replace(name)]
+	}
+	return node
+}
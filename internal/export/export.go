@@ -0,0 +1,149 @@
+// Package export encodes users as csv, ndjson or xlsx files, for the export endpoint and the cli
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/xlsx"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Csv    = "csv"
+	Ndjson = "ndjson"
+	Xlsx   = "xlsx"
+)
+
+var Columns = []string{"id", "name", "surname", "inserted_at", "updated_at", "deleted_at", "version"}
+
+// Writer encodes users of an export, Close writes whatever the format needs at the end
+type Writer interface {
+	Write(user *model.User) error
+	Close() error
+}
+
+// ContentType is the media type of format, an unknown format is a param error of the format parameter
+func ContentType(format string) (string, error) {
+	switch format {
+	case Csv:
+		return "text/csv; charset=utf-8", nil
+	case Ndjson:
+		return model.ImportNdjsonContentType, nil
+	case Xlsx:
+		return xlsx.ContentType, nil
+	}
+
+	return "", &model.ParamError{
+		Err:    model.ErrRequestInvalidExportFormat,
+		Params: []model.InvalidParam{{Name: "format", Reason: "must be one of csv, ndjson, xlsx"}},
+	}
+}
+
+// NewWriter writes the header row of formats having one
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case Csv:
+		writer := &csvUserWriter{w: csv.NewWriter(w)}
+		return writer, writer.w.Write(Columns)
+	case Ndjson:
+		return &ndjsonUserWriter{encoder: json.NewEncoder(w)}, nil
+	case Xlsx:
+		sheet, err := xlsx.NewWriter(w, "users")
+		if err != nil {
+			return nil, err
+		}
+
+		header := make([]interface{}, 0, len(Columns))
+		for _, column := range Columns {
+			header = append(header, column)
+		}
+
+		return &xlsxUserWriter{sheet: sheet}, sheet.Write(header...)
+	}
+
+	return nil, errors.New("unknown export format " + format)
+}
+
+// csvUserWriter leaves null cells empty, timestamps are RFC 3339 in UTC
+type csvUserWriter struct {
+	w      *csv.Writer
+	record [7]string
+}
+
+func (w *csvUserWriter) Write(user *model.User) error {
+	w.record = [7]string{
+		strconv.FormatUint(uint64(user.Id), 10),
+		escapeFormula(user.Name),
+		escapeFormula(stringOrEmpty(user.Surname)),
+		formatTime(&user.InsertedAt),
+		formatTime(user.UpdatedAt),
+		formatTime(user.DeletedAt),
+		strconv.FormatUint(uint64(user.Version), 10),
+	}
+
+	return w.w.Write(w.record[:])
+}
+
+func (w *csvUserWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// ndjsonUserWriter writes users exactly as the api returns them
+type ndjsonUserWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonUserWriter) Write(user *model.User) error {
+	return w.encoder.Encode(user)
+}
+
+func (w *ndjsonUserWriter) Close() error {
+	return nil
+}
+
+type xlsxUserWriter struct {
+	sheet *xlsx.Writer
+}
+
+func (w *xlsxUserWriter) Write(user *model.User) error {
+	var surname *string
+	if user.Surname != nil {
+		escaped := escapeFormula(*user.Surname)
+		surname = &escaped
+	}
+
+	return w.sheet.Write(user.Id, escapeFormula(user.Name), surname, user.InsertedAt, user.UpdatedAt, user.DeletedAt, user.Version)
+}
+
+func (w *xlsxUserWriter) Close() error {
+	return w.sheet.Close()
+}
+
+// escapeFormula prefixes text a spreadsheet would run as a formula with a quote, so a name
+// like =HYPERLINK(..) is shown as typed. Ndjson is not opened by spreadsheets and stays exact
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,55 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"gravitum-test-app/internal/model"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, format string, users ...*model.User) []byte {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(format, &buf)
+	require.NoError(t, err)
+	for _, user := range users {
+		require.NoError(t, w.Write(user))
+	}
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestFormulasAreEscaped(t *testing.T) {
+	surname := "@SUM(A1:A9)"
+	users := []*model.User{
+		{Id: 1, Name: `=HYPERLINK("http://evil.example","click")`, Surname: &surname, InsertedAt: time.Now()},
+		{Id: 2, Name: "-1+1", InsertedAt: time.Now()},
+		{Id: 3, Name: "Ada", InsertedAt: time.Now()},
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(write(t, Csv, users...))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, `'=HYPERLINK("http://evil.example","click")`, records[1][1])
+	assert.Equal(t, "'@SUM(A1:A9)", records[1][2])
+	assert.Equal(t, "'-1+1", records[2][1])
+	assert.Equal(t, "Ada", records[3][1], "plain names are kept")
+
+	content := write(t, Xlsx, users...)
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	sheet, err := archive.Open("xl/worksheets/sheet1.xml")
+	require.NoError(t, err)
+	xml, err := io.ReadAll(sheet)
+	require.NoError(t, err)
+	assert.Contains(t, string(xml), `&#39;=HYPERLINK(`)
+	assert.Contains(t, string(xml), `&#39;@SUM(A1:A9)`)
+	assert.NotContains(t, string(xml), `>=HYPERLINK(`)
+}
@@ -0,0 +1,90 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain is the google.rpc.ErrorInfo domain of catalog errors
+const ErrorDomain = "gravitum-test-app"
+
+// Status logs err and converts it to a grpc status, the code follows the catalog http status.
+// Like problem.Abort, only the catalog code and title reach the client, err text stays in the logs
+func Status(ctx context.Context, log *logger.Logger, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return status.FromContextError(err).Err()
+	}
+
+	definition := model.LookupError(err)
+
+	if definition.Status >= http.StatusInternalServerError {
+		log.Ctx(ctx).Errorf("internal server error: %s", err)
+	} else {
+		log.Ctx(ctx).Errorf("%s error: %s", strings.ToLower(http.StatusText(definition.Status)), err)
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: definition.Code, Domain: ErrorDomain}}
+
+	var paramErr *model.ParamError
+	if definition.Status < http.StatusInternalServerError && errors.As(err, &paramErr) {
+		violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(paramErr.Params))
+		for _, param := range paramErr.Params {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       param.Name,
+				Description: param.Reason,
+			})
+		}
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+
+	result := status.New(Code(err), definition.Title)
+	withDetails, detailsErr := result.WithDetails(details...)
+	if detailsErr != nil {
+		return result.Err()
+	}
+
+	return withDetails.Err()
+}
+
+// Code maps err to a grpc code by its catalog entry
+func Code(err error) codes.Code {
+	definition := model.LookupError(err)
+
+	switch {
+	case errors.Is(definition.Err, model.ErrSqlUniqueViolation):
+		return codes.AlreadyExists
+	case errors.Is(definition.Err, model.ErrUserVersionMismatch):
+		return codes.Aborted // a failed test-and-set, read the user and retry
+	}
+
+	switch definition.Status {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusUnprocessableEntity:
+		return codes.NotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,242 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	userv1 "gravitum-test-app/api/user/v1"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// metadata keys, the same names as the http headers
+const (
+	ApiKeyMetadata    = "x-api-secret-key"
+	RequestIdMetadata = "x-request-id"
+)
+
+// incoming ids end up in logs, anything else is replaced by a generated one
+var requestIdRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// methodScopes is the api key scope each method requires, methods missing from it are refused
+var methodScopes = map[string]string{
+	userv1.UserService_Get_FullMethodName:    model.ScopeUsersRead,
+	userv1.UserService_List_FullMethodName:   model.ScopeUsersRead,
+	userv1.UserService_Watch_FullMethodName:  model.ScopeUsersRead,
+	userv1.UserService_Create_FullMethodName: model.ScopeUsersWrite,
+	userv1.UserService_Update_FullMethodName: model.ScopeUsersWrite,
+	userv1.UserService_Delete_FullMethodName: model.ScopeUsersWrite,
+}
+
+type Server struct {
+	cfg      *config.Config
+	services *service.Service
+	log      *logger.Logger
+}
+
+// New builds the grpc server with the user service registered, interceptors mirror the
+// http middleware: request id, recovery, access log and api key auth
+func New(
+	cfg *config.Config,
+	services *service.Service,
+	log *logger.Logger,
+) *grpc.Server {
+	s := &Server{
+		cfg:      cfg,
+		services: services,
+		log:      log,
+	}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+	userv1.RegisterUserServiceServer(server, NewUserServer(cfg, services.User, services.Stream, log))
+
+	return server
+}
+
+func (s *Server) unaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp any, err error) {
+	ctx, err = s.begin(ctx, info.FullMethod)
+	start := time.Now()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = s.status(ctx, fmt.Errorf("panic: %v", recovered))
+		}
+		s.accessLog(ctx, info.FullMethod, start, err)
+	}()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *Server) streamInterceptor(
+	srv any,
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) (err error) {
+	ctx, err := s.begin(stream.Context(), info.FullMethod)
+	start := time.Now()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = s.status(ctx, fmt.Errorf("panic: %v", recovered))
+		}
+		s.accessLog(ctx, info.FullMethod, start, err)
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+}
+
+// begin sets up the request context and authenticates it, the context is valid on error as well
+func (s *Server) begin(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestId := first(md, RequestIdMetadata)
+	if !requestIdRegexp.MatchString(requestId) {
+		requestId = newRequestId()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIdMetadata, requestId))
+
+	ctx = model.WithRequestId(ctx, requestId)
+	ctx = model.WithActor(ctx, model.ActorAnonymous) // replaced by the api key once authenticated
+	ctx = logger.NewContext(ctx, s.log.With("request_id", requestId))
+
+	if !s.cfg.Security.ApiKeyEnabled {
+		return ctx, nil
+	}
+
+	secret := first(md, ApiKeyMetadata)
+	if secret == "" {
+		return ctx, s.status(ctx, model.ErrSecurityUnauthorizedNoHeader)
+	}
+
+	// failed attempts are limited per client ip like on the http api
+	client := "ip:" + peerIp(ctx)
+	allowed, err := s.services.RateLimit.AllowAuth(ctx, client)
+	if err != nil {
+		s.log.Ctx(ctx).Errorf("auth failure limit: %s", err)
+	} else if !allowed.Allowed {
+		return ctx, s.status(ctx, fmt.Errorf("%w, authentication failures, client=%s", model.ErrRateLimitExceeded, client))
+	}
+
+	key, err := s.services.ApiKey.Authenticate(ctx, strings.TrimSpace(secret))
+	if err != nil {
+		if model.LookupError(err).Status == http.StatusUnauthorized {
+			if failErr := s.services.RateLimit.FailAuth(ctx, client); failErr != nil {
+				s.log.Ctx(ctx).Errorf("auth failure limit: %s", failErr)
+			}
+		}
+		return ctx, s.status(ctx, err)
+	}
+
+	err = s.services.ApiKey.TouchLastUsed(ctx, key.Id)
+	if err != nil {
+		s.log.Ctx(ctx).Errorf("api key last use, id=%d: %s", key.Id, err)
+	}
+	ctx = model.WithActor(ctx, model.ApiKeyActor(key.Id))
+
+	scope, ok := methodScopes[method]
+	if !ok || !key.HasScope(scope) {
+		return ctx, s.status(ctx, fmt.Errorf("%w, api key id=%d, method=%s", model.ErrSecurityInsufficientScope, key.Id, method))
+	}
+
+	return ctx, nil
+}
+
+// peerIp is the address of the connection, the grpc port is not behind the trusted proxies
+func peerIp(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func (s *Server) status(ctx context.Context, err error) error {
+	return Status(ctx, s.log, err)
+}
+
+// accessLog writes one line per call, level follows the status code
+func (s *Server) accessLog(ctx context.Context, method string, start time.Time, err error) {
+	if !s.cfg.Log.AccessLog {
+		return
+	}
+
+	code := status.Code(err)
+	fields := map[string]interface{}{
+		"method":     method,
+		"code":       code.String(),
+		"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["client_ip"] = p.Addr.String()
+	}
+
+	log := s.log.Ctx(ctx)
+	switch code {
+	case codes.OK, codes.Canceled:
+		log.InfoFields("rpc", fields)
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		log.ErrorFields("rpc", fields)
+	default:
+		log.WarnFields("rpc", fields)
+	}
+}
+
+// serverStream replaces the context of a stream with the request context
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func first(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
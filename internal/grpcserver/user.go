@@ -0,0 +1,223 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	userv1 "gravitum-test-app/api/user/v1"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserServer implements userv1.UserServiceServer on top of the same services as the http handlers
+type UserServer struct {
+	userv1.UnimplementedUserServiceServer
+	cfg     *config.Config
+	service service.UserService
+	stream  service.StreamService
+	log     *logger.Logger
+}
+
+func NewUserServer(
+	cfg *config.Config,
+	service service.UserService,
+	stream service.StreamService,
+	log *logger.Logger,
+) *UserServer {
+	return &UserServer{
+		cfg:     cfg,
+		service: service,
+		stream:  stream,
+		log:     log,
+	}
+}
+
+func (s *UserServer) Get(ctx context.Context, req *userv1.GetUserRequest) (*userv1.User, error) {
+	result, err := s.service.Get(ctx, uint(req.GetId()), req.GetIncludeDeleted())
+	if err != nil {
+		return nil, Status(ctx, s.log, err)
+	}
+
+	return toUser(result), nil
+}
+
+func (s *UserServer) List(ctx context.Context, req *userv1.ListUsersRequest) (*userv1.ListUsersResponse, error) {
+	params, err := listParams(req)
+	if err != nil {
+		return nil, Status(ctx, s.log, err)
+	}
+
+	list, page, err := s.service.GetList(ctx, params)
+	if err != nil {
+		return nil, Status(ctx, s.log, err)
+	}
+
+	result := &userv1.ListUsersResponse{
+		Users:      make([]*userv1.User, 0, len(list)),
+		Total:      page.Total,
+		Limit:      uint32(page.Limit),
+		Offset:     uint32(page.Offset),
+		NextCursor: page.NextCursor,
+	}
+	for _, user := range list {
+		result.Users = append(result.Users, toUser(user))
+	}
+
+	return result, nil
+}
+
+func (s *UserServer) Create(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.User, error) {
+	name := req.GetName()
+	result, err := s.service.Create(ctx, &name, req.Surname)
+	if err != nil {
+		return nil, Status(ctx, s.log, err)
+	}
+
+	s.log.Ctx(ctx).Debugf("user created, id=%d", result.Id)
+	return toUser(result), nil
+}
+
+func (s *UserServer) Update(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.User, error) {
+	name := req.GetName()
+	result, err := s.service.Update(ctx, uint(req.GetId()), &name, req.Surname, uint(req.GetVersion()))
+	if err != nil {
+		return nil, Status(ctx, s.log, err)
+	}
+
+	s.log.Ctx(ctx).Debugf("user updated, id=%d", result.Id)
+	return toUser(result), nil
+}
+
+func (s *UserServer) Delete(ctx context.Context, req *userv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	err := s.service.Delete(ctx, uint(req.GetId()), uint(req.GetVersion()))
+	if err != nil {
+		return nil, Status(ctx, s.log, err)
+	}
+
+	s.log.Ctx(ctx).Debugf("user deleted, id=%d", req.GetId())
+	return &emptypb.Empty{}, nil
+}
+
+// Watch sends the events of the user stream. The call ends with UNAVAILABLE when the client
+// falls behind or the server shuts down, it should call again with the last event id
+func (s *UserServer) Watch(req *userv1.WatchUsersRequest, stream userv1.UserService_WatchServer) error {
+	ctx := stream.Context()
+
+	var lastEventId *uint
+	if req.LastEventId != nil {
+		id := uint(req.GetLastEventId())
+		lastEventId = &id
+	}
+
+	subscription := s.stream.Subscribe(lastEventId)
+	defer subscription.Close()
+
+	if subscription.Reset {
+		err := stream.Send(&userv1.UserEvent{Type: model.EventReset})
+		if err != nil {
+			return err
+		}
+	}
+	for _, event := range subscription.Replay {
+		err := s.send(stream, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return status.Error(codes.Unavailable, "stream closed, resume with the last event id")
+			}
+			err := s.send(stream, event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *UserServer) send(stream userv1.UserService_WatchServer, event *model.Event) error {
+	var user model.User
+	err := json.Unmarshal(event.Data, &user)
+	if err != nil {
+		return Status(stream.Context(), s.log, err)
+	}
+
+	return stream.Send(&userv1.UserEvent{
+		Id:        uint64(event.Id),
+		Type:      event.Type,
+		User:      toUser(&user),
+		CreatedAt: timestamppb.New(event.CreatedAt),
+	})
+}
+
+func listParams(req *userv1.ListUsersRequest) (model.UserListParams, error) {
+	params := model.UserListParams{
+		Limit:          uint(req.GetLimit()),
+		Offset:         uint(req.GetOffset()),
+		SortBy:         req.GetSort(),
+		SortDesc:       req.GetDesc(),
+		HasSurname:     req.HasSurname,
+		IncludeDeleted: req.GetIncludeDeleted(),
+	}
+
+	if req.GetCursor() != "" {
+		cursor, err := model.DecodeUserCursor(req.GetCursor())
+		if err != nil {
+			return params, &model.ParamError{
+				Err:    err,
+				Params: []model.InvalidParam{{Name: "cursor", Reason: "is malformed"}},
+			}
+		}
+		params.Cursor = cursor
+	}
+
+	if req.NamePrefix != nil {
+		value := strings.TrimSpace(req.GetNamePrefix())
+		if value != "" {
+			params.NamePrefix = &value
+		}
+	}
+
+	if req.InsertedFrom != nil {
+		insertedFrom := req.GetInsertedFrom().AsTime()
+		params.InsertedFrom = &insertedFrom
+	}
+
+	if req.InsertedTo != nil {
+		insertedTo := req.GetInsertedTo().AsTime()
+		params.InsertedTo = &insertedTo
+	}
+
+	return params, nil
+}
+
+func toUser(user *model.User) *userv1.User {
+	result := &userv1.User{
+		Id:         uint32(user.Id),
+		Name:       user.Name,
+		Surname:    user.Surname,
+		InsertedAt: timestamppb.New(user.InsertedAt),
+		Version:    uint32(user.Version),
+	}
+	if user.UpdatedAt != nil {
+		result.UpdatedAt = timestamppb.New(*user.UpdatedAt)
+	}
+	if user.DeletedAt != nil {
+		result.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+
+	return result
+}
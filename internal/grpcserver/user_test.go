@@ -0,0 +1,238 @@
+package grpcserver
+
+import (
+	"context"
+	userv1 "gravitum-test-app/api/user/v1"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository/memory"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestClient serves the grpc api over an in-process listener backed by the memory repository
+func newTestClient(t *testing.T, cfg *config.Config) (userv1.UserServiceClient, *service.Service) {
+	cfg.Db.Driver = config.DriverMemory
+	cfg.Db.Limit = 20
+
+	ctx, cancel := context.WithCancel(context.Background())
+	services := service.NewService(cfg, memory.NewRepository(cfg))
+	go services.Stream.Listen(ctx)
+
+	ln := bufconn.Listen(1 << 20)
+	server := New(cfg, services, logger.New(logger.GetLevelByString("error")))
+	go server.Serve(ln)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		services.Stream.Close()
+		server.Stop()
+		cancel()
+	})
+
+	return userv1.NewUserServiceClient(conn), services
+}
+
+// reason is the catalog code carried by the status of err
+func reason(t *testing.T, err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	t.Fatalf("no error info in %v", err)
+	return ""
+}
+
+func TestUserService(t *testing.T) {
+	client, _ := newTestClient(t, &config.Config{})
+	ctx := context.Background()
+
+	created, err := client.Create(ctx, &userv1.CreateUserRequest{Name: "  Ada ", Surname: proto.String("Lovelace")})
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", created.GetName())
+	assert.Equal(t, "Lovelace", created.GetSurname())
+	assert.EqualValues(t, 1, created.GetVersion())
+
+	_, err = client.Create(ctx, &userv1.CreateUserRequest{Name: " "})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, model.ErrRequestNameRequired.Error(), reason(t, err))
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			assert.Equal(t, "name", badRequest.GetFieldViolations()[0].GetField())
+		}
+	}
+
+	got, err := client.Get(ctx, &userv1.GetUserRequest{Id: created.GetId()})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(created, got))
+
+	_, err = client.Get(ctx, &userv1.GetUserRequest{Id: 999})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, model.ErrNoUserWithSuchId.Error(), reason(t, err))
+
+	updated, err := client.Update(ctx, &userv1.UpdateUserRequest{Id: created.GetId(), Name: "Augusta", Version: created.GetVersion()})
+	require.NoError(t, err)
+	assert.Equal(t, "Augusta", updated.GetName())
+	assert.Nil(t, updated.Surname)
+	assert.NotNil(t, updated.GetUpdatedAt())
+
+	_, err = client.Update(ctx, &userv1.UpdateUserRequest{Id: created.GetId(), Name: "Ada", Version: created.GetVersion()})
+	assert.Equal(t, codes.Aborted, status.Code(err), "stale version")
+
+	_, err = client.Delete(ctx, &userv1.DeleteUserRequest{Id: created.GetId(), Version: updated.GetVersion()})
+	require.NoError(t, err)
+
+	_, err = client.Get(ctx, &userv1.GetUserRequest{Id: created.GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	deleted, err := client.Get(ctx, &userv1.GetUserRequest{Id: created.GetId(), IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.NotNil(t, deleted.GetDeletedAt())
+}
+
+func TestUserServiceList(t *testing.T) {
+	client, _ := newTestClient(t, &config.Config{})
+	ctx := context.Background()
+
+	for _, name := range []string{"Ada", "Alan", "Grace", "Barbara", "Edsger"} {
+		_, err := client.Create(ctx, &userv1.CreateUserRequest{Name: name})
+		require.NoError(t, err)
+	}
+
+	names := []string{}
+	req := &userv1.ListUsersRequest{Limit: 2, Sort: model.UserSortName}
+	for page := 0; ; page++ {
+		require.Less(t, page, 5, "pagination must end")
+
+		resp, err := client.List(ctx, req)
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, resp.GetTotal())
+
+		for _, user := range resp.GetUsers() {
+			names = append(names, user.GetName())
+		}
+		if resp.NextCursor == nil {
+			break
+		}
+		req = &userv1.ListUsersRequest{Limit: 2, Cursor: resp.GetNextCursor()}
+	}
+	assert.Equal(t, []string{"Ada", "Alan", "Barbara", "Edsger", "Grace"}, names)
+
+	resp, err := client.List(ctx, &userv1.ListUsersRequest{NamePrefix: proto.String("a")})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetUsers(), 2)
+
+	_, err = client.List(ctx, &userv1.ListUsersRequest{Sort: "age"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.List(ctx, &userv1.ListUsersRequest{Cursor: "not a cursor"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, model.ErrRequestInvalidCursor.Error(), reason(t, err))
+}
+
+func TestUserServiceWatch(t *testing.T) {
+	client, _ := newTestClient(t, &config.Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// resuming from an unknown id starts with a reset, it also tells the subscription is live
+	watch, err := client.Watch(ctx, &userv1.WatchUsersRequest{LastEventId: proto.Uint64(0)})
+	require.NoError(t, err)
+
+	event, err := watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, model.EventReset, event.GetType())
+	assert.Nil(t, event.GetUser())
+
+	created, err := client.Create(ctx, &userv1.CreateUserRequest{Name: "Ada"})
+	require.NoError(t, err)
+	_, err = client.Delete(ctx, &userv1.DeleteUserRequest{Id: created.GetId()})
+	require.NoError(t, err)
+
+	first, err := watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, model.EventUserCreated, first.GetType())
+	assert.Equal(t, created.GetId(), first.GetUser().GetId())
+
+	second, err := watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, model.EventUserDeleted, second.GetType())
+	assert.NotNil(t, second.GetUser().GetDeletedAt())
+
+	// events after the last one received are replayed
+	resumed, err := client.Watch(ctx, &userv1.WatchUsersRequest{LastEventId: proto.Uint64(first.GetId())})
+	require.NoError(t, err)
+
+	replayed, err := resumed.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, second.GetId(), replayed.GetId())
+}
+
+func TestUserServiceApiKey(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.ApiKeyEnabled = true
+	client, services := newTestClient(t, cfg)
+
+	_, secret, err := services.ApiKey.Create(context.Background(), "reader", []string{model.ScopeUsersRead}, nil)
+	require.NoError(t, err)
+
+	_, err = client.List(context.Background(), &userv1.ListUsersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.List(metadata.AppendToOutgoingContext(context.Background(), ApiKeyMetadata, "invalid"), &userv1.ListUsersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), ApiKeyMetadata, secret)
+
+	var header metadata.MD
+	_, err = client.List(ctx, &userv1.ListUsersRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get(RequestIdMetadata))
+
+	_, err = client.Create(ctx, &userv1.CreateUserRequest{Name: "Ada"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, model.ErrSecurityInsufficientScope.Error(), reason(t, err))
+}
+
+func TestUserServiceAuthFailureLimit(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.ApiKeyEnabled = true
+	cfg.Security.AuthFailureRate = 0.001
+	cfg.Security.AuthFailureBurst = 1
+	client, services := newTestClient(t, cfg)
+
+	_, secret, err := services.ApiKey.Create(context.Background(), "reader", []string{model.ScopeUsersRead}, nil)
+	require.NoError(t, err)
+
+	_, err = client.List(metadata.AppendToOutgoingContext(context.Background(), ApiKeyMetadata, "invalid"), &userv1.ListUsersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.List(metadata.AppendToOutgoingContext(context.Background(), ApiKeyMetadata, secret), &userv1.ListUsersRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "the client ip is out of attempts")
+	assert.Equal(t, model.ErrRateLimitExceeded.Error(), reason(t, err))
+}
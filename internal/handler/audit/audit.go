@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/handler/problem"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	cfg     *config.Config
+	service service.AuditService
+	log     *logger.Logger
+}
+
+func NewHandler(
+	cfg *config.Config,
+	service service.AuditService,
+	log *logger.Logger,
+) *AuditHandler {
+	return &AuditHandler{
+		cfg:     cfg,
+		service: service,
+		log:     log,
+	}
+}
+
+// GetList is the audit log of all users filtered by actor, operation and time range
+func (h *AuditHandler) GetList(c *gin.Context) {
+	params, err := parseListParams(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	result, page, err := h.service.GetList(c.Request.Context(), params)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Debugf("get audit log, total=%d", page.Total)
+	c.JSON(http.StatusOK, model.WrapPageResponse(http.StatusOK, result, page))
+}
+
+// History is the audit log of one user, it accepts the same filters as GetList
+func (h *AuditHandler) History(c *gin.Context) {
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	params, err := parseListParams(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	result, page, err := h.service.History(c.Request.Context(), id, params)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Debugf("get user history, id=%d, total=%d", id, page.Total)
+	c.JSON(http.StatusOK, model.WrapPageResponse(http.StatusOK, result, page))
+}
+
+func parseListParams(c *gin.Context) (model.AuditListParams, error) {
+	var (
+		params model.AuditListParams
+		err    error
+	)
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return params, problem.QueryParamError(err, "limit", "must be a non-negative integer")
+		}
+		params.Limit = uint(limit)
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		params.Cursor, err = model.DecodeAuditCursor(value)
+		if err != nil {
+			return params, problem.QueryParamError(err, "cursor", "is malformed")
+		}
+	}
+
+	if value := strings.TrimSpace(c.Query("actor")); value != "" {
+		params.Actor = &value
+	}
+
+	if value := c.Query("operation"); value != "" {
+		if !model.IsValidAuditOperation(value) {
+			return params, problem.QueryParamError(nil, "operation", "must be one of "+strings.Join(model.AuditOperations, ", "))
+		}
+		params.Operation = &value
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return params, problem.QueryParamError(err, "from", "must be an RFC 3339 timestamp")
+		}
+		params.From = &from
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return params, problem.QueryParamError(err, "to", "must be an RFC 3339 timestamp")
+		}
+		params.To = &to
+	}
+
+	return params, nil
+}
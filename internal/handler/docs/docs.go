@@ -0,0 +1,40 @@
+package docs
+
+import (
+	_ "embed"
+	"gravitum-test-app/api"
+	"gravitum-test-app/config"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// explorer is a self-contained page rendering the document, it loads nothing but the spec
+//
+//go:embed explorer.html
+var explorer []byte
+
+type DocsHandler struct {
+	cfg *config.Config
+	log *logger.Logger
+}
+
+func NewHandler(
+	cfg *config.Config,
+	log *logger.Logger,
+) *DocsHandler {
+	return &DocsHandler{
+		cfg: cfg,
+		log: log,
+	}
+}
+
+// Spec serves the OpenAPI document as is, it is not wrapped in model.Response
+func (h *DocsHandler) Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", api.OpenAPI)
+}
+
+func (h *DocsHandler) Explorer(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", explorer)
+}
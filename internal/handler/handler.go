@@ -2,7 +2,14 @@ package handler
 
 import (
 	"gravitum-test-app/config"
+	"gravitum-test-app/internal/handler/audit"
+	"gravitum-test-app/internal/handler/docs"
+	healthhandler "gravitum-test-app/internal/handler/health"
+	"gravitum-test-app/internal/handler/middleware"
+	"gravitum-test-app/internal/handler/stream"
 	"gravitum-test-app/internal/handler/user"
+	"gravitum-test-app/internal/handler/webhook"
+	"gravitum-test-app/internal/health"
 	"gravitum-test-app/internal/service"
 	"gravitum-test-app/pkg/logger"
 
@@ -12,22 +19,76 @@ import (
 type UserHandler interface {
 	GetList(c *gin.Context)
 	Get(c *gin.Context)
+	Search(c *gin.Context)
+	Export(c *gin.Context)
 	Create(c *gin.Context)
 	Update(c *gin.Context)
+	Patch(c *gin.Context)
+	Delete(c *gin.Context)
+	Restore(c *gin.Context)
+	Import(c *gin.Context)
+	Purge(c *gin.Context)
+}
+
+type AuditHandler interface {
+	GetList(c *gin.Context)
+	History(c *gin.Context)
+}
+
+type WebhookHandler interface {
+	GetList(c *gin.Context)
+	Create(c *gin.Context)
+	Delete(c *gin.Context)
+	GetDeliveries(c *gin.Context)
+	Replay(c *gin.Context)
+	Test(c *gin.Context)
+}
+
+type StreamHandler interface {
+	Users(c *gin.Context)
+}
+
+type DocsHandler interface {
+	Spec(c *gin.Context)
+	Explorer(c *gin.Context)
+}
+
+type HealthHandler interface {
+	Liveness(c *gin.Context)
+	Readiness(c *gin.Context)
+	Health(c *gin.Context)
 }
 
 type Handler struct {
-	User UserHandler
+	User       UserHandler
+	Audit      AuditHandler
+	Webhook    WebhookHandler
+	Stream     StreamHandler
+	Health     HealthHandler
+	Docs       DocsHandler
+	Middleware *middleware.Middleware
 }
 
 func NewHandler(
 	cfg *config.Config,
 	services *service.Service,
+	checker *health.Checker,
 	log *logger.Logger,
 ) *Handler {
 	return &Handler{
-		User: user.NewHandler(cfg, services.User, log),
+		User:       user.NewHandler(cfg, services.User, log),
+		Audit:      audit.NewHandler(cfg, services.Audit, log),
+		Webhook:    webhook.NewHandler(cfg, services.Webhook, log),
+		Stream:     stream.NewHandler(cfg, services.Stream, log),
+		Health:     healthhandler.NewHandler(cfg, checker, log),
+		Docs:       docs.NewHandler(cfg, log),
+		Middleware: middleware.New(cfg, services, log),
 	}
 }
 
 var _ UserHandler = (*user.UserHandler)(nil)
+var _ AuditHandler = (*audit.AuditHandler)(nil)
+var _ WebhookHandler = (*webhook.WebhookHandler)(nil)
+var _ StreamHandler = (*stream.StreamHandler)(nil)
+var _ HealthHandler = (*healthhandler.HealthHandler)(nil)
+var _ DocsHandler = (*docs.DocsHandler)(nil)
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/health"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	cfg     *config.Config
+	checker *health.Checker
+	log     *logger.Logger
+}
+
+func NewHandler(
+	cfg *config.Config,
+	checker *health.Checker,
+	log *logger.Logger,
+) *HealthHandler {
+	return &HealthHandler{
+		cfg:     cfg,
+		checker: checker,
+		log:     log,
+	}
+}
+
+// Liveness only tells the process serves http, dependencies are not checked
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, gin.H{"status": health.StatusOk}))
+}
+
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.checker.Run(c.Request.Context())
+	if report.Status != health.StatusOk {
+		h.log.Ctx(c.Request.Context()).Warnf("not ready: %+v", report.Checks)
+		c.JSON(http.StatusServiceUnavailable, model.WrapResponse(http.StatusServiceUnavailable, gin.H{"status": report.Status}))
+		return
+	}
+
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, gin.H{"status": report.Status}))
+}
+
+// Health reports the status of every check, the errors of failed ones are logged only
+func (h *HealthHandler) Health(c *gin.Context) {
+	report := h.checker.Run(c.Request.Context())
+	if report.Status != health.StatusOk {
+		for _, result := range report.Checks {
+			if result.Err != nil {
+				h.log.Ctx(c.Request.Context()).Warnf("health check failed, name=%s: %s", result.Name, result.Err)
+			}
+		}
+		c.JSON(http.StatusServiceUnavailable, model.WrapResponse(http.StatusServiceUnavailable, report))
+		return
+	}
+
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, report))
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLog writes one line per request, level follows the status code
+func (m *Middleware) AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		if !m.cfg.Log.AccessLog {
+			return
+		}
+
+		status := c.Writer.Status()
+		fields := map[string]interface{}{
+			"method":     c.Request.Method,
+			"route":      c.FullPath(),
+			"path":       c.Request.URL.Path,
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"bytes":      c.Writer.Size(),
+			"client_ip":  c.ClientIP(),
+			"user_agent": c.Request.UserAgent(),
+		}
+		if key := ApiKeyFromContext(c); key != nil {
+			fields["api_key_id"] = key.Id
+		}
+
+		log := m.log.Ctx(c.Request.Context())
+		switch {
+		case status >= http.StatusInternalServerError:
+			log.ErrorFields("request", fields)
+		case status >= http.StatusBadRequest:
+			log.WarnFields("request", fields)
+		default:
+			log.InfoFields("request", fields)
+		}
+	}
+}
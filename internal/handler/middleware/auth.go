@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"fmt"
+	"gravitum-test-app/internal/handler/problem"
+	"gravitum-test-app/internal/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ApiKeyHeader     = "X-API-SECRET-KEY"
+	apiKeyContextKey = "api_key"
+)
+
+// ApiKey authenticates requests by X-API-SECRET-KEY header,
+// preflight requests pass through since browsers never send credentials with them.
+// A client ip out of failed attempts gets 429 before its key is looked up
+func (m *Middleware) ApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		values, ok := c.Request.Header[http.CanonicalHeaderKey(ApiKeyHeader)]
+		if !ok || len(values) == 0 {
+			problem.Abort(c, m.cfg, m.log, model.ErrSecurityUnauthorizedNoHeader)
+			return
+		}
+
+		client := "ip:" + c.ClientIP()
+		if !m.allowAuth(c, client) {
+			return
+		}
+
+		key, err := m.apiKeys.Authenticate(c.Request.Context(), strings.TrimSpace(values[0]))
+		if err != nil {
+			m.failAuth(c, client, err)
+			problem.Abort(c, m.cfg, m.log, err)
+			return
+		}
+
+		err = m.apiKeys.TouchLastUsed(c.Request.Context(), key.Id)
+		if err != nil {
+			m.log.Ctx(c.Request.Context()).Errorf("api key last use, id=%d: %s", key.Id, err)
+		}
+
+		c.Set(apiKeyContextKey, key)
+		c.Request = c.Request.WithContext(model.WithActor(c.Request.Context(), model.ApiKeyActor(key.Id)))
+		c.Next()
+	}
+}
+
+// allowAuth rejects a client out of authentication attempts, a failing store lets it through
+func (m *Middleware) allowAuth(c *gin.Context, client string) bool {
+	ctx := c.Request.Context()
+
+	result, err := m.rateLimit.AllowAuth(ctx, client)
+	if err != nil {
+		m.log.Ctx(ctx).Errorf("auth failure limit: %s", err)
+		return true
+	}
+
+	if !result.Allowed {
+		c.Header(RetryAfterHeader, seconds(result.RetryAfter))
+		problem.Abort(c, m.cfg, m.log, fmt.Errorf("%w, authentication failures, client=%s", model.ErrRateLimitExceeded, client))
+		return false
+	}
+
+	return true
+}
+
+// failAuth counts a rejected secret, errors of the key store are not the client's fault
+func (m *Middleware) failAuth(c *gin.Context, client string, err error) {
+	if model.LookupError(err).Status != http.StatusUnauthorized {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := m.rateLimit.FailAuth(ctx, client); err != nil {
+		m.log.Ctx(ctx).Errorf("auth failure limit: %s", err)
+	}
+}
+
+// RequireScope rejects keys without the scope. When api key auth is disabled it is a no-op,
+// except for the admin scope: purge, webhooks and the audit log are refused to everyone then
+func (m *Middleware) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.cfg.Security.ApiKeyEnabled {
+			if scope == model.ScopeAdmin {
+				problem.Abort(c, m.cfg, m.log, model.ErrSecurityApiKeyRequired)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		key := ApiKeyFromContext(c)
+		if key == nil {
+			problem.Abort(c, m.cfg, m.log, model.ErrSecurityUnauthorized)
+			return
+		}
+
+		if !key.HasScope(scope) {
+			err := fmt.Errorf("%w, api key id=%d, scope=%s", model.ErrSecurityInsufficientScope, key.Id, scope)
+			problem.Abort(c, m.cfg, m.log, err)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func ApiKeyFromContext(c *gin.Context) *model.ApiKey {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return nil
+	}
+
+	key, _ := value.(*model.ApiKey)
+	return key
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gravitum-test-app/internal/handler/problem"
+	"gravitum-test-app/internal/model"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyKeyMaxLength   = 255
+	idempotencyMaxRecordBytes = 1 << 20
+	idempotencyMaxBodyBytes   = 1 << 20 // the body is buffered to be fingerprinted
+)
+
+// recordedHeaders are stored with the response and sent again on replay
+var recordedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// Idempotency makes retries of a request with the same Idempotency-Key header safe:
+// the first response is recorded and replayed, the same key with another body is rejected.
+// Requests without the header pass through, failed (5xx) responses are not recorded
+func (m *Middleware) Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLength || !isPrintableAscii(key) {
+			problem.Abort(c, m.cfg, m.log, model.ErrIdempotencyInvalidKey)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, idempotencyMaxBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				problem.Abort(c, m.cfg, m.log, errors.Join(err, model.ErrRequestBodyTooLarge))
+				return
+			}
+			problem.Abort(c, m.cfg, m.log, errors.Join(err, model.ErrRequestInvalidBodyParams))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		owner := ""
+		if apiKey := ApiKeyFromContext(c); apiKey != nil {
+			owner = strconv.FormatUint(uint64(apiKey.Id), 10)
+		}
+
+		ctx := c.Request.Context()
+
+		record, err := m.idempotency.Begin(ctx, owner, key, fingerprint(c.Request, body))
+		if err != nil {
+			problem.Abort(c, m.cfg, m.log, err)
+			return
+		}
+
+		if record != nil {
+			m.log.Ctx(ctx).Debugf("idempotent request replayed, key=%s", key)
+			replay(c, record)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// the client may be gone already, the outcome is stored anyway so its retry gets it
+		storeCtx := context.WithoutCancel(ctx)
+
+		// released unless recorded, also when the handler panics and Recovery takes over,
+		// so retries run the request again instead of waiting for the lease
+		recorded := false
+		defer func() {
+			if recorded {
+				return
+			}
+			err := m.idempotency.Release(storeCtx, owner, key)
+			if err != nil {
+				m.log.Ctx(ctx).Errorf("idempotency key release: %s", err)
+			}
+		}()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError || recorder.overflow {
+			return
+		}
+		recorded = true
+
+		headers := map[string]string{}
+		for _, name := range recordedHeaders {
+			if value := c.Writer.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+
+		err = m.idempotency.Complete(storeCtx, owner, key, status, headers, recorder.body.Bytes())
+		if err != nil {
+			m.log.Ctx(ctx).Errorf("idempotency key complete: %s", err)
+		}
+	}
+}
+
+func replay(c *gin.Context, record *model.IdempotencyRecord) {
+	for name, value := range record.Headers {
+		c.Header(name, value)
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+
+	c.Status(*record.StatusCode)
+	if len(record.Body) > 0 {
+		_, _ = c.Writer.Write(record.Body)
+	} else {
+		c.Writer.WriteHeaderNow()
+	}
+	c.Abort()
+}
+
+// fingerprint ties the key to the request, so a reused key with another payload is detected
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isPrintableAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// responseRecorder copies the body written by the handler, large bodies are not recorded
+type responseRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseRecorder) record(b []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(b) > idempotencyMaxRecordBytes {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(b)
+}
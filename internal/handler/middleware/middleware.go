@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+)
+
+type Middleware struct {
+	cfg         *config.Config
+	apiKeys     service.ApiKeyService
+	idempotency service.IdempotencyService
+	rateLimit   service.RateLimitService
+	log         *logger.Logger
+}
+
+func New(
+	cfg *config.Config,
+	services *service.Service,
+	log *logger.Logger,
+) *Middleware {
+	return &Middleware{
+		cfg:         cfg,
+		apiKeys:     services.ApiKey,
+		idempotency: services.Idempotency,
+		rateLimit:   services.RateLimit,
+		log:         log,
+	}
+}
@@ -0,0 +1,397 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	memoryapikey "gravitum-test-app/internal/repository/memory/apikey"
+	memoryidempotency "gravitum-test-app/internal/repository/memory/idempotency"
+	memoryratelimit "gravitum-test-app/internal/repository/memory/ratelimit"
+	"gravitum-test-app/internal/service/apikey"
+	"gravitum-test-app/internal/service/idempotency"
+	"gravitum-test-app/internal/service/ratelimit"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := &Middleware{
+		cfg: &config.Config{},
+		log: logger.New(logger.GetLevelByString("error")),
+	}
+
+	var fromContext string
+	r := gin.New()
+	r.Use(m.RequestId())
+	r.GET("/", func(c *gin.Context) {
+		fromContext = model.RequestIdFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	for name, tc := range map[string]struct {
+		header   string
+		expected string
+	}{
+		"echoes valid id":    {header: "abc-123", expected: "abc-123"},
+		"generates missing":  {header: ""},
+		"replaces malformed": {header: "bad id\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(RequestIdHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			requestId := w.Header().Get(RequestIdHeader)
+			if tc.expected != "" {
+				assert.Equal(t, tc.expected, requestId)
+			} else {
+				assert.Len(t, requestId, 32)
+			}
+			assert.Equal(t, requestId, fromContext, "request context must carry the same id")
+		})
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{App: config.App{IdempotencyTtl: 1, IdempotencyWait: 5}}
+	m := &Middleware{
+		cfg:         cfg,
+		idempotency: idempotency.NewService(cfg, memoryidempotency.NewRepository(cfg)),
+		log:         logger.New(logger.GetLevelByString("error")),
+	}
+
+	var (
+		calls  atomic.Int32
+		status atomic.Int32
+		panics atomic.Bool
+	)
+	status.Store(http.StatusCreated)
+
+	r := gin.New()
+	r.Use(m.Recovery())
+	r.POST("/users", m.Idempotency(), func(c *gin.Context) {
+		n := calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		if panics.Load() {
+			panic("handler failed")
+		}
+		c.Header("Location", fmt.Sprintf("/users/%d", n))
+		c.JSON(int(status.Load()), gin.H{"id": n})
+	})
+
+	post := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("replays recorded response", func(t *testing.T) {
+		calls.Store(0)
+
+		first := post("replay", `{"name":"a"}`)
+		second := post("replay", `{"name":"a"}`)
+
+		assert.Equal(t, int32(1), calls.Load(), "handler must run once")
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, first.Header().Get("Location"), second.Header().Get("Location"))
+		assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+		assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("rejects reused key with another body", func(t *testing.T) {
+		post("reused", `{"name":"a"}`)
+		w := post("reused", `{"name":"b"}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("serializes concurrent requests", func(t *testing.T) {
+		calls.Store(0)
+
+		var wg sync.WaitGroup
+		bodies := make([]string, 5)
+		for i := range bodies {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bodies[i] = post("concurrent", `{"name":"a"}`).Body.String()
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load(), "handler must run once")
+		for _, body := range bodies {
+			assert.Equal(t, bodies[0], body)
+		}
+	})
+
+	t.Run("does not record server errors", func(t *testing.T) {
+		calls.Store(0)
+
+		status.Store(http.StatusInternalServerError)
+		post("failed", `{"name":"a"}`)
+
+		status.Store(http.StatusCreated)
+		w := post("failed", `{"name":"a"}`)
+
+		assert.Equal(t, int32(2), calls.Load(), "retry after a failure must run again")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("releases key when the handler panics", func(t *testing.T) {
+		calls.Store(0)
+
+		panics.Store(true)
+		w := post("panicked", `{"name":"a"}`)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+		panics.Store(false)
+		w = post("panicked", `{"name":"a"}`)
+
+		assert.Equal(t, int32(2), calls.Load(), "retry after a panic must run again")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("rejects oversized body", func(t *testing.T) {
+		calls.Store(0)
+
+		w := post("oversized", `{"name":"`+strings.Repeat("a", idempotencyMaxBodyBytes)+`"}`)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Zero(t, calls.Load())
+	})
+
+	t.Run("rejects malformed key", func(t *testing.T) {
+		w := post("bad\tkey", `{}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+type failingRateLimitRepository struct{}
+
+func (failingRateLimitRepository) Take(context.Context, string, time.Duration, int) (*model.RateLimitResult, error) {
+	return nil, errors.New("store is down")
+}
+
+func (failingRateLimitRepository) Peek(context.Context, string, time.Duration, int) (*model.RateLimitResult, error) {
+	return nil, errors.New("store is down")
+}
+
+func (failingRateLimitRepository) DeleteExpired(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Security: config.Security{
+		RateLimitRate:   1,
+		RateLimitBurst:  2,
+		RateLimitRoutes: "POST /users=0.001:1",
+	}}
+	m := &Middleware{
+		cfg:       cfg,
+		rateLimit: ratelimit.NewService(cfg, memoryratelimit.NewRepository(cfg)),
+		log:       logger.New(logger.GetLevelByString("error")),
+	}
+
+	r := gin.New()
+	assert.NoError(t, r.SetTrustedProxies([]string{"192.0.2.1"})) // httptest.NewRequest remote address
+	r.Use(func(c *gin.Context) {
+		if id := c.GetHeader(ApiKeyHeader); id != "" {
+			keyId, _ := strconv.ParseUint(id, 10, 32)
+			c.Set(apiKeyContextKey, &model.ApiKey{Id: uint(keyId)})
+		}
+	}, m.RateLimit())
+	r.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/users", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	send := func(method string, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/users", nil)
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	forwardedFor := func(ip string) http.Header {
+		return http.Header{"X-Forwarded-For": {ip}}
+	}
+
+	t.Run("rejects requests over the burst", func(t *testing.T) {
+		header := forwardedFor("203.0.113.1")
+
+		for _, remaining := range []string{"1", "0"} {
+			w := send(http.MethodGet, "", header)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "2", w.Header().Get(RateLimitLimitHeader))
+			assert.Equal(t, remaining, w.Header().Get(RateLimitRemainingHeader))
+			assert.Empty(t, w.Header().Get(RetryAfterHeader))
+		}
+
+		w := send(http.MethodGet, "", header)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "0", w.Header().Get(RateLimitRemainingHeader))
+		assert.Equal(t, "1", w.Header().Get(RetryAfterHeader))
+		assert.Equal(t, "2", w.Header().Get(RateLimitResetHeader))
+
+		var body model.ErrorResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "err.rate_limit.exceeded", *body.Err.Err)
+
+		assert.Equal(t, http.StatusOK, send(http.MethodGet, "", forwardedFor("203.0.113.2")).Code, "other clients keep their tokens")
+	})
+
+	t.Run("ignores X-Forwarded-For of untrusted peers", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			send(http.MethodGet, "198.51.100.1:1234", forwardedFor(fmt.Sprintf("203.0.113.%d", 10+i)))
+		}
+
+		w := send(http.MethodGet, "198.51.100.1:1234", forwardedFor("203.0.113.20"))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "spoofed ips must share the peer bucket")
+	})
+
+	t.Run("limits api keys instead of ips", func(t *testing.T) {
+		header := forwardedFor("203.0.113.30")
+		header.Set(ApiKeyHeader, "1")
+		send(http.MethodGet, "", header)
+		send(http.MethodGet, "", header)
+		assert.Equal(t, http.StatusTooManyRequests, send(http.MethodGet, "", header).Code)
+
+		header.Set(ApiKeyHeader, "2")
+		assert.Equal(t, http.StatusOK, send(http.MethodGet, "", header).Code, "keys behind one ip have own buckets")
+	})
+
+	t.Run("applies route override", func(t *testing.T) {
+		header := forwardedFor("203.0.113.40")
+
+		w := send(http.MethodPost, "", header)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "1", w.Header().Get(RateLimitLimitHeader))
+
+		w = send(http.MethodPost, "", header)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1000", w.Header().Get(RetryAfterHeader))
+
+		assert.Equal(t, http.StatusOK, send(http.MethodGet, "", header).Code, "overridden route has a bucket of its own")
+	})
+
+	t.Run("lets requests through when the store fails", func(t *testing.T) {
+		failing := &Middleware{
+			cfg:       cfg,
+			rateLimit: ratelimit.NewService(cfg, failingRateLimitRepository{}),
+			log:       m.log,
+		}
+
+		r := gin.New()
+		r.GET("/users", failing.RateLimit(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(RateLimitLimitHeader))
+	})
+}
+
+func TestApiKeyAuthFailureLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Security: config.Security{ApiKeyEnabled: true, AuthFailureRate: 0.001, AuthFailureBurst: 2}}
+	keys := apikey.NewService(cfg, memoryapikey.NewRepository(cfg))
+	m := &Middleware{
+		cfg:       cfg,
+		apiKeys:   keys,
+		rateLimit: ratelimit.NewService(cfg, memoryratelimit.NewRepository(cfg)),
+		log:       logger.New(logger.GetLevelByString("error")),
+	}
+
+	_, secret, err := keys.Create(context.Background(), "test", []string{model.ScopeAll}, nil)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/users", m.ApiKey(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func(remoteAddr string, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(ApiKeyHeader, secret)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("192.0.2.1:1234", secret).Code, "successes are not counted")
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusUnauthorized, send("192.0.2.1:1234", apikey.KeyPrefix+"guess").Code)
+	}
+
+	w := send("192.0.2.1:1234", secret)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "even a valid key is refused once failures are spent")
+	assert.NotEmpty(t, w.Header().Get(RetryAfterHeader))
+
+	assert.Equal(t, http.StatusOK, send("192.0.2.2:1234", secret).Code, "other ips have a bucket of their own")
+}
+
+// touchFailingRepository stores keys in memory but can't record their use
+type touchFailingRepository struct {
+	*memoryapikey.ApiKeyRepository
+}
+
+func (r touchFailingRepository) TouchLastUsed(ctx context.Context, id uint) error {
+	return errors.New("connection reset")
+}
+
+func TestApiKeyTouchFailureIsIgnored(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Security: config.Security{ApiKeyEnabled: true, AuthFailureRate: 1, AuthFailureBurst: 1}}
+	keys := apikey.NewService(cfg, touchFailingRepository{memoryapikey.NewRepository(cfg)})
+	m := &Middleware{
+		cfg:       cfg,
+		apiKeys:   keys,
+		rateLimit: ratelimit.NewService(cfg, memoryratelimit.NewRepository(cfg)),
+		log:       logger.New(logger.GetLevelByString("error")),
+	}
+
+	_, secret, err := keys.Create(context.Background(), "test", []string{model.ScopeAll}, nil)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/users", m.ApiKey(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set(ApiKeyHeader, secret)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
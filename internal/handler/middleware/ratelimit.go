@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"fmt"
+	"gravitum-test-app/internal/handler/problem"
+	"gravitum-test-app/internal/metrics"
+	"gravitum-test-app/internal/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
+)
+
+// RateLimit spends a token of the caller bucket per request and rejects the request with 429
+// when none is left. Callers are told apart by api key, or by client ip when there is none.
+// Requests pass through when the store fails, a broken limiter must not take the api down
+func (m *Middleware) RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		client := rateLimitClient(c)
+
+		result, err := m.rateLimit.Allow(ctx, client, c.Request.Method+" "+c.FullPath())
+		if err != nil {
+			m.log.Ctx(ctx).Errorf("rate limit: %s", err)
+			c.Next()
+			return
+		}
+
+		c.Header(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+		c.Header(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		c.Header(RateLimitResetHeader, seconds(result.Reset))
+
+		if !result.Allowed {
+			metrics.HttpRateLimitedTotal.WithLabelValues(c.Request.Method, c.FullPath()).Inc()
+			c.Header(RetryAfterHeader, seconds(result.RetryAfter))
+			problem.Abort(c, m.cfg, m.log, fmt.Errorf("%w, client=%s", model.ErrRateLimitExceeded, client))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitClient is the api key actor, or the client ip, X-Forwarded-For is honoured
+// only for security.trustedProxies
+func rateLimitClient(c *gin.Context) string {
+	if key := ApiKeyFromContext(c); key != nil {
+		return model.ApiKeyActor(key.Id)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// seconds rounds up, so a client waiting that long is not rejected again
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"fmt"
+	"gravitum-test-app/internal/handler/problem"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery turns panics into an internal server error response in the negotiated error format.
+// http.ErrAbortHandler is passed on, net/http then drops the connection of a response already started
+func (m *Middleware) Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		if recovered == http.ErrAbortHandler {
+			panic(recovered)
+		}
+		problem.Abort(c, m.cfg, m.log, fmt.Errorf("panic: %v", recovered))
+	})
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/logger"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIdHeader     = "X-Request-ID"
+	requestIdContextKey = "request_id"
+)
+
+// incoming ids end up in logs, anything else is replaced by a generated one
+var requestIdRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestId accepts X-Request-ID from the client or generates one, echoes it in the response
+// and stores a logger with request_id field in the request context, see logger.Ctx
+func (m *Middleware) RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIdHeader)
+		if !requestIdRegexp.MatchString(requestId) {
+			requestId = newRequestId()
+		}
+
+		c.Set(requestIdContextKey, requestId)
+		c.Header(RequestIdHeader, requestId)
+
+		ctx := model.WithRequestId(c.Request.Context(), requestId)
+		ctx = model.WithActor(ctx, model.ActorAnonymous) // replaced by the api key once authenticated
+		ctx = logger.NewContext(ctx, m.log.With("request_id", requestId))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
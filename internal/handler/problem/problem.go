@@ -0,0 +1,82 @@
+package problem
+
+import (
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Abort logs err and responds with its catalog status, the body is application/problem+json
+// when the client accepts it or app.problemJson is set, otherwise the legacy error envelope.
+// Only the catalog code and title reach the client, err text stays in the logs,
+// an interrupted import also carries its partial report
+func Abort(c *gin.Context, cfg *config.Config, log *logger.Logger, err error) {
+	ctx := c.Request.Context()
+	definition := model.LookupError(err)
+
+	if definition.Status >= http.StatusInternalServerError {
+		log.Ctx(ctx).Errorf("internal server error: %s", err)
+	} else {
+		log.Ctx(ctx).Errorf("%s error: %s", strings.ToLower(http.StatusText(definition.Status)), err)
+	}
+
+	if Accepts(c, cfg) {
+		c.Header("Content-Type", model.ProblemContentType)
+		c.AbortWithStatusJSON(definition.Status, model.NewProblem(err, c.Request.URL.Path, model.RequestIdFromContext(ctx)))
+		return
+	}
+
+	response := model.WrapError(definition.Status, definition.Code)
+
+	var importErr *model.ImportError
+	if errors.As(err, &importErr) {
+		response.Import = &importErr.Report
+	}
+
+	c.AbortWithStatusJSON(definition.Status, response)
+}
+
+// Accepts tells if the response should be rendered as problem+json
+func Accepts(c *gin.Context, cfg *config.Config) bool {
+	if cfg.App.ProblemJson {
+		return true
+	}
+
+	for _, value := range c.Request.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(value, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), model.ProblemContentType) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// QueryParamError keeps the parse error for logs and a client safe reason for the response
+func QueryParamError(err error, name string, reason string) error {
+	return &model.ParamError{
+		Err:    errors.Join(err, model.ErrRequestInvalidQueryParams),
+		Params: []model.InvalidParam{{Name: name, Reason: reason}},
+	}
+}
+
+// ParseId reads the :id path param of the route
+func ParseId(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, &model.ParamError{
+			Err:    errors.Join(err, model.ErrRequestInvalidUrlParams),
+			Params: []model.InvalidParam{{Name: "id", Reason: "must be a positive integer"}},
+		}
+	}
+
+	return uint(id), nil
+}
@@ -0,0 +1,118 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(cfg *config.Config, err error, accept string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	log := logger.New(logger.GetLevelByString("error"))
+
+	r := gin.New()
+	r.GET("/users/:id", func(c *gin.Context) {
+		Abort(c, cfg, log, err)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAbortProblemJson(t *testing.T) {
+	err := model.NewParamError(errors.Join(errors.New("strconv.ParseUint: invalid syntax"), model.ErrRequestInvalidQueryParams), "limit", "must be a non-negative integer")
+
+	w := serve(&config.Config{}, err, "application/json, application/problem+json;q=0.9")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, model.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "strconv")
+
+	var problem model.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, model.ErrRequestInvalidQueryParams.Error(), problem.Code)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, "/users/1", problem.Instance)
+	assert.Equal(t, []model.InvalidParam{{Name: "limit", Reason: "must be a non-negative integer"}}, problem.InvalidParams)
+}
+
+func TestAbortInternalErrorDoesNotLeak(t *testing.T) {
+	err := errors.New(`ERROR: relation "users" does not exist (SQLSTATE 42P01)`)
+
+	for name, tc := range map[string]struct {
+		cfg    *config.Config
+		accept string
+	}{
+		"problem by accept": {cfg: &config.Config{}, accept: model.ProblemContentType},
+		"problem by config": {cfg: &config.Config{App: config.App{ProblemJson: true}}},
+		"legacy envelope":   {cfg: &config.Config{}, accept: "application/json"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := serve(tc.cfg, err, tc.accept)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Contains(t, w.Body.String(), model.ErrorCodeInternal)
+			assert.NotContains(t, w.Body.String(), "SQLSTATE")
+		})
+	}
+}
+
+func TestAbortLegacyEnvelope(t *testing.T) {
+	w := serve(&config.Config{}, model.ErrNoUserWithSuchId, "")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"))
+
+	var response model.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotNil(t, response.Err.Err)
+	assert.Equal(t, model.ErrNoUserWithSuchId.Error(), *response.Err.Err)
+}
+
+func TestAbortCarriesImportReport(t *testing.T) {
+	err := &model.ImportError{
+		Err:    errors.New(`ERROR: connection reset (SQLSTATE 08006)`),
+		Report: model.ImportReport{Accepted: 2, CommittedLine: 3, Errors: []model.ImportRowError{}},
+	}
+
+	for name, accept := range map[string]string{"problem": model.ProblemContentType, "legacy envelope": ""} {
+		t.Run(name, func(t *testing.T) {
+			w := serve(&config.Config{}, err, accept)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.NotContains(t, w.Body.String(), "SQLSTATE")
+
+			var body struct {
+				Import *model.ImportReport `json:"import"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			require.NotNil(t, body.Import)
+			assert.Equal(t, 2, body.Import.Accepted)
+			assert.Equal(t, 3, body.Import.CommittedLine)
+		})
+	}
+}
+
+func TestCatalogCodesAreUnique(t *testing.T) {
+	codes := map[string]bool{}
+	for _, definition := range model.ErrorCatalog() {
+		assert.False(t, codes[definition.Code], "duplicate code %s", definition.Code)
+		codes[definition.Code] = true
+		assert.NotEmpty(t, definition.Title, "title is missing, code=%s", definition.Code)
+	}
+}
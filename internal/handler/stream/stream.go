@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// retryMs is the reconnection delay suggested to EventSource clients
+	retryMs = 3000
+	// defaultHeartbeat applies for a zero config, e.g. in tests
+	defaultHeartbeat = 15 * time.Second
+)
+
+type StreamHandler struct {
+	cfg     *config.Config
+	service service.StreamService
+	log     *logger.Logger
+}
+
+func NewHandler(
+	cfg *config.Config,
+	service service.StreamService,
+	log *logger.Logger,
+) *StreamHandler {
+	return &StreamHandler{
+		cfg:     cfg,
+		service: service,
+		log:     log,
+	}
+}
+
+// Users streams user events as server-sent events named by the event type with the
+// outbox id as event id. A client resumes with the Last-Event-ID header, or the
+// last_event_id query param where headers can't be set, an id that is no longer
+// buffered is answered with a reset event first
+func (h *StreamHandler) Users(c *gin.Context) {
+	lastEventId := parseLastEventId(c)
+
+	subscription := h.service.Subscribe(lastEventId)
+	defer subscription.Close()
+
+	heartbeat := time.Duration(h.cfg.Stream.Heartbeat) * time.Second
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginx buffers responses otherwise
+	c.Status(http.StatusOK)
+
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", retryMs)
+
+	if subscription.Reset {
+		h.write(c, sse.Event{Event: model.EventReset, Data: "{}"})
+	}
+	for _, event := range subscription.Replay {
+		h.write(c, newEvent(event))
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+			h.write(c, newEvent(event))
+		case <-ticker.C:
+			// a comment line, ignored by clients, keeps proxies from closing an idle connection
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+func (h *StreamHandler) write(c *gin.Context, event sse.Event) {
+	err := sse.Encode(c.Writer, event)
+	if err != nil {
+		h.log.Ctx(c.Request.Context()).Errorf("encode sse event: %s", err)
+	}
+}
+
+func newEvent(event *model.Event) sse.Event {
+	return sse.Event{
+		Id:    strconv.FormatUint(uint64(event.Id), 10),
+		Event: event.Type,
+		Data:  event,
+	}
+}
+
+// parseLastEventId returns nil for a new client, an unparsable id resumes from id 0
+// which is never buffered, so the client gets a reset
+func parseLastEventId(c *gin.Context) *uint {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("last_event_id")
+	}
+	if raw == "" {
+		return nil
+	}
+
+	var result uint
+	id, err := strconv.ParseUint(raw, 10, 0)
+	if err == nil {
+		result = uint(id)
+	}
+
+	return &result
+}
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"gravitum-test-app/internal/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag is a strong entity tag built from the user version
+func etag(user *model.User) string {
+	return `"` + strconv.FormatUint(uint64(user.Version), 10) + `"`
+}
+
+// parseIfMatch returns the version required by If-Match, 0 when the header is absent or *.
+// Weak and foreign tags can never match the strong comparison If-Match requires
+func parseIfMatch(c *gin.Context) (uint, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	tags := splitETags(value)
+	if len(tags) != 1 {
+		return 0, model.NewParamError(model.ErrRequestInvalidPrecondition, "If-Match", "must be a single entity tag or *")
+	}
+
+	if strings.HasPrefix(tags[0], "W/") {
+		return 0, model.ErrUserVersionMismatch
+	}
+
+	version, ok := parseETag(tags[0])
+	if !ok {
+		return 0, model.ErrUserVersionMismatch
+	}
+
+	return version, nil
+}
+
+// noneMatch tells if If-None-Match matches the user, weak comparison is used as RFC 9110 requires
+func noneMatch(c *gin.Context, user *model.User) bool {
+	value := strings.TrimSpace(c.GetHeader("If-None-Match"))
+	if value == "" {
+		return false
+	}
+
+	if value == "*" {
+		return true
+	}
+
+	for _, tag := range splitETags(value) {
+		version, ok := parseETag(strings.TrimPrefix(tag, "W/"))
+		if ok && version == user.Version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitETags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func parseETag(tag string) (uint, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 32)
+	if err != nil || version == 0 {
+		return 0, false
+	}
+
+	return uint(version), true
+}
@@ -0,0 +1,85 @@
+package user
+
+import (
+	"fmt"
+	"gravitum-test-app/internal/export"
+	"gravitum-test-app/internal/handler/problem"
+	"gravitum-test-app/internal/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export streams users matching the list filters as csv, ndjson or xlsx, pagination parameters are ignored.
+// Once the first row is sent the status can't change, a later failure aborts the connection
+// so the client never takes a truncated file for a complete one
+func (h *UserHandler) Export(c *gin.Context) {
+	params, err := parseListParams(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	format := c.DefaultQuery("format", export.Csv)
+
+	contentType, err := export.ContentType(format)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	filename := fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	// the writer is created with the first user, until then a failure can still be reported as a problem
+	var writer export.Writer
+	count := 0
+
+	open := func() error {
+		var err error
+		if writer == nil {
+			writer, err = export.NewWriter(format, c.Writer)
+		}
+		return err
+	}
+
+	err = h.service.Export(ctx, params, func(user *model.User) error {
+		err := open()
+		if err != nil {
+			return err
+		}
+
+		count++
+		return writer.Write(user)
+	})
+	if err == nil {
+		err = open()
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		h.log.Ctx(ctx).Infof("users exported, format=%s, count=%d", format, count)
+		return
+	}
+
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+		c.Writer.Header().Del("Content-Type")
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	if ctx.Err() != nil {
+		h.log.Ctx(ctx).Infof("users export cancelled by the client, format=%s, count=%d", format, count)
+		return
+	}
+
+	h.log.Ctx(ctx).Errorf("users export failed after %d rows: %s", count, err)
+	panic(http.ErrAbortHandler)
+}
@@ -2,18 +2,24 @@ package user
 
 import (
 	"errors"
+	"fmt"
 	"gravitum-test-app/config"
+	"gravitum-test-app/internal/handler/problem"
 	"gravitum-test-app/internal/model"
 	"gravitum-test-app/internal/service"
-	"gravitum-test-app/pkg/helper"
 	"gravitum-test-app/pkg/logger"
+	"gravitum-test-app/pkg/patch"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
+var acceptPatch = patch.MergePatchContentType + ", " + patch.JsonPatchContentType
+
 type UserHandler struct {
 	cfg     *config.Config
 	service service.UserService
@@ -33,159 +39,343 @@ func NewHandler(
 }
 
 func (h *UserHandler) GetList(c *gin.Context) {
-	result, err := h.service.GetList(c.Request.Context())
+	params, err := parseListParams(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	result, page, err := h.service.GetList(c.Request.Context(), params)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Debugf("get user list, total=%d", page.Total)
+	c.JSON(http.StatusOK, model.WrapPageResponse(http.StatusOK, result, page))
+}
+
+// Search finds users by words of their name and surname, typos are tolerated
+func (h *UserHandler) Search(c *gin.Context) {
+	params, err := parseSearchParams(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	result, err := h.service.Search(c.Request.Context(), params)
 	if err != nil {
-		h.log.Errorf("internal server error: %s", err)
-		c.JSON(http.StatusInternalServerError, model.WrapError(http.StatusInternalServerError, err.Error()))
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	h.log.Debug("get user list")
+	h.log.Ctx(c.Request.Context()).Debugf("search users, found=%d", len(result))
 	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, result))
 }
 
 func (h *UserHandler) Get(c *gin.Context) {
 
-	idInt, err := strconv.Atoi(c.Param("id"))
+	id, err := problem.ParseId(c)
 	if err != nil {
-		err = errors.Join(err, model.ErrRequestInvalidUrlParams)
-		h.log.Errorf("bad request error: request param error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	result, err := h.service.Get(c.Request.Context(), uint(idInt))
+	includeDeleted, err := parseIncludeDeleted(c)
 	if err != nil {
-		if errors.Is(err, model.ErrSqlNoRows) ||
-			errors.Is(err, model.ErrNoUserWithSuchId) {
-			h.log.Errorf("unprocessable entity error: %s", err)
-			c.JSON(http.StatusUnprocessableEntity, model.WrapError(http.StatusUnprocessableEntity, err.Error()))
-			return
-		}
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	result, err := h.service.Get(c.Request.Context(), id, includeDeleted)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
 
-		h.log.Errorf("internal server error: %s", err)
-		c.JSON(http.StatusInternalServerError, model.WrapError(http.StatusInternalServerError, err.Error()))
+	c.Header("ETag", etag(result))
+	if noneMatch(c, result) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	h.log.Debugf("get user, id = %d", idInt)
+	h.log.Ctx(c.Request.Context()).Debugf("get user, id = %d", id)
 	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, result))
 }
 
 func (h *UserHandler) Create(c *gin.Context) {
 	var bodyParams model.CreateUserRequest
 
-	err := c.BindJSON(&bodyParams)
+	err := c.ShouldBindJSON(&bodyParams)
 	if err != nil {
-		err = errors.Join(err, model.ErrRequestInvalidBodyParams)
-		h.log.Errorf("bad request error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+		problem.Abort(c, h.cfg, h.log, errors.Join(err, model.ErrRequestInvalidBodyParams))
 		return
 	}
 
-	// name
-	if bodyParams.Name == nil {
-		err = model.ErrRequestNameRequired
-		h.log.Errorf("bad request error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+	result, err := h.service.Create(c.Request.Context(), bodyParams.Name, bodyParams.Surname)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	name := helper.SanitizeInput(*bodyParams.Name)
-	name = strings.TrimSpace(name)
-	if len(name) == 0 {
-		err := model.ErrRequestNameRequired
-		h.log.Errorf("bad request error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+	if result.Surname == nil {
+		h.log.Ctx(c.Request.Context()).Debugf("user created, id=%d, name=%s", result.Id, result.Name)
+	} else {
+		h.log.Ctx(c.Request.Context()).Debugf("user created, id=%d, name=%s, surname=%s", result.Id, result.Name, *result.Surname)
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/users/%d", result.Id))
+	c.Header("ETag", etag(result))
+	c.JSON(http.StatusCreated, model.WrapResponse(http.StatusCreated, result))
+}
+
+func (h *UserHandler) Update(c *gin.Context) {
+
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	// surname
-	var surname *string
-	if bodyParams.Surname != nil {
-		surnameStr := helper.SanitizeInput(*bodyParams.Surname)
-		surnameStr = strings.TrimSpace(surnameStr)
-		if len(name) > 0 {
-			surname = &surnameStr
-		}
+	version, err := parseIfMatch(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	var bodyParams model.UpdateUserRequest
+
+	err = c.ShouldBindJSON(&bodyParams)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, errors.Join(err, model.ErrRequestInvalidBodyParams))
+		return
 	}
 
-	err = h.service.Create(c.Request.Context(), name, surname)
+	result, err := h.service.Update(c.Request.Context(), id, bodyParams.Name, bodyParams.Surname, version)
 	if err != nil {
-		h.log.Errorf("internal server error: %s", err)
-		c.JSON(http.StatusInternalServerError, model.WrapError(http.StatusInternalServerError, err.Error()))
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	if surname == nil {
-		h.log.Debugf("user created, name=%s", name)
+	if result.Surname == nil {
+		h.log.Ctx(c.Request.Context()).Debugf("user updated, id=%d, name=%s", id, result.Name)
 	} else {
-		h.log.Debugf("user created, name=%s, surname=%s", name, *surname)
+		h.log.Ctx(c.Request.Context()).Debugf("user updated, id=%d, name=%s, surname=%s", id, result.Name, *result.Surname)
 	}
 
-	c.JSON(http.StatusCreated, model.WrapResponse(http.StatusCreated, nil))
+	c.Header("ETag", etag(result))
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, result))
 }
 
-func (h *UserHandler) Update(c *gin.Context) {
+// Patch accepts application/merge-patch+json and application/json-patch+json bodies
+func (h *UserHandler) Patch(c *gin.Context) {
+	c.Header("Accept-Patch", acceptPatch)
 
-	idInt, err := strconv.Atoi(c.Param("id"))
+	id, err := problem.ParseId(c)
 	if err != nil {
-		err = errors.Join(err, model.ErrRequestInvalidUrlParams)
-		h.log.Errorf("bad request error: request param error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	var bodyParams model.UpdateUserRequest
+	version, err := parseIfMatch(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
 
-	err = c.BindJSON(&bodyParams)
+	body, err := c.GetRawData()
 	if err != nil {
-		err = errors.Join(err, model.ErrRequestInvalidBodyParams)
-		h.log.Errorf("bad request error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+		problem.Abort(c, h.cfg, h.log, errors.Join(err, model.ErrRequestInvalidBodyParams))
 		return
 	}
 
-	// name
-	if bodyParams.Name == nil {
-		err = model.ErrRequestNameRequired
-		h.log.Errorf("bad request error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+	result, err := h.service.Patch(c.Request.Context(), id, c.ContentType(), body, version)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	name := helper.SanitizeInput(*bodyParams.Name)
-	name = strings.TrimSpace(name)
-	if len(name) == 0 {
-		err := model.ErrRequestNameRequired
-		h.log.Errorf("bad request error: %s", err)
-		c.JSON(http.StatusBadRequest, model.WrapError(http.StatusBadRequest, err.Error()))
+	c.Header("ETag", etag(result))
+
+	h.log.Ctx(c.Request.Context()).Debugf("user patched, id=%d", id)
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, result))
+}
+
+func (h *UserHandler) Delete(c *gin.Context) {
+
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	// surname
-	var surname *string
-	if bodyParams.Surname != nil {
-		surnameStr := helper.SanitizeInput(*bodyParams.Surname)
-		surnameStr = strings.TrimSpace(surnameStr)
-		if len(name) > 0 {
-			surname = &surnameStr
-		}
+	version, err := parseIfMatch(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
 	}
 
-	err = h.service.Update(c.Request.Context(), uint(idInt), name, surname)
+	err = h.service.Delete(c.Request.Context(), id, version)
 	if err != nil {
-		h.log.Errorf("internal server error: %s", err)
-		c.JSON(http.StatusInternalServerError, model.WrapError(http.StatusInternalServerError, err.Error()))
+		problem.Abort(c, h.cfg, h.log, err)
 		return
 	}
 
-	if surname == nil {
-		h.log.Debugf("user updated, id=%d, name=%s", idInt, name)
-	} else {
-		h.log.Debugf("user updated, id=%d, name=%s, surname=%s", idInt, name, *surname)
+	h.log.Ctx(c.Request.Context()).Debugf("user deleted, id=%d", id)
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, nil))
+}
+
+func (h *UserHandler) Restore(c *gin.Context) {
+
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
 	}
-	h.log.Debugf("get user, id = %d", idInt)
 
+	err = h.service.Restore(c.Request.Context(), id)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Debugf("user restored, id=%d", id)
 	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, nil))
 }
+
+// Import accepts text/csv and application/x-ndjson bodies, the body is streamed and never held in memory
+func (h *UserHandler) Import(c *gin.Context) {
+	report, err := h.service.Import(c.Request.Context(), c.ContentType(), c.Request.Body)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Infof("users imported, accepted=%d, rejected=%d", report.Accepted, report.Rejected)
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, report))
+}
+
+func (h *UserHandler) Purge(c *gin.Context) {
+	purged, err := h.service.Purge(c.Request.Context())
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Infof("deleted users purged, count=%d", purged)
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, model.PurgeUsersResponse{Purged: purged}))
+}
+
+func parseIncludeDeleted(c *gin.Context) (bool, error) {
+	value := c.Query("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+
+	includeDeleted, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, problem.QueryParamError(err, "include_deleted", "must be true or false")
+	}
+
+	return includeDeleted, nil
+}
+
+func parseSearchParams(c *gin.Context) (model.UserSearchParams, error) {
+	var params model.UserSearchParams
+
+	params.Query = strings.TrimSpace(c.Query("q"))
+	if params.Query == "" {
+		return params, problem.QueryParamError(nil, "q", "is required")
+	}
+	if utf8.RuneCountInString(params.Query) > model.UserSearchMaxQueryLength {
+		return params, problem.QueryParamError(nil, "q", fmt.Sprintf("must be at most %d characters", model.UserSearchMaxQueryLength))
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return params, problem.QueryParamError(err, "limit", "must be a non-negative integer")
+		}
+		params.Limit = uint(limit)
+	}
+
+	return params, nil
+}
+
+func parseListParams(c *gin.Context) (model.UserListParams, error) {
+	var (
+		params model.UserListParams
+		err    error
+	)
+
+	params.IncludeDeleted, err = parseIncludeDeleted(c)
+	if err != nil {
+		return params, err
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return params, problem.QueryParamError(err, "limit", "must be a non-negative integer")
+		}
+		params.Limit = uint(limit)
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return params, problem.QueryParamError(err, "offset", "must be a non-negative integer")
+		}
+		params.Offset = uint(offset)
+	}
+
+	params.SortBy = c.Query("sort")
+
+	switch strings.ToLower(c.Query("order")) {
+	case "", "asc":
+	case "desc":
+		params.SortDesc = true
+	default:
+		return params, problem.QueryParamError(model.ErrRequestInvalidSortOrder, "order", "must be one of "+strings.Join(model.UserSortOrders, ", "))
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		params.Cursor, err = model.DecodeUserCursor(value)
+		if err != nil {
+			return params, problem.QueryParamError(err, "cursor", "is malformed")
+		}
+	}
+
+	if value, ok := c.GetQuery("name_prefix"); ok {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			params.NamePrefix = &value
+		}
+	}
+
+	if value := c.Query("has_surname"); value != "" {
+		hasSurname, err := strconv.ParseBool(value)
+		if err != nil {
+			return params, problem.QueryParamError(err, "has_surname", "must be true or false")
+		}
+		params.HasSurname = &hasSurname
+	}
+
+	if value := c.Query("inserted_from"); value != "" {
+		insertedFrom, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return params, problem.QueryParamError(err, "inserted_from", "must be an RFC 3339 timestamp")
+		}
+		params.InsertedFrom = &insertedFrom
+	}
+
+	if value := c.Query("inserted_to"); value != "" {
+		insertedTo, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return params, problem.QueryParamError(err, "inserted_to", "must be an RFC 3339 timestamp")
+		}
+		params.InsertedTo = &insertedTo
+	}
+
+	return params, nil
+}
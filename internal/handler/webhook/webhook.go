@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/handler/problem"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/service"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	cfg     *config.Config
+	service service.WebhookService
+	log     *logger.Logger
+}
+
+func NewHandler(
+	cfg *config.Config,
+	service service.WebhookService,
+	log *logger.Logger,
+) *WebhookHandler {
+	return &WebhookHandler{
+		cfg:     cfg,
+		service: service,
+		log:     log,
+	}
+}
+
+func (h *WebhookHandler) GetList(c *gin.Context) {
+	result, err := h.service.GetList(c.Request.Context())
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, result))
+}
+
+// Create registers a webhook, the response is the only one carrying its signing secret
+func (h *WebhookHandler) Create(c *gin.Context) {
+	var bodyParams model.CreateWebhookRequest
+
+	err := c.ShouldBindJSON(&bodyParams)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, errors.Join(err, model.ErrRequestInvalidBodyParams))
+		return
+	}
+
+	if bodyParams.Url == nil {
+		problem.Abort(c, h.cfg, h.log, model.NewParamError(model.ErrWebhookInvalidUrl, "url", "is required"))
+		return
+	}
+
+	result, err := h.service.Create(c.Request.Context(), strings.TrimSpace(*bodyParams.Url), bodyParams.EventTypes)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Infof("webhook created, id=%d, url=%s", result.Id, result.Url)
+	c.Header("Location", fmt.Sprintf("/api/admin/webhooks/%d", result.Id))
+	c.JSON(http.StatusCreated, model.WrapResponse(http.StatusCreated, result))
+}
+
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	err = h.service.Delete(c.Request.Context(), id)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Infof("webhook deleted, id=%d", id)
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, nil))
+}
+
+// GetDeliveries lists deliveries newest first, ?status=dead shows the dead letters
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	var status *string
+	if value := c.Query("status"); value != "" {
+		if !model.IsValidDeliveryStatus(value) {
+			problem.Abort(c, h.cfg, h.log, problem.QueryParamError(nil, "status", "must be one of "+strings.Join(model.DeliveryStatuses, ", ")))
+			return
+		}
+		status = &value
+	}
+
+	var limit uint
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			problem.Abort(c, h.cfg, h.log, problem.QueryParamError(err, "limit", "must be a non-negative integer"))
+			return
+		}
+		limit = uint(parsed)
+	}
+
+	result, err := h.service.GetDeliveries(c.Request.Context(), id, status, limit)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, result))
+}
+
+// Replay queues the dead deliveries of the webhook again
+func (h *WebhookHandler) Replay(c *gin.Context) {
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	replayed, err := h.service.Replay(c.Request.Context(), id)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	h.log.Ctx(c.Request.Context()).Infof("webhook deliveries replayed, id=%d, count=%d", id, replayed)
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, model.ReplayWebhookResponse{Replayed: replayed}))
+}
+
+// Test sends a webhook.test event and reports the outcome, a failed delivery is still a 200
+func (h *WebhookHandler) Test(c *gin.Context) {
+	id, err := problem.ParseId(c)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	result, err := h.service.Test(c.Request.Context(), id)
+	if err != nil {
+		problem.Abort(c, h.cfg, h.log, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.WrapResponse(http.StatusOK, result))
+}
@@ -0,0 +1,123 @@
+package health
+
+import (
+	"context"
+	"gravitum-test-app/internal/model"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOk   string = "ok"
+	StatusFail string = "fail"
+
+	checkTimeout = 2 * time.Second
+)
+
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult is served to unauthenticated callers, Err is for the logs only
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Err       error   `json:"-"`
+}
+
+type Report struct {
+	Status string        `json:"status"`
+	Uptime string        `json:"uptime"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs readiness checks, it is always not ready once shutdown has started
+type Checker struct {
+	mu           sync.RWMutex
+	checks       []check
+	shuttingDown atomic.Bool
+	startedAt    time.Time
+}
+
+func New() *Checker {
+	c := &Checker{
+		startedAt: time.Now(),
+	}
+
+	c.Add("shutdown", func(ctx context.Context) error {
+		if c.shuttingDown.Load() {
+			return model.ErrHealthShuttingDown
+		}
+		return nil
+	})
+
+	return c
+}
+
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checker) IsShuttingDown() bool {
+	return c.shuttingDown.Load()
+}
+
+// Run executes all checks concurrently, each one bounded by its own timeout
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]check{}, c.checks...)
+	c.mu.RUnlock()
+
+	report := Report{
+		Status: StatusOk,
+		Uptime: time.Since(c.startedAt).Round(time.Second).String(),
+		Checks: make([]CheckResult, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+
+			timeoutCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := ch.fn(timeoutCtx)
+
+			result := CheckResult{
+				Name:      ch.name,
+				Status:    StatusOk,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusFail
+				result.Err = err
+			}
+			report.Checks[i] = result
+		}(i, ch)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOk {
+			report.Status = StatusFail
+			break
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	c := New()
+	c.Add("db", func(ctx context.Context) error {
+		return nil
+	})
+
+	report := c.Run(context.Background())
+	assert.Equal(t, StatusOk, report.Status)
+	assert.Len(t, report.Checks, 2)
+
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Add("broken", func(ctx context.Context) error {
+		return errors.New("broken")
+	})
+
+	start := time.Now()
+	report = c.Run(context.Background())
+	assert.Less(t, time.Since(start), checkTimeout+time.Second, "checks must be bounded by timeout")
+	assert.Equal(t, StatusFail, report.Status)
+
+	statuses := map[string]string{}
+	for _, result := range report.Checks {
+		statuses[result.Name] = result.Status
+	}
+	assert.Equal(t, map[string]string{
+		"shutdown": StatusOk,
+		"db":       StatusOk,
+		"slow":     StatusFail,
+		"broken":   StatusFail,
+	}, statuses)
+}
+
+func TestShuttingDown(t *testing.T) {
+	c := New()
+	assert.Equal(t, StatusOk, c.Run(context.Background()).Status)
+
+	c.SetShuttingDown()
+	assert.True(t, c.IsShuttingDown())
+	assert.Equal(t, StatusFail, c.Run(context.Background()).Status)
+}
+
+func TestReportHidesErrors(t *testing.T) {
+	c := New()
+	c.Add("db", func(ctx context.Context) error {
+		return errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	})
+
+	report := c.Run(context.Background())
+	assert.Equal(t, StatusFail, report.Status)
+
+	body, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "10.0.0.5", "check errors are for the logs only")
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"gravitum-test-app/pkg/metrics"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Registry is served at /metrics
+var Registry = metrics.NewRegistry()
+
+// http
+var (
+	HttpRequestsTotal = Registry.NewCounterVec(
+		"http_requests_total",
+		"Total number of http requests by route template and status code.",
+		"method", "route", "status",
+	)
+	HttpRequestDuration = Registry.NewHistogramVec(
+		"http_request_duration_seconds",
+		"Http request latency by route template.",
+		metrics.DefBuckets,
+		"method", "route",
+	)
+	HttpRequestsInFlight = Registry.NewGauge(
+		"http_requests_in_flight",
+		"Number of http requests being served.",
+	)
+	HttpRateLimitedTotal = Registry.NewCounterVec(
+		"http_rate_limited_total",
+		"Http requests rejected by the rate limit by route template.",
+		"method", "route",
+	)
+)
+
+// db
+var (
+	DbQueryDuration = Registry.NewHistogramVec(
+		"db_query_duration_seconds",
+		"Repository method latency.",
+		metrics.DefBuckets,
+		"repository", "method",
+	)
+	DbQueryErrorsTotal = Registry.NewCounterVec(
+		"db_query_errors_total",
+		"Repository method calls returned an error.",
+		"repository", "method",
+	)
+)
+
+// business
+var (
+	UsersCreatedTotal  = Registry.NewCounter("users_created_total", "Users created.")
+	UsersUpdatedTotal  = Registry.NewCounter("users_updated_total", "Users updated.")
+	UsersDeletedTotal  = Registry.NewCounter("users_deleted_total", "Users soft deleted.")
+	UsersRestoredTotal = Registry.NewCounter("users_restored_total", "Soft deleted users restored.")
+	UsersPurgedTotal   = Registry.NewCounter("users_purged_total", "Soft deleted users removed for good.")
+
+	UsersImportRejectedTotal = Registry.NewCounter("users_import_rejected_total", "Imported rows rejected by validation.")
+)
+
+// webhook
+var (
+	WebhookDeliveriesTotal = Registry.NewCounterVec(
+		"webhook_deliveries_total",
+		"Webhook delivery attempts by resulting status: delivered, pending for a retry or dead.",
+		"status",
+	)
+)
+
+var pool atomic.Pointer[pgxpool.Pool]
+
+// ObservePool exposes pgxpool.Stat of the pool, nil stops reporting e.g. after the pool is closed
+func ObservePool(p *pgxpool.Pool) {
+	pool.Store(p)
+}
+
+func poolStat(fn func(s *pgxpool.Stat) float64) func() float64 {
+	return func() float64 {
+		p := pool.Load()
+		if p == nil {
+			return 0
+		}
+		return fn(p.Stat())
+	}
+}
+
+func init() {
+	Registry.NewGaugeFunc("db_pool_acquired_conns", "Connections currently acquired from the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }))
+	Registry.NewGaugeFunc("db_pool_idle_conns", "Idle connections in the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }))
+	Registry.NewGaugeFunc("db_pool_total_conns", "Total connections in the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }))
+	Registry.NewGaugeFunc("db_pool_max_conns", "Maximum size of the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }))
+	Registry.NewCounterFunc("db_pool_acquire_total", "Successful acquires from the pool.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }))
+	Registry.NewCounterFunc("db_pool_empty_acquire_total", "Acquires that waited for a connection.",
+		poolStat(func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) }))
+	Registry.NewCounterFunc("db_pool_acquire_wait_seconds_total", "Total time spent acquiring connections.",
+		poolStat(func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }))
+}
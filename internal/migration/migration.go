@@ -0,0 +1,433 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"gravitum-test-app/build/sql/migrate"
+	"gravitum-test-app/pkg/errors"
+	"gravitum-test-app/pkg/logger"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// table schema_migrations:
+// version
+// name
+// applied_at
+
+// advisoryLockKey serializes migrations between app replicas started at the same time
+const advisoryLockKey int64 = 7264431589
+
+var (
+	ErrNoMigration    = errors.New("err.migration.no_migration")
+	ErrUnknownVersion = errors.New("err.migration.unknown_version")
+	ErrInvalidName    = errors.New("err.migration.invalid_file_name")
+)
+
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	log        *logger.Logger
+	migrations []Migration
+}
+
+func New(db *pgxpool.Pool, log *logger.Logger) (*Migrator, error) {
+	migrations, err := Load(migrate.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		log:        log,
+		migrations: migrations,
+	}, nil
+}
+
+// Load reads <version>_<name>.up.sql / .down.sql pairs from fsys sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		matches := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				return nil, errors.Wrap(ErrInvalidName, entry.Name())
+			}
+			continue
+		}
+
+		version, err := strconv.ParseUint(matches[1], 10, 32)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidName, entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{
+				Version: uint(version),
+				Name:    matches[2],
+			}
+			byVersion[uint(version)] = m
+		}
+
+		if matches[2] != m.Name {
+			return nil, errors.Wrap(ErrInvalidName, entry.Name())
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		result = append(result, *m)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
+}
+
+// Latest is the highest version compiled into the binary
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version is the highest version applied to the database, 0 if nothing was applied yet
+func (m *Migrator) Version(ctx context.Context) (uint, error) {
+	var exists bool
+
+	err := m.db.QueryRow(ctx, `
+		SELECT to_regclass('schema_migrations') IS NOT NULL
+	`).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, nil
+	}
+
+	var version int64
+
+	err = m.db.QueryRow(ctx, `
+		SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+	`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(version), nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var result []Status
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{
+				Version: migration.Version,
+				Name:    migration.Name,
+			}
+
+			if record, ok := applied[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = record.AppliedAt
+				delete(applied, migration.Version)
+			}
+
+			result = append(result, status)
+		}
+
+		// versions applied by a newer binary are reported as well
+		for _, record := range applied {
+			result = append(result, record)
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Version < result[j].Version
+		})
+
+		return nil
+	})
+
+	return result, err
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down rolls back the last n applied migrations
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && n > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err = m.down(ctx, conn, migration)
+			if err != nil {
+				return err
+			}
+			n--
+		}
+
+		return nil
+	})
+}
+
+// Goto migrates up or down until exactly the migrations <= version are applied
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	if version != 0 && !m.known(version) {
+		return errors.Wrap(ErrUnknownVersion, strconv.FormatUint(uint64(version), 10))
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+				continue
+			}
+
+			err = m.down(ctx, conn, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
+				continue
+			}
+
+			err = m.up(ctx, conn, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Force records the migrations <= version as applied and the rest as not applied,
+// without running any sql, it is meant to fix a database changed by hand
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && !m.known(version) {
+		return errors.Wrap(ErrUnknownVersion, strconv.FormatUint(uint64(version), 10))
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		_, err = tx.Exec(ctx, `
+			DELETE FROM schema_migrations WHERE version > $1
+		`, int64(version))
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+
+			_, err = tx.Exec(ctx, `
+				INSERT INTO schema_migrations (version, name)
+				VALUES ($1, $2)
+				ON CONFLICT (version) DO NOTHING
+			`, int64(migration.Version), migration.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		m.log.Infof("migration version forced to %d", version)
+		return tx.Commit(ctx)
+	})
+}
+
+func (m *Migrator) known(version uint) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[uint]Status, error) {
+	result := map[uint]Status{}
+
+	rows, err := conn.Query(ctx, `
+		SELECT
+			version,
+			name,
+			applied_at
+		FROM schema_migrations
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version   int64
+			name      string
+			appliedAt time.Time
+		)
+
+		err = rows.Scan(&version, &name, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		result[uint(version)] = Status{
+			Version:   uint(version),
+			Name:      name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+		}
+	}
+
+	return result, rows.Err()
+}
+
+func (m *Migrator) up(ctx context.Context, conn *pgxpool.Conn, migration Migration) error {
+	return m.exec(ctx, conn, migration, migration.Up, `
+		INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+	`, int64(migration.Version), migration.Name)
+}
+
+func (m *Migrator) down(ctx context.Context, conn *pgxpool.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return errors.Wrap(ErrNoMigration, fmt.Sprintf("%d_%s.down.sql", migration.Version, migration.Name))
+	}
+
+	return m.exec(ctx, conn, migration, migration.Down, `
+		DELETE FROM schema_migrations WHERE version = $1
+	`, int64(migration.Version))
+}
+
+// exec runs the migration sql and the bookkeeping statement in one transaction
+func (m *Migrator) exec(
+	ctx context.Context,
+	conn *pgxpool.Conn,
+	migration Migration,
+	sql string,
+	bookkeeping string,
+	args ...interface{},
+) error {
+	start := time.Now()
+
+	err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, sql)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, bookkeeping, args...)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("migration %d_%s", migration.Version, migration.Name))
+	}
+
+	m.log.Infof("migration %d_%s done in %s", migration.Version, migration.Name, time.Since(start))
+	return nil
+}
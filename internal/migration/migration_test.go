@@ -0,0 +1,54 @@
+package migration
+
+import (
+	"gravitum-test-app/build/sql/migrate"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load(migrate.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	for i, m := range migrations {
+		assert.Equal(t, uint(i+1), m.Version, "migration versions must be sequential")
+		assert.NotEmpty(t, m.Up, "up migration is empty, version=%d", m.Version)
+		assert.NotEmpty(t, m.Down, "down migration is empty, version=%d", m.Version)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"000010_b.up.sql":   {Data: []byte("up b")},
+		"000002_a.up.sql":   {Data: []byte("up a")},
+		"000002_a.down.sql": {Data: []byte("down a")},
+		"README.md":         {Data: []byte("ignored")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []Migration{
+		{Version: 2, Name: "a", Up: "up a", Down: "down a"},
+		{Version: 10, Name: "b", Up: "up b"},
+	}, migrations)
+
+	_, err = Load(fstest.MapFS{
+		"users.sql": {Data: []byte("")},
+	})
+	assert.ErrorIs(t, err, ErrInvalidName)
+
+	_, err = Load(fstest.MapFS{
+		"000001_a.up.sql":   {Data: []byte("")},
+		"000001_b.down.sql": {Data: []byte("")},
+	})
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+const (
+	ScopeAll        string = "*"
+	ScopeUsersRead  string = "users:read"
+	ScopeUsersWrite string = "users:write"
+	ScopeAdmin      string = "admin"
+)
+
+var ApiKeyScopes = []string{
+	ScopeAll,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeAdmin,
+}
+
+type ApiKey struct {
+	Id         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k *ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == ScopeAll || s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *ApiKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+func IsValidApiKeyScope(scope string) bool {
+	for _, s := range ApiKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// AuditTimeFormat keeps microseconds as postgres does, the database renders the same format
+const AuditTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+const (
+	AuditOperationCreate  string = "create"
+	AuditOperationUpdate  string = "update"
+	AuditOperationDelete  string = "delete"
+	AuditOperationRestore string = "restore"
+	AuditOperationPurge   string = "purge"
+)
+
+var AuditOperations = []string{
+	AuditOperationCreate,
+	AuditOperationUpdate,
+	AuditOperationDelete,
+	AuditOperationRestore,
+	AuditOperationPurge,
+}
+
+func IsValidAuditOperation(operation string) bool {
+	for _, o := range AuditOperations {
+		if o == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditChange holds the values of a column before and after a write, null when absent
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// UserAudit is an entry of the user_audit table, written in the same transaction as the user
+type UserAudit struct {
+	Id        uint                   `json:"id"`
+	UserId    uint                   `json:"user_id"`
+	Operation string                 `json:"operation"`
+	Actor     string                 `json:"actor"`
+	RequestId string                 `json:"request_id,omitempty"`
+	Changes   map[string]AuditChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// NewUserAudit diffs the audited columns of before and after, before is nil on create and after on purge.
+// Actor and request id are taken from ctx
+func NewUserAudit(ctx context.Context, operation string, before *User, after *User) *UserAudit {
+	entry := &UserAudit{
+		Operation: operation,
+		Actor:     ActorFromContext(ctx),
+		RequestId: RequestIdFromContext(ctx),
+		Changes:   map[string]AuditChange{},
+	}
+
+	if after != nil {
+		entry.UserId = after.Id
+	} else if before != nil {
+		entry.UserId = before.Id
+	}
+
+	was, is := auditValues(before), auditValues(after)
+	for _, column := range []string{"name", "surname", "deleted_at"} {
+		if was[column] != is[column] {
+			entry.Changes[column] = AuditChange{Before: was[column], After: is[column]}
+		}
+	}
+
+	return entry
+}
+
+// auditValues are strings or nil, so entries compare the same after a json round trip
+func auditValues(user *User) map[string]interface{} {
+	values := map[string]interface{}{"name": nil, "surname": nil, "deleted_at": nil}
+	if user == nil {
+		return values
+	}
+
+	values["name"] = user.Name
+	if user.Surname != nil {
+		values["surname"] = *user.Surname
+	}
+	if user.DeletedAt != nil {
+		values["deleted_at"] = user.DeletedAt.UTC().Format(AuditTimeFormat)
+	}
+
+	return values
+}
+
+type AuditListParams struct {
+	Limit     uint
+	Cursor    *uint // id of the last entry of the previous page, entries are listed newest first
+	UserId    *uint
+	Actor     *string
+	Operation *string
+	From      *time.Time // inclusive
+	To        *time.Time // exclusive
+}
+
+func EncodeAuditCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func DecodeAuditCursor(s string) (*uint, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrRequestInvalidCursor
+	}
+
+	id, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil || id == 0 {
+		return nil, ErrRequestInvalidCursor
+	}
+
+	result := uint(id)
+	return &result, nil
+}
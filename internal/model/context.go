@@ -0,0 +1,42 @@
+package model
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	ActorSystem    string = "system"    // background jobs and cli commands
+	ActorAnonymous string = "anonymous" // http requests when api key auth is disabled
+)
+
+type requestIdKey struct{}
+
+type actorKey struct{}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestIdFromContext returns empty string outside of an http request
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns ActorSystem outside of an http request
+func ActorFromContext(ctx context.Context) string {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	if !ok {
+		return ActorSystem
+	}
+	return actor
+}
+
+func ApiKeyActor(id uint) string {
+	return fmt.Sprintf("api_key:%d", id)
+}
@@ -13,16 +13,45 @@ var (
 	ErrSecurityUnauthorizedInvalidHeader error  = errors.New("err.security.unauthorized-invalid-header")
 	ErrSecurityAbsentSecret              error  = errors.New("err.security.absent-secret")
 	ErrSecurityInvalidSecret             error  = errors.New("err.security.invalid-secret")
+	ErrSecurityInsufficientScope         error  = errors.New("err.security.insufficient-scope")
+	ErrSecurityApiKeyRequired            error  = errors.New("err.security.api-key-required")
 	ErrResponseUnexpectedStatusCode      error  = errors.New("err.response.unexpected_status_code")
 	ErrRequestInvalidUrlParams           error  = errors.New("err.request.invalid_url_params")
 	ErrRequestInvalidBodyParams          error  = errors.New("err.request.invalid_body_params")
+	ErrRequestInvalidQueryParams         error  = errors.New("err.request.invalid_query_params")
+	ErrRequestInvalidSortField           error  = errors.New("err.request.invalid_sort_field")
+	ErrRequestInvalidSortOrder           error  = errors.New("err.request.invalid_sort_order")
+	ErrRequestInvalidCursor              error  = errors.New("err.request.invalid_cursor")
 	ErrRequestNameRequired               error  = errors.New("err.request.name_required")
+	ErrRequestRouteNotFound              error  = errors.New("err.request.route_not_found")
+	ErrRequestUnsupportedMediaType       error  = errors.New("err.request.unsupported_media_type")
+	ErrRequestInvalidPatch               error  = errors.New("err.request.invalid_patch")
+	ErrRequestPatchConflict              error  = errors.New("err.request.patch_conflict")
+	ErrRequestInvalidExportFormat        error  = errors.New("err.request.invalid_export_format")
+	ErrRequestInvalidPrecondition        error  = errors.New("err.request.invalid_precondition")
+	ErrRequestBodyTooLarge               error  = errors.New("err.request.body_too_large")
 	ErrNoUserWithSuchId                  error  = errors.New("err.user.no_user_with_such_id")
+	ErrUserNotDeleted                    error  = errors.New("err.user.not_deleted")
+	ErrUserVersionMismatch               error  = errors.New("err.user.version_mismatch")
+	ErrNoApiKeyWithSuchId                error  = errors.New("err.api_key.no_api_key_with_such_id")
+	ErrApiKeyInvalidScope                error  = errors.New("err.api_key.invalid_scope")
+	ErrNoWebhookWithSuchId               error  = errors.New("err.webhook.no_webhook_with_such_id")
+	ErrWebhookInvalidUrl                 error  = errors.New("err.webhook.invalid_url")
+	ErrWebhookInvalidEventType           error  = errors.New("err.webhook.invalid_event_type")
+	ErrWebhookForbiddenDestination       error  = errors.New("err.webhook.forbidden_destination")
+	ErrIdempotencyInvalidKey             error  = errors.New("err.idempotency.invalid_key")
+	ErrIdempotencyKeyReused              error  = errors.New("err.idempotency.key_reused")
+	ErrIdempotencyInProgress             error  = errors.New("err.idempotency.in_progress")
+	ErrRateLimitExceeded                 error  = errors.New("err.rate_limit.exceeded")
+	ErrHealthShuttingDown                error  = errors.New("err.health.shutting_down")
+	ErrHealthMigrationsOutdated          error  = errors.New("err.health.migrations_outdated")
 	ErrSqlNoRows                         error  = errors.New("err.sql.no_rows")
+	ErrSqlUniqueViolation                error  = errors.New("err.sql.unique_violation")
 )
 
 type ErrorResponse struct {
-	Err *Errors `json:"errors"`
+	Err    *Errors       `json:"errors"`
+	Import *ImportReport `json:"import,omitempty"`
 }
 
 type Errors struct {
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is a request seen with an Idempotency-Key header,
+// StatusCode is nil while the first request is still running
+type IdempotencyRecord struct {
+	Owner       string            // api key id, empty when auth is disabled
+	Key         string            // Idempotency-Key header value
+	Fingerprint string            // sha256 of method, path and body
+	StatusCode  *int              // recorded response
+	Headers     map[string]string // recorded response headers
+	Body        []byte            // recorded response body
+	CreatedAt   time.Time
+	LockedUntil time.Time // a record still in progress after that is abandoned and may be taken over
+	ExpiresAt   time.Time
+}
+
+func (r *IdempotencyRecord) IsCompleted() bool {
+	return r.StatusCode != nil
+}
+
+// IsAbandoned tells if the request holding the record died without completing or releasing it
+func (r *IdempotencyRecord) IsAbandoned(now time.Time) bool {
+	return !r.IsCompleted() && r.LockedUntil.Before(now)
+}
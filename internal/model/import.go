@@ -0,0 +1,77 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	ImportCsvContentType    = "text/csv"
+	ImportNdjsonContentType = "application/x-ndjson"
+)
+
+// UserNameMaxLength is the length of users.name and users.surname columns in characters
+const UserNameMaxLength = 100
+
+// ImportMaxErrors caps the rows listed in a report, counters are exact anyway
+const ImportMaxErrors = 1000
+
+// NewUser is a validated row ready to be copied into users
+type NewUser struct {
+	Name    string
+	Surname *string
+}
+
+type ImportRowError struct {
+	Line   int    `json:"line"`
+	Code   string `json:"code"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ImportReport counts the rows of an import, CommittedLine is the line of the last copied row
+// so an import stopped by an error can be resumed after it
+type ImportReport struct {
+	Accepted      int              `json:"accepted"`
+	Rejected      int              `json:"rejected"`
+	CommittedLine int              `json:"committed_line"`
+	Errors        []ImportRowError `json:"errors"`
+}
+
+// ImportError stops an import after some batches were copied, Report counts the rows kept
+type ImportError struct {
+	Err    error
+	Report ImportReport
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%s: import stopped after line %d, %d rows accepted", e.Err, e.Report.CommittedLine, e.Report.Accepted)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// Reject counts a rejected row and lists it while the report has room,
+// like problems the reason comes from the catalog or the param details only
+func (r *ImportReport) Reject(line int, err error) {
+	r.Rejected++
+	if len(r.Errors) >= ImportMaxErrors {
+		return
+	}
+
+	definition := LookupError(err)
+	rowError := ImportRowError{
+		Line:   line,
+		Code:   definition.Code,
+		Reason: definition.Title,
+	}
+
+	var paramErr *ParamError
+	if errors.As(err, &paramErr) && len(paramErr.Params) > 0 {
+		rowError.Field = paramErr.Params[0].Name
+		rowError.Reason = paramErr.Params[0].Reason
+	}
+
+	r.Errors = append(r.Errors, rowError)
+}
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses
+const ProblemContentType = "application/problem+json"
+
+// ErrorCodeInternal is what clients see for any error missing from the catalog
+const ErrorCodeInternal = "err.internal"
+
+// Problem is an RFC 7807 error response, code, request_id and invalid_params are extension members
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code"`
+	RequestId     string         `json:"request_id,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+	Import        *ImportReport  `json:"import,omitempty"`
+}
+
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ParamError carries field level details of a request error, Err is the catalog error
+type ParamError struct {
+	Err    error
+	Params []InvalidParam
+}
+
+func (e *ParamError) Error() string {
+	parts := make([]string, 0, len(e.Params))
+	for _, param := range e.Params {
+		parts = append(parts, param.Name+" "+param.Reason)
+	}
+	return e.Err.Error() + ": " + strings.Join(parts, ", ")
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+func NewParamError(err error, name string, reason string) error {
+	return &ParamError{
+		Err:    err,
+		Params: []InvalidParam{{Name: name, Reason: reason}},
+	}
+}
+
+// ErrorDefinition is a catalog entry, Code is the stable machine code clients may rely on
+type ErrorDefinition struct {
+	Err    error
+	Status int
+	Code   string
+	Title  string
+}
+
+// errorCatalog is matched with errors.Is in order, so more specific errors go first
+var errorCatalog = []ErrorDefinition{
+	// security
+	{Err: ErrSecurityUnauthorizedNoHeader, Status: http.StatusUnauthorized, Title: "Api key header is missing"},
+	{Err: ErrSecurityUnauthorizedInvalidHeader, Status: http.StatusUnauthorized, Title: "Api key header is malformed"},
+	{Err: ErrSecurityAbsentSecret, Status: http.StatusUnauthorized, Title: "Api key is empty"},
+	{Err: ErrSecurityInvalidSecret, Status: http.StatusUnauthorized, Title: "Api key is invalid"},
+	{Err: ErrSecurityUnauthorized, Status: http.StatusUnauthorized, Title: "Unauthorized"},
+	{Err: ErrSecurityInsufficientScope, Status: http.StatusForbidden, Title: "Api key lacks the required scope"},
+	{Err: ErrSecurityApiKeyRequired, Status: http.StatusForbidden, Title: "Admin routes are disabled while api keys are disabled"},
+
+	// request
+	{Err: ErrRequestInvalidSortField, Status: http.StatusBadRequest, Title: "Unknown sort field"},
+	{Err: ErrRequestInvalidSortOrder, Status: http.StatusBadRequest, Title: "Unknown sort order"},
+	{Err: ErrRequestInvalidCursor, Status: http.StatusBadRequest, Title: "Cursor is malformed"},
+	{Err: ErrRequestNameRequired, Status: http.StatusBadRequest, Title: "Name is required"},
+	{Err: ErrRequestInvalidUrlParams, Status: http.StatusBadRequest, Title: "Invalid url parameters"},
+	{Err: ErrRequestInvalidQueryParams, Status: http.StatusBadRequest, Title: "Invalid query parameters"},
+	{Err: ErrRequestInvalidBodyParams, Status: http.StatusBadRequest, Title: "Invalid request body"},
+	{Err: ErrRequestRouteNotFound, Status: http.StatusNotFound, Title: "Route not found"},
+	{Err: ErrRequestUnsupportedMediaType, Status: http.StatusUnsupportedMediaType, Title: "Unsupported content type"},
+	{Err: ErrRequestInvalidPatch, Status: http.StatusBadRequest, Title: "Patch document is malformed"},
+	{Err: ErrRequestPatchConflict, Status: http.StatusConflict, Title: "Patch cannot be applied to the user"},
+	{Err: ErrRequestInvalidExportFormat, Status: http.StatusBadRequest, Title: "Unknown export format"},
+	{Err: ErrRequestInvalidPrecondition, Status: http.StatusBadRequest, Title: "Invalid conditional request header"},
+	{Err: ErrRequestBodyTooLarge, Status: http.StatusRequestEntityTooLarge, Title: "Request body is too large"},
+
+	// user
+	{Err: ErrNoUserWithSuchId, Status: http.StatusUnprocessableEntity, Title: "User not found"},
+	{Err: ErrUserNotDeleted, Status: http.StatusConflict, Title: "User is not deleted"},
+	{Err: ErrUserVersionMismatch, Status: http.StatusPreconditionFailed, Title: "User was changed by another request"},
+
+	// api key
+	{Err: ErrNoApiKeyWithSuchId, Status: http.StatusUnprocessableEntity, Title: "Api key not found"},
+	{Err: ErrApiKeyInvalidScope, Status: http.StatusBadRequest, Title: "Unknown api key scope"},
+
+	// webhook
+	{Err: ErrNoWebhookWithSuchId, Status: http.StatusUnprocessableEntity, Title: "Webhook not found"},
+	{Err: ErrWebhookInvalidUrl, Status: http.StatusBadRequest, Title: "Webhook url must be an absolute http or https url"},
+	{Err: ErrWebhookInvalidEventType, Status: http.StatusBadRequest, Title: "Unknown event type"},
+	{Err: ErrWebhookForbiddenDestination, Status: http.StatusBadRequest, Title: "Webhook url points to a loopback, private or link-local address"},
+
+	// idempotency
+	{Err: ErrIdempotencyInvalidKey, Status: http.StatusBadRequest, Title: "Idempotency-Key header is malformed"},
+	{Err: ErrIdempotencyKeyReused, Status: http.StatusUnprocessableEntity, Title: "Idempotency-Key was used with a different request"},
+	{Err: ErrIdempotencyInProgress, Status: http.StatusConflict, Title: "Request with this Idempotency-Key is still in progress"},
+
+	// rate limit
+	{Err: ErrRateLimitExceeded, Status: http.StatusTooManyRequests, Title: "Too many requests"},
+
+	// health
+	{Err: ErrHealthShuttingDown, Status: http.StatusServiceUnavailable, Title: "Service is shutting down"},
+	{Err: ErrHealthMigrationsOutdated, Status: http.StatusServiceUnavailable, Title: "Database migrations are outdated"},
+
+	// sql
+	{Err: ErrSqlNoRows, Status: http.StatusUnprocessableEntity, Title: "Entity not found"},
+	{Err: ErrSqlUniqueViolation, Status: http.StatusConflict, Title: "Entity already exists"},
+}
+
+func init() {
+	for i := range errorCatalog {
+		errorCatalog[i].Code = errorCatalog[i].Err.Error()
+	}
+}
+
+// ErrorCatalog lists every known error, e.g. for documentation
+func ErrorCatalog() []ErrorDefinition {
+	return append([]ErrorDefinition{}, errorCatalog...)
+}
+
+// LookupError finds the catalog entry of err, unknown errors are internal server errors
+func LookupError(err error) ErrorDefinition {
+	for _, definition := range errorCatalog {
+		if errors.Is(err, definition.Err) {
+			return definition
+		}
+	}
+
+	return ErrorDefinition{
+		Err:    err,
+		Status: http.StatusInternalServerError,
+		Code:   ErrorCodeInternal,
+		Title:  "Internal server error",
+	}
+}
+
+// NewProblem renders err without leaking its text, only catalog data and param details go out
+func NewProblem(err error, instance string, requestId string) Problem {
+	definition := LookupError(err)
+
+	problem := Problem{
+		Type:      "urn:problem:" + definition.Code,
+		Title:     definition.Title,
+		Status:    definition.Status,
+		Instance:  instance,
+		Code:      definition.Code,
+		RequestId: requestId,
+	}
+
+	var paramErr *ParamError
+	if definition.Status < http.StatusInternalServerError && errors.As(err, &paramErr) {
+		problem.InvalidParams = paramErr.Params
+	}
+
+	var importErr *ImportError
+	if errors.As(err, &importErr) {
+		problem.Import = &importErr.Report
+	}
+
+	return problem
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// RateLimitResult is the state of a client bucket after a request, sent as RateLimit-* headers
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // burst of the bucket
+	Remaining  int           // requests that would be allowed right now
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, zero when allowed
+}
+
+// NewRateLimitResult describes a GCRA bucket, tat is its theoretical arrival time: the moment the bucket
+// is full again. Every request moves it by interval, one is allowed while tat+interval-now <= burst*interval
+func NewRateLimitResult(allowed bool, now time.Time, tat time.Time, interval time.Duration, burst int) *RateLimitResult {
+	wait := max(tat.Sub(now), 0)
+	tolerance := time.Duration(burst) * interval
+
+	result := &RateLimitResult{
+		Allowed:   allowed,
+		Limit:     burst,
+		Remaining: min(max(int((tolerance-wait)/interval), 0), burst),
+		Reset:     wait,
+	}
+	if !allowed {
+		result.RetryAfter = max(wait+interval-tolerance, 0)
+	}
+
+	return result
+}
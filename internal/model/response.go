@@ -9,6 +9,14 @@ type Response struct {
 	StatusCode int          `json:"status_code"`
 	StatusText string       `json:"status_text"`
 	Data       *interface{} `json:"data,omitempty"`
+	Page       *Page        `json:"page,omitempty"`
+}
+
+type Page struct {
+	Total      int64   `json:"total"`
+	Limit      uint    `json:"limit"`
+	Offset     uint    `json:"offset"`
+	NextCursor *string `json:"next_cursor,omitempty"`
 }
 
 func WrapResponse(statusCode int, data interface{}) Response {
@@ -33,3 +41,9 @@ func WrapResponse(statusCode int, data interface{}) Response {
 		StatusText: statusText,
 	}
 }
+
+func WrapPageResponse(statusCode int, data interface{}, page *Page) Response {
+	response := WrapResponse(statusCode, data)
+	response.Page = page
+	return response
+}
@@ -0,0 +1,17 @@
+package model
+
+// UserSearchMaxQueryLength bounds the q parameter of the search in characters
+const UserSearchMaxQueryLength = 100
+
+type UserSearchParams struct {
+	Query string
+	Limit uint
+}
+
+// UserSearchResult is a user with its relevance, Highlight is "name surname"
+// with the matched words wrapped in <mark> tags
+type UserSearchResult struct {
+	User
+	Score     float64 `json:"score"`
+	Highlight string  `json:"highlight"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// EventReset is sent to a resuming client when events were missed, it has to reload the users
+const EventReset string = "reset"
+
+// Subscription is a live feed of user events. Replay holds the buffered events
+// that followed the one the client resumes from, Reset is set when that event
+// is no longer buffered and the client has to reload its state instead.
+// Events is closed when the subscriber falls behind or the stream stops,
+// the client is expected to reconnect with the id of the last event it got
+type Subscription struct {
+	Replay []*Event
+	Reset  bool
+	Events <-chan *Event
+	Close  func()
+}
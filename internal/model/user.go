@@ -1,6 +1,29 @@
 package model
 
-import "time"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+const (
+	UserSortId         string = "id"
+	UserSortName       string = "name"
+	UserSortSurname    string = "surname"
+	UserSortInsertedAt string = "inserted_at"
+	UserSortUpdatedAt  string = "updated_at"
+)
+
+var UserSortFields = []string{
+	UserSortId,
+	UserSortName,
+	UserSortSurname,
+	UserSortInsertedAt,
+	UserSortUpdatedAt,
+}
+
+// UserSortOrders are the values of the order parameter, asc is the default
+var UserSortOrders = []string{"asc", "desc"}
 
 type CreateUserRequest struct {
 	Name    *string `json:"name"`
@@ -12,10 +35,103 @@ type UpdateUserRequest struct {
 	Surname *string `json:"surname"`
 }
 
+// UserChanges holds the columns to persist, fields left nil are not touched
+type UserChanges struct {
+	Name       *string
+	Surname    *string
+	SurnameSet bool // Surname is written even when nil, which clears it
+}
+
+func (c UserChanges) IsEmpty() bool {
+	return c.Name == nil && !c.SurnameSet
+}
+
 type User struct {
 	Id         uint       `json:"id"`
 	Name       string     `json:"name"`
 	Surname    *string    `json:"surname,omitempty"`
 	InsertedAt time.Time  `json:"inserted_at"`
 	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	Version    uint       `json:"version"` // incremented by every write, exposed as ETag
+}
+
+type PurgeUsersResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+type UserListParams struct {
+	Limit          uint
+	Offset         uint
+	Cursor         *UserCursor // keyset pagination, takes precedence over Offset
+	SortBy         string
+	SortDesc       bool
+	NamePrefix     *string
+	HasSurname     *bool
+	InsertedFrom   *time.Time // inclusive
+	InsertedTo     *time.Time // exclusive
+	IncludeDeleted bool
+}
+
+// UserCursor points right after the last user of a page,
+// Value holds the sort column of that user, Id breaks ties
+type UserCursor struct {
+	SortBy   string `json:"s"`
+	SortDesc bool   `json:"d,omitempty"`
+	Value    string `json:"v,omitempty"`
+	Id       uint   `json:"i"`
+}
+
+func IsValidUserSortField(field string) bool {
+	for _, f := range UserSortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func NewUserCursor(user *User, sortBy string, sortDesc bool) UserCursor {
+	cursor := UserCursor{
+		SortBy:   sortBy,
+		SortDesc: sortDesc,
+		Id:       user.Id,
+	}
+
+	switch sortBy {
+	case UserSortName:
+		cursor.Value = user.Name
+	case UserSortSurname:
+		if user.Surname != nil {
+			cursor.Value = *user.Surname
+		}
+	case UserSortInsertedAt:
+		cursor.Value = user.InsertedAt.Format(time.RFC3339Nano)
+	case UserSortUpdatedAt:
+		if user.UpdatedAt != nil {
+			cursor.Value = user.UpdatedAt.Format(time.RFC3339Nano)
+		}
+	}
+
+	return cursor
+}
+
+func (c UserCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeUserCursor(s string) (*UserCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrRequestInvalidCursor
+	}
+
+	var cursor UserCursor
+	err = json.Unmarshal(b, &cursor)
+	if err != nil || !IsValidUserSortField(cursor.SortBy) {
+		return nil, ErrRequestInvalidCursor
+	}
+
+	return &cursor, nil
 }
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventUserCreated string = "user.created"
+	EventUserUpdated string = "user.updated"
+	EventUserDeleted string = "user.deleted"
+	EventWebhookTest string = "webhook.test" // sent by the test endpoint only, never stored
+)
+
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserDeleted,
+}
+
+func IsValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is an outbox row, Data is the user as the api renders it
+type Event struct {
+	Id        uint            `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewUserEvent is the outbox event of an audited write of user, nil for purge which emits none.
+// Restore is reported as an update
+func NewUserEvent(operation string, user *User) *Event {
+	var eventType string
+
+	switch operation {
+	case AuditOperationCreate:
+		eventType = EventUserCreated
+	case AuditOperationUpdate, AuditOperationRestore:
+		eventType = EventUserUpdated
+	case AuditOperationDelete:
+		eventType = EventUserDeleted
+	default:
+		return nil
+	}
+
+	data, _ := json.Marshal(user)
+	return &Event{Type: eventType, Data: data}
+}
+
+type Webhook struct {
+	Id         uint      `json:"id"`
+	Url        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"` // returned once on create
+	EventTypes []string  `json:"event_types"`      // empty subscribes to every event
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (w *Webhook) Accepts(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateWebhookRequest struct {
+	Url        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+const (
+	DeliveryStatusPending   string = "pending"
+	DeliveryStatusDelivered string = "delivered"
+	DeliveryStatusDead      string = "dead" // attempts are exhausted, only a replay sends it again
+)
+
+var DeliveryStatuses = []string{
+	DeliveryStatusPending,
+	DeliveryStatusDelivered,
+	DeliveryStatusDead,
+}
+
+func IsValidDeliveryStatus(status string) bool {
+	for _, s := range DeliveryStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an event queued for one webhook
+type WebhookDelivery struct {
+	Id             uint       `json:"id"`
+	WebhookId      uint       `json:"webhook_id"`
+	Event          Event      `json:"event"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// set on claimed deliveries, never rendered
+	Url    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// DeliveryAttempt is the outcome of one request to a webhook,
+// StatusCode is 0 when no response was received
+type DeliveryAttempt struct {
+	StatusCode int     `json:"status_code,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+func (a DeliveryAttempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+type ReplayWebhookResponse struct {
+	Replayed int64 `json:"replayed"`
+}
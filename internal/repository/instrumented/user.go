@@ -0,0 +1,122 @@
+package instrumented
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/internal/metrics"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/pkg/logger"
+	"time"
+)
+
+// UserRepository records latency and errors of every call to the wrapped repository,
+// unexpected errors are logged with the request scoped logger
+type UserRepository struct {
+	next repository.UserRepository
+	log  *logger.Logger
+}
+
+func NewUserRepository(next repository.UserRepository, log *logger.Logger) *UserRepository {
+	return &UserRepository{
+		next: next,
+		log:  log,
+	}
+}
+
+var _ repository.UserRepository = (*UserRepository)(nil)
+
+func (r *UserRepository) observe(ctx context.Context, method string, start time.Time, err error) {
+	metrics.DbQueryDuration.WithLabelValues("user", method).Observe(time.Since(start).Seconds())
+	// missing rows and version conflicts are expected outcomes, not db failures
+	if err != nil && !errors.Is(err, model.ErrSqlNoRows) && !errors.Is(err, model.ErrUserVersionMismatch) {
+		metrics.DbQueryErrorsTotal.WithLabelValues("user", method).Inc()
+		r.log.Ctx(ctx).Errorf("user repository %s: %s", method, err)
+	}
+}
+
+func (r *UserRepository) CheckIfExists(ctx context.Context, id uint, includeDeleted bool) (exists bool, err error) {
+	defer func(start time.Time) { r.observe(ctx, "CheckIfExists", start, err) }(time.Now())
+	return r.next.CheckIfExists(ctx, id, includeDeleted)
+}
+
+func (r *UserRepository) Get(ctx context.Context, id uint, includeDeleted bool) (user *model.User, err error) {
+	defer func(start time.Time) { r.observe(ctx, "Get", start, err) }(time.Now())
+	return r.next.Get(ctx, id, includeDeleted)
+}
+
+func (r *UserRepository) GetList(ctx context.Context, params model.UserListParams) (list []*model.User, err error) {
+	defer func(start time.Time) { r.observe(ctx, "GetList", start, err) }(time.Now())
+	return r.next.GetList(ctx, params)
+}
+
+func (r *UserRepository) Count(ctx context.Context, params model.UserListParams) (total int64, err error) {
+	defer func(start time.Time) { r.observe(ctx, "Count", start, err) }(time.Now())
+	return r.next.Count(ctx, params)
+}
+
+func (r *UserRepository) Search(ctx context.Context, params model.UserSearchParams) (list []*model.UserSearchResult, err error) {
+	defer func(start time.Time) { r.observe(ctx, "Search", start, err) }(time.Now())
+	return r.next.Search(ctx, params)
+}
+
+// Export doesn't count errors of fn as db errors, e.g. a client gone in the middle of a download
+func (r *UserRepository) Export(ctx context.Context, params model.UserListParams, fn func(user *model.User) error) (err error) {
+	var fnErr error
+	defer func(start time.Time) {
+		dbErr := err
+		if fnErr != nil {
+			dbErr = nil
+		}
+		r.observe(ctx, "Export", start, dbErr)
+	}(time.Now())
+	return r.next.Export(ctx, params, func(user *model.User) error {
+		fnErr = fn(user)
+		return fnErr
+	})
+}
+
+func (r *UserRepository) Create(
+	ctx context.Context,
+	name string,
+	surname *string,
+) (user *model.User, err error) {
+	defer func(start time.Time) { r.observe(ctx, "Create", start, err) }(time.Now())
+	return r.next.Create(ctx, name, surname)
+}
+
+func (r *UserRepository) CreateBatch(ctx context.Context, users []model.NewUser) (written int64, err error) {
+	defer func(start time.Time) { r.observe(ctx, "CreateBatch", start, err) }(time.Now())
+	return r.next.CreateBatch(ctx, users)
+}
+
+func (r *UserRepository) Update(
+	ctx context.Context,
+	id uint,
+	name string,
+	surname *string,
+	version uint,
+) (user *model.User, err error) {
+	defer func(start time.Time) { r.observe(ctx, "Update", start, err) }(time.Now())
+	return r.next.Update(ctx, id, name, surname, version)
+}
+
+func (r *UserRepository) Patch(ctx context.Context, id uint, changes model.UserChanges, version uint) (user *model.User, err error) {
+	defer func(start time.Time) { r.observe(ctx, "Patch", start, err) }(time.Now())
+	return r.next.Patch(ctx, id, changes, version)
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id uint, version uint) (err error) {
+	defer func(start time.Time) { r.observe(ctx, "Delete", start, err) }(time.Now())
+	return r.next.Delete(ctx, id, version)
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id uint) (err error) {
+	defer func(start time.Time) { r.observe(ctx, "Restore", start, err) }(time.Now())
+	return r.next.Restore(ctx, id)
+}
+
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (purged int64, err error) {
+	defer func(start time.Time) { r.observe(ctx, "Purge", start, err) }(time.Now())
+	return r.next.Purge(ctx, deletedBefore)
+}
@@ -0,0 +1,134 @@
+package apikey
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ApiKeyRepository struct {
+	cfg    *config.Config
+	mu     sync.RWMutex
+	lastId uint
+	keys   map[uint]*model.ApiKey
+	hashes map[string]uint
+}
+
+func NewRepository(cfg *config.Config) *ApiKeyRepository {
+	return &ApiKeyRepository{
+		cfg:    cfg,
+		keys:   map[uint]*model.ApiKey{},
+		hashes: map[string]uint{},
+	}
+}
+
+func (r *ApiKeyRepository) GetList(ctx context.Context) ([]*model.ApiKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*model.ApiKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		result = append(result, clone(key))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+
+	return result, nil
+}
+
+func (r *ApiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.ApiKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.hashes[keyHash]
+	if !ok {
+		return nil, model.ErrSqlNoRows
+	}
+
+	return clone(r.keys[id]), nil
+}
+
+func (r *ApiKeyRepository) Create(
+	ctx context.Context,
+	name string,
+	prefix string,
+	keyHash string,
+	scopes []string,
+	expiresAt *time.Time,
+) (*model.ApiKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.hashes[keyHash]; ok {
+		return nil, model.ErrSqlUniqueViolation
+	}
+
+	r.lastId++
+	key := &model.ApiKey{
+		Id:        r.lastId,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    append([]string{}, scopes...),
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+		ExpiresAt: cloneTime(expiresAt),
+	}
+
+	r.keys[key.Id] = key
+	r.hashes[keyHash] = key.Id
+
+	return clone(key), nil
+}
+
+func (r *ApiKeyRepository) Revoke(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.RevokedAt != nil {
+		return model.ErrSqlNoRows
+	}
+
+	revokedAt := time.Now().Truncate(time.Microsecond)
+	key.RevokedAt = &revokedAt
+
+	return nil
+}
+
+func (r *ApiKeyRepository) TouchLastUsed(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now().Truncate(time.Microsecond)
+	if key.LastUsedAt == nil || key.LastUsedAt.Before(now.Add(-time.Minute)) {
+		key.LastUsedAt = &now
+	}
+
+	return nil
+}
+
+func clone(key *model.ApiKey) *model.ApiKey {
+	result := *key
+	result.Scopes = append([]string{}, key.Scopes...)
+	result.ExpiresAt = cloneTime(key.ExpiresAt)
+	result.LastUsedAt = cloneTime(key.LastUsedAt)
+	result.RevokedAt = cloneTime(key.RevokedAt)
+	return &result
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	result := *t
+	return &result
+}
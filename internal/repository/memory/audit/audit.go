@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"sync"
+	"time"
+)
+
+// AuditRepository keeps audit entries in process memory in insertion order,
+// the memory user repository appends to it while holding its own lock
+type AuditRepository struct {
+	cfg     *config.Config
+	mu      sync.RWMutex
+	lastId  uint
+	entries []*model.UserAudit
+}
+
+func NewRepository(cfg *config.Config) *AuditRepository {
+	return &AuditRepository{
+		cfg: cfg,
+	}
+}
+
+// Append assigns the id and the creation time of entry and stores it
+func (r *AuditRepository) Append(entry *model.UserAudit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastId++
+	entry.Id = r.lastId
+	entry.CreatedAt = time.Now().Truncate(time.Microsecond)
+	r.entries = append(r.entries, entry)
+}
+
+func (r *AuditRepository) GetList(ctx context.Context, params model.AuditListParams) ([]*model.UserAudit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []*model.UserAudit{}
+
+	for i := len(r.entries) - 1; i >= 0 && uint(len(result)) < params.Limit; i-- {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry := r.entries[i]
+		if matches(entry, params) {
+			result = append(result, clone(entry))
+		}
+	}
+
+	return result, nil
+}
+
+func (r *AuditRepository) Count(ctx context.Context, params model.AuditListParams) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	params.Cursor = nil
+
+	var total int64
+	for _, entry := range r.entries {
+		if matches(entry, params) {
+			total++
+		}
+	}
+
+	return total, nil
+}
+
+func matches(entry *model.UserAudit, params model.AuditListParams) bool {
+	switch {
+	case params.Cursor != nil && entry.Id >= *params.Cursor:
+		return false
+	case params.UserId != nil && entry.UserId != *params.UserId:
+		return false
+	case params.Actor != nil && entry.Actor != *params.Actor:
+		return false
+	case params.Operation != nil && entry.Operation != *params.Operation:
+		return false
+	case params.From != nil && entry.CreatedAt.Before(*params.From):
+		return false
+	case params.To != nil && !entry.CreatedAt.Before(*params.To):
+		return false
+	}
+	return true
+}
+
+// clone copies the changes map, its values are immutable strings or nil
+func clone(entry *model.UserAudit) *model.UserAudit {
+	result := *entry
+	result.Changes = make(map[string]model.AuditChange, len(entry.Changes))
+	for column, change := range entry.Changes {
+		result.Changes[column] = change
+	}
+	return &result
+}
@@ -0,0 +1,121 @@
+package idempotency
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"sync"
+	"time"
+)
+
+type recordKey struct {
+	owner string
+	key   string
+}
+
+type IdempotencyRepository struct {
+	cfg     *config.Config
+	mu      sync.Mutex
+	records map[recordKey]*model.IdempotencyRecord
+}
+
+func NewRepository(cfg *config.Config) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		cfg:     cfg,
+		records: map[recordKey]*model.IdempotencyRecord{},
+	}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := recordKey{owner: record.Owner, key: record.Key}
+
+	now := time.Now()
+	existing, ok := r.records[k]
+	if ok && !existing.ExpiresAt.Before(now) && !existing.IsAbandoned(now) {
+		return clone(existing), false, nil
+	}
+
+	r.records[k] = &model.IdempotencyRecord{
+		Owner:       record.Owner,
+		Key:         record.Key,
+		Fingerprint: record.Fingerprint,
+		CreatedAt:   now,
+		LockedUntil: record.LockedUntil,
+		ExpiresAt:   record.ExpiresAt,
+	}
+
+	return nil, true, nil
+}
+
+func (r *IdempotencyRepository) Complete(
+	ctx context.Context,
+	owner string,
+	key string,
+	statusCode int,
+	headers map[string]string,
+	body []byte,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[recordKey{owner: owner, key: key}]
+	if !ok {
+		return nil
+	}
+
+	record.StatusCode = &statusCode
+	record.Headers = map[string]string{}
+	for name, value := range headers {
+		record.Headers[name] = value
+	}
+	record.Body = append([]byte{}, body...)
+
+	return nil
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, owner string, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := recordKey{owner: owner, key: key}
+	if record, ok := r.records[k]; ok && !record.IsCompleted() {
+		delete(r.records, k)
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for k, record := range r.records {
+		if record.ExpiresAt.Before(now) {
+			delete(r.records, k)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func clone(record *model.IdempotencyRecord) *model.IdempotencyRecord {
+	result := *record
+	if record.StatusCode != nil {
+		statusCode := *record.StatusCode
+		result.StatusCode = &statusCode
+	}
+	if record.Headers != nil {
+		result.Headers = map[string]string{}
+		for name, value := range record.Headers {
+			result.Headers[name] = value
+		}
+	}
+	result.Body = append([]byte(nil), record.Body...)
+	return &result
+}
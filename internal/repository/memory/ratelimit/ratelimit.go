@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"sync"
+	"time"
+)
+
+// RateLimitRepository keeps the buckets of this process only, every replica limits on its own
+type RateLimitRepository struct {
+	cfg     *config.Config
+	mu      sync.Mutex
+	buckets map[string]time.Time // theoretical arrival time by key
+}
+
+func NewRepository(cfg *config.Config) *RateLimitRepository {
+	return &RateLimitRepository{
+		cfg:     cfg,
+		buckets: map[string]time.Time{},
+	}
+}
+
+func (r *RateLimitRepository) Take(ctx context.Context, key string, interval time.Duration, burst int) (*model.RateLimitResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	tat := r.buckets[key]
+	if tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(interval)
+	if next.Sub(now) > time.Duration(burst)*interval {
+		return model.NewRateLimitResult(false, now, tat, interval, burst), nil
+	}
+
+	r.buckets[key] = next
+	return model.NewRateLimitResult(true, now, next, interval, burst), nil
+}
+
+func (r *RateLimitRepository) Peek(ctx context.Context, key string, interval time.Duration, burst int) (*model.RateLimitResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	tat := r.buckets[key]
+	if tat.Before(now) {
+		tat = now
+	}
+
+	allowed := tat.Add(interval).Sub(now) <= time.Duration(burst)*interval
+	return model.NewRateLimitResult(allowed, now, tat, interval, burst), nil
+}
+
+func (r *RateLimitRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for key, tat := range r.buckets {
+		if tat.Before(now) {
+			delete(r.buckets, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/internal/repository/memory/apikey"
+	"gravitum-test-app/internal/repository/memory/audit"
+	"gravitum-test-app/internal/repository/memory/idempotency"
+	"gravitum-test-app/internal/repository/memory/ratelimit"
+	"gravitum-test-app/internal/repository/memory/user"
+	"gravitum-test-app/internal/repository/memory/webhook"
+)
+
+// NewRepository keeps everything in process memory, data is lost on restart,
+// it is meant for tests and local demos without postgres
+func NewRepository(cfg *config.Config) *repository.Repository {
+	audit := audit.NewRepository(cfg)
+	webhook := webhook.NewRepository(cfg)
+
+	return &repository.Repository{
+		User:        user.NewRepository(cfg, audit, webhook),
+		Audit:       audit,
+		Webhook:     webhook,
+		Event:       webhook, // the outbox lives in the webhook repository
+		ApiKey:      apikey.NewRepository(cfg),
+		Idempotency: idempotency.NewRepository(cfg),
+		RateLimit:   ratelimit.NewRepository(cfg),
+	}
+}
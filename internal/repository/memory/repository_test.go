@@ -0,0 +1,11 @@
+package memory
+
+import (
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	repositorytest.Run(t, NewRepository(&config.Config{}))
+}
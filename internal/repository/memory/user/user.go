@@ -0,0 +1,504 @@
+package user
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository/memory/audit"
+	"gravitum-test-app/internal/repository/memory/webhook"
+	"gravitum-test-app/pkg/search"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserRepository keeps users in process memory with the same semantics as the postgres one,
+// timestamps are truncated to microseconds as postgres timestamptz does.
+// Audit entries and outbox events are appended under the users lock, so they are ordered as the writes are
+type UserRepository struct {
+	cfg    *config.Config
+	audit  *audit.AuditRepository
+	outbox *webhook.WebhookRepository
+	mu     sync.RWMutex
+	lastId uint
+	users  map[uint]*model.User
+}
+
+func NewRepository(cfg *config.Config, audit *audit.AuditRepository, outbox *webhook.WebhookRepository) *UserRepository {
+	return &UserRepository{
+		cfg:    cfg,
+		audit:  audit,
+		outbox: outbox,
+		users:  map[uint]*model.User{},
+	}
+}
+
+func (r *UserRepository) CheckIfExists(ctx context.Context, id uint, includeDeleted bool) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	return ok && (includeDeleted || user.DeletedAt == nil), nil
+}
+
+func (r *UserRepository) GetList(ctx context.Context, params model.UserListParams) ([]*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	filtered, err := r.filter(params)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		c := compare(sortKeyOf(filtered[i], params.SortBy), sortKeyOf(filtered[j], params.SortBy))
+		if params.SortDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if params.Cursor == nil {
+		if params.Offset >= uint(len(filtered)) {
+			filtered = filtered[:0]
+		} else {
+			filtered = filtered[params.Offset:]
+		}
+	}
+
+	if uint(len(filtered)) > params.Limit {
+		filtered = filtered[:params.Limit]
+	}
+
+	result := make([]*model.User, 0, len(filtered))
+	for _, user := range filtered {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result = append(result, clone(user))
+	}
+
+	return result, nil
+}
+
+// Search scores like the postgres repository, word similarity is an approximation of pg_trgm one
+func (r *UserRepository) Search(ctx context.Context, params model.UserSearchParams) ([]*model.UserSearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []*model.UserSearchResult{}
+
+	tokens := search.Tokens(params.Query)
+	if len(tokens) == 0 {
+		return result, nil
+	}
+	query := strings.Join(tokens, " ")
+
+	for _, user := range r.users {
+		if user.DeletedAt != nil {
+			continue
+		}
+
+		doc := user.Name
+		if user.Surname != nil {
+			doc += " " + *user.Surname
+		}
+
+		score := search.WordSimilarity(query, doc)
+		if search.Matches(tokens, doc) {
+			score++
+		} else if score < search.WordSimilarityThreshold {
+			continue
+		}
+
+		result = append(result, &model.UserSearchResult{User: *clone(user), Score: score})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Id < result[j].Id
+	})
+
+	if uint(len(result)) > params.Limit {
+		result = result[:params.Limit]
+	}
+
+	return result, nil
+}
+
+// Export sorts a snapshot of the matching users, fn is called without holding the lock
+func (r *UserRepository) Export(ctx context.Context, params model.UserListParams, fn func(user *model.User) error) error {
+	params.Cursor = nil
+	params.Offset = 0
+	params.Limit = math.MaxUint32
+
+	list, err := r.GetList(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err = fn(user)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *UserRepository) Count(ctx context.Context, params model.UserListParams) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	params.Cursor = nil
+
+	filtered, err := r.filter(params)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(filtered)), nil
+}
+
+func (r *UserRepository) Get(ctx context.Context, id uint, includeDeleted bool) (*model.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || (!includeDeleted && user.DeletedAt != nil) {
+		return nil, model.ErrSqlNoRows
+	}
+
+	return clone(user), nil
+}
+
+func (r *UserRepository) Create(
+	ctx context.Context,
+	name string,
+	surname *string,
+) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastId++
+	user := &model.User{
+		Id:         r.lastId,
+		Name:       name,
+		Surname:    cloneString(surname),
+		InsertedAt: now(),
+		Version:    1,
+	}
+	r.users[r.lastId] = user
+	r.record(ctx, model.AuditOperationCreate, nil, user)
+
+	return clone(user), nil
+}
+
+func (r *UserRepository) CreateBatch(ctx context.Context, users []model.NewUser) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	insertedAt := now()
+	for _, user := range users {
+		r.lastId++
+		created := &model.User{
+			Id:         r.lastId,
+			Name:       user.Name,
+			Surname:    cloneString(user.Surname),
+			InsertedAt: insertedAt,
+			Version:    1,
+		}
+		r.users[r.lastId] = created
+		r.record(ctx, model.AuditOperationCreate, nil, created)
+	}
+
+	return int64(len(users)), nil
+}
+
+func (r *UserRepository) Update(
+	ctx context.Context,
+	id uint,
+	name string,
+	surname *string,
+	version uint,
+) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.writable(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	before := clone(user)
+
+	updatedAt := now()
+	user.Name = name
+	user.Surname = cloneString(surname)
+	user.UpdatedAt = &updatedAt
+	user.Version++
+	r.record(ctx, model.AuditOperationUpdate, before, user)
+
+	return clone(user), nil
+}
+
+func (r *UserRepository) Patch(ctx context.Context, id uint, changes model.UserChanges, version uint) (*model.User, error) {
+	if changes.IsEmpty() {
+		return r.Get(ctx, id, false)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.writable(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	before := clone(user)
+
+	if changes.Name != nil {
+		user.Name = *changes.Name
+	}
+	if changes.SurnameSet {
+		user.Surname = cloneString(changes.Surname)
+	}
+
+	updatedAt := now()
+	user.UpdatedAt = &updatedAt
+	user.Version++
+	r.record(ctx, model.AuditOperationUpdate, before, user)
+
+	return clone(user), nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id uint, version uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, err := r.writable(id, version)
+	if err != nil {
+		return err
+	}
+
+	before := clone(user)
+
+	deletedAt := now()
+	user.DeletedAt = &deletedAt
+	user.Version++
+	r.record(ctx, model.AuditOperationDelete, before, user)
+
+	return nil
+}
+
+// writable returns the active user when version is 0 or matches, callers hold the lock
+func (r *UserRepository) writable(id uint, version uint) (*model.User, error) {
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, model.ErrSqlNoRows
+	}
+
+	if version != 0 && user.Version != version {
+		return nil, model.ErrUserVersionMismatch
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return model.ErrSqlNoRows
+	}
+
+	before := clone(user)
+
+	user.DeletedAt = nil
+	user.Version++
+	r.record(ctx, model.AuditOperationRestore, before, user)
+
+	return nil
+}
+
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, user := range r.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(deletedBefore) {
+			delete(r.users, id)
+			r.record(ctx, model.AuditOperationPurge, user, nil)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// record appends the audit entry and the outbox event of a write, callers hold the lock
+func (r *UserRepository) record(ctx context.Context, operation string, before *model.User, after *model.User) {
+	r.audit.Append(model.NewUserAudit(ctx, operation, before, after))
+
+	if event := model.NewUserEvent(operation, after); event != nil {
+		r.outbox.Append(event)
+	}
+}
+
+func (r *UserRepository) filter(params model.UserListParams) ([]*model.User, error) {
+	var cursorKey *sortKey
+	if params.Cursor != nil {
+		key, err := sortKeyOfCursor(params.Cursor, params.SortBy)
+		if err != nil {
+			return nil, err
+		}
+		cursorKey = &key
+	}
+
+	result := []*model.User{}
+
+	for _, user := range r.users {
+		if !params.IncludeDeleted && user.DeletedAt != nil {
+			continue
+		}
+
+		if params.NamePrefix != nil &&
+			!strings.HasPrefix(strings.ToLower(user.Name), strings.ToLower(*params.NamePrefix)) {
+			continue
+		}
+
+		if params.HasSurname != nil {
+			hasSurname := user.Surname != nil && *user.Surname != ""
+			if hasSurname != *params.HasSurname {
+				continue
+			}
+		}
+
+		if params.InsertedFrom != nil && user.InsertedAt.Before(*params.InsertedFrom) {
+			continue
+		}
+
+		if params.InsertedTo != nil && !user.InsertedAt.Before(*params.InsertedTo) {
+			continue
+		}
+
+		if cursorKey != nil {
+			c := compare(sortKeyOf(user, params.SortBy), *cursorKey)
+			if (!params.SortDesc && c <= 0) || (params.SortDesc && c >= 0) {
+				continue
+			}
+		}
+
+		result = append(result, user)
+	}
+
+	return result, nil
+}
+
+// sortKey mirrors the sort expressions of the postgres repository, nulls become empty string and epoch
+type sortKey struct {
+	text string
+	time time.Time
+	id   uint
+}
+
+var epoch = time.Unix(0, 0).UTC()
+
+func sortKeyOf(user *model.User, sortBy string) sortKey {
+	key := sortKey{id: user.Id}
+
+	switch sortBy {
+	case model.UserSortName:
+		key.text = user.Name
+	case model.UserSortSurname:
+		if user.Surname != nil {
+			key.text = *user.Surname
+		}
+	case model.UserSortInsertedAt:
+		key.time = user.InsertedAt
+	case model.UserSortUpdatedAt:
+		key.time = epoch
+		if user.UpdatedAt != nil {
+			key.time = *user.UpdatedAt
+		}
+	}
+
+	return key
+}
+
+func sortKeyOfCursor(cursor *model.UserCursor, sortBy string) (sortKey, error) {
+	key := sortKey{id: cursor.Id}
+
+	switch sortBy {
+	case model.UserSortId:
+	case model.UserSortName, model.UserSortSurname:
+		key.text = cursor.Value
+	case model.UserSortInsertedAt, model.UserSortUpdatedAt:
+		key.time = epoch
+		if cursor.Value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, cursor.Value)
+			if err != nil {
+				return key, model.ErrRequestInvalidCursor
+			}
+			key.time = parsed
+		}
+	default:
+		return key, model.ErrRequestInvalidCursor
+	}
+
+	return key, nil
+}
+
+func compare(a, b sortKey) int {
+	if c := strings.Compare(a.text, b.text); c != 0 {
+		return c
+	}
+	if c := a.time.Compare(b.time); c != 0 {
+		return c
+	}
+	switch {
+	case a.id < b.id:
+		return -1
+	case a.id > b.id:
+		return 1
+	}
+	return 0
+}
+
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func clone(user *model.User) *model.User {
+	result := *user
+	result.Surname = cloneString(user.Surname)
+	if user.UpdatedAt != nil {
+		updatedAt := *user.UpdatedAt
+		result.UpdatedAt = &updatedAt
+	}
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		result.DeletedAt = &deletedAt
+	}
+	return &result
+}
+
+func cloneString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	result := *s
+	return &result
+}
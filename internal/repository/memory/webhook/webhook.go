@@ -0,0 +1,325 @@
+package webhook
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"sync"
+	"time"
+)
+
+// WebhookRepository keeps webhooks, the outbox and deliveries in process memory,
+// the memory user repository appends events to it while holding its own lock
+type WebhookRepository struct {
+	cfg            *config.Config
+	mu             sync.Mutex
+	lastWebhookId  uint
+	lastEventId    uint
+	lastDeliveryId uint
+	webhooks       map[uint]*model.Webhook
+	events         []*model.Event
+	dispatched     int // events before it are queued for delivery
+	deliveries     []*model.WebhookDelivery
+	lastListenerId uint
+	listeners      map[uint]func(event *model.Event)
+}
+
+func NewRepository(cfg *config.Config) *WebhookRepository {
+	return &WebhookRepository{
+		cfg:       cfg,
+		webhooks:  map[uint]*model.Webhook{},
+		listeners: map[uint]func(event *model.Event){},
+	}
+}
+
+// Append assigns the id and the creation time of event and adds it to the outbox
+func (r *WebhookRepository) Append(event *model.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastEventId++
+	event.Id = r.lastEventId
+	event.CreatedAt = now()
+	r.events = append(r.events, event)
+
+	for _, fn := range r.listeners {
+		fn(event)
+	}
+}
+
+// Listen calls fn for every event appended until ctx is cancelled, fn runs under the lock
+// of the repository and must not block
+func (r *WebhookRepository) Listen(ctx context.Context, fn func(event *model.Event)) error {
+	r.mu.Lock()
+	r.lastListenerId++
+	id := r.lastListenerId
+	r.listeners[id] = fn
+	r.mu.Unlock()
+
+	<-ctx.Done()
+
+	r.mu.Lock()
+	delete(r.listeners, id)
+	r.mu.Unlock()
+
+	return ctx.Err()
+}
+
+func (r *WebhookRepository) GetList(ctx context.Context) ([]*model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []*model.Webhook{}
+	for id := uint(1); id <= r.lastWebhookId; id++ {
+		if webhook, ok := r.webhooks[id]; ok {
+			item := clone(webhook)
+			item.Secret = ""
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *WebhookRepository) Get(ctx context.Context, id uint) (*model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, model.ErrSqlNoRows
+	}
+
+	return clone(webhook), nil
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, url string, secret string, eventTypes []string) (*model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastWebhookId++
+	webhook := &model.Webhook{
+		Id:         r.lastWebhookId,
+		Url:        url,
+		Secret:     secret,
+		EventTypes: append([]string{}, eventTypes...),
+		CreatedAt:  now(),
+	}
+	r.webhooks[webhook.Id] = webhook
+
+	return clone(webhook), nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return model.ErrSqlNoRows
+	}
+	delete(r.webhooks, id)
+
+	kept := r.deliveries[:0]
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookId != id {
+			kept = append(kept, delivery)
+		}
+	}
+	r.deliveries = kept
+
+	return nil
+}
+
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, webhookId uint, status *string, limit uint) ([]*model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []*model.WebhookDelivery{}
+	for i := len(r.deliveries) - 1; i >= 0 && uint(len(result)) < limit; i-- {
+		delivery := r.deliveries[i]
+		if delivery.WebhookId != webhookId || (status != nil && delivery.Status != *status) {
+			continue
+		}
+
+		item := cloneDelivery(delivery)
+		item.Url, item.Secret = "", ""
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+func (r *WebhookRepository) Replay(ctx context.Context, webhookId uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var replayed int64
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookId == webhookId && delivery.Status == model.DeliveryStatusDead {
+			delivery.Status = model.DeliveryStatusPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = now()
+			replayed++
+		}
+	}
+
+	return replayed, nil
+}
+
+func (r *WebhookRepository) FanOut(ctx context.Context, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	end := len(r.events)
+	if end-r.dispatched > limit {
+		end = r.dispatched + limit
+	}
+
+	for _, event := range r.events[r.dispatched:end] {
+		for id := uint(1); id <= r.lastWebhookId; id++ {
+			webhook, ok := r.webhooks[id]
+			if !ok || !webhook.Accepts(event.Type) {
+				continue
+			}
+
+			r.lastDeliveryId++
+			createdAt := now()
+			r.deliveries = append(r.deliveries, &model.WebhookDelivery{
+				Id:            r.lastDeliveryId,
+				WebhookId:     webhook.Id,
+				Event:         *event,
+				Status:        model.DeliveryStatusPending,
+				NextAttemptAt: createdAt,
+				CreatedAt:     createdAt,
+			})
+		}
+	}
+
+	handled := int64(end - r.dispatched)
+	r.dispatched = end
+
+	return handled, nil
+}
+
+func (r *WebhookRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []*model.WebhookDelivery{}
+	current := now()
+
+	for _, delivery := range r.deliveries {
+		if len(result) >= limit {
+			break
+		}
+		if delivery.Status != model.DeliveryStatusPending || delivery.NextAttemptAt.After(current) {
+			continue
+		}
+
+		delivery.NextAttemptAt = current.Add(lease)
+
+		item := cloneDelivery(delivery)
+		webhook := r.webhooks[delivery.WebhookId]
+		item.Url, item.Secret = webhook.Url, webhook.Secret
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+func (r *WebhookRepository) Complete(
+	ctx context.Context,
+	id uint,
+	attempt model.DeliveryAttempt,
+	status string,
+	nextAttemptAt time.Time,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, delivery := range r.deliveries {
+		if delivery.Id != id {
+			continue
+		}
+
+		delivery.Status = status
+		delivery.Attempts++
+		delivery.NextAttemptAt = nextAttemptAt.Truncate(time.Microsecond)
+		delivery.LastStatusCode = nil
+		if attempt.StatusCode != 0 {
+			statusCode := attempt.StatusCode
+			delivery.LastStatusCode = &statusCode
+		}
+		delivery.LastError = nil
+		if attempt.Error != "" {
+			lastError := attempt.Error
+			delivery.LastError = &lastError
+		}
+		delivery.DeliveredAt = nil
+		if status == model.DeliveryStatusDelivered {
+			deliveredAt := now()
+			delivery.DeliveredAt = &deliveredAt
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// DeleteExpired keeps the outbox ordered, only its oldest events are dropped
+func (r *WebhookRepository) DeleteExpired(ctx context.Context, before time.Time, undispatched bool) (int64, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.deliveries[:0]
+	for _, delivery := range r.deliveries {
+		if delivery.Status == model.DeliveryStatusPending || !delivery.NextAttemptAt.Before(before) {
+			kept = append(kept, delivery)
+		}
+	}
+	deliveries := int64(len(r.deliveries) - len(kept))
+	clear(r.deliveries[len(kept):])
+	r.deliveries = kept
+
+	end := r.dispatched
+	if undispatched {
+		end = len(r.events)
+	}
+
+	events := 0
+	for events < end && r.events[events].CreatedAt.Before(before) {
+		events++
+	}
+	r.events = append([]*model.Event{}, r.events[events:]...)
+	r.dispatched = max(r.dispatched-events, 0)
+
+	return int64(events), deliveries, nil
+}
+
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func clone(webhook *model.Webhook) *model.Webhook {
+	result := *webhook
+	result.EventTypes = append([]string{}, webhook.EventTypes...)
+	return &result
+}
+
+// cloneDelivery shares the event data, it is never modified
+func cloneDelivery(delivery *model.WebhookDelivery) *model.WebhookDelivery {
+	result := *delivery
+	if delivery.LastStatusCode != nil {
+		statusCode := *delivery.LastStatusCode
+		result.LastStatusCode = &statusCode
+	}
+	if delivery.LastError != nil {
+		lastError := *delivery.LastError
+		result.LastError = &lastError
+	}
+	if delivery.DeliveredAt != nil {
+		deliveredAt := *delivery.DeliveredAt
+		result.DeliveredAt = &deliveredAt
+	}
+	return &result
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository(&config.Config{})
+
+	hook, err := repo.Create(ctx, "http://localhost/hook", "secret", nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		repo.Append(&model.Event{Type: model.EventUserCreated})
+	}
+	_, err = repo.FanOut(ctx, 2)
+	require.NoError(t, err)
+
+	deliveries, err := repo.GetDeliveries(ctx, hook.Id, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.NoError(t, repo.Complete(ctx, deliveries[1].Id, model.DeliveryAttempt{StatusCode: 200}, model.DeliveryStatusDelivered, time.Now()))
+
+	events, deleted, err := repo.DeleteExpired(ctx, time.Now().Add(time.Second), false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted, "only the finished delivery")
+	assert.Equal(t, int64(2), events, "only dispatched events")
+
+	// the remaining event is still dispatched next
+	handled, err := repo.FanOut(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), handled)
+
+	repo.Append(&model.Event{Type: model.EventUserCreated})
+
+	events, _, err = repo.DeleteExpired(ctx, time.Now().Add(time.Second), true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), events, "undispatched events too")
+
+	handled, err = repo.FanOut(ctx, 10)
+	require.NoError(t, err)
+	assert.Zero(t, handled)
+}
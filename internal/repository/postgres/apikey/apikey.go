@@ -0,0 +1,211 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// table api_keys:
+// id
+// name
+// prefix
+// key_hash
+// scopes
+// created_at
+// expires_at
+// last_used_at
+// revoked_at
+
+const uniqueViolation = "23505"
+
+type ApiKeyRepository struct {
+	cfg *config.Config
+	db  *pgxpool.Pool
+}
+
+func NewRepository(cfg *config.Config, db *pgxpool.Pool) *ApiKeyRepository {
+	return &ApiKeyRepository{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+func (r *ApiKeyRepository) GetList(ctx context.Context) ([]*model.ApiKey, error) {
+
+	result := []*model.ApiKey{}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	rows, err := r.db.Query(timeoutCtx, `
+		SELECT
+			id,
+			name,
+			prefix,
+			scopes,
+			created_at,
+			expires_at,
+			last_used_at,
+			revoked_at
+		FROM api_keys
+		ORDER BY id ASC;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item model.ApiKey
+
+		err = rows.Scan(
+			&item.Id,
+			&item.Name,
+			&item.Prefix,
+			&item.Scopes,
+			&item.CreatedAt,
+			&item.ExpiresAt,
+			&item.LastUsedAt,
+			&item.RevokedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &item)
+	}
+	return result, rows.Err()
+}
+
+func (r *ApiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.ApiKey, error) {
+	var result model.ApiKey
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRow(timeoutCtx, `
+		SELECT
+			id,
+			name,
+			prefix,
+			scopes,
+			created_at,
+			expires_at,
+			last_used_at,
+			revoked_at
+		FROM api_keys
+		WHERE key_hash = $1;
+	`, keyHash).Scan(
+		&result.Id,
+		&result.Name,
+		&result.Prefix,
+		&result.Scopes,
+		&result.CreatedAt,
+		&result.ExpiresAt,
+		&result.LastUsedAt,
+		&result.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrSqlNoRows
+		}
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (r *ApiKeyRepository) Create(
+	ctx context.Context,
+	name string,
+	prefix string,
+	keyHash string,
+	scopes []string,
+	expiresAt *time.Time,
+) (*model.ApiKey, error) {
+
+	result := model.ApiKey{
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRow(timeoutCtx, `
+		INSERT INTO api_keys (
+			name,
+			prefix,
+			key_hash,
+			scopes,
+			expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at;
+	`,
+		name,
+		prefix,
+		keyHash,
+		scopes,
+		expiresAt,
+	).Scan(
+		&result.Id,
+		&result.CreatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, model.ErrSqlUniqueViolation
+		}
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (r *ApiKeyRepository) Revoke(ctx context.Context, id uint) error {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	tag, err := r.db.Exec(timeoutCtx, `
+		UPDATE api_keys
+		SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL;
+	`,
+		id,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return model.ErrSqlNoRows
+	}
+
+	return nil
+}
+
+// TouchLastUsed updates last_used_at at most once a minute to avoid a write on every request
+func (r *ApiKeyRepository) TouchLastUsed(ctx context.Context, id uint) error {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	_, err := r.db.Exec(timeoutCtx, `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+	`, id)
+	return err
+}
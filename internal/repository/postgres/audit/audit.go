@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// table user_audit, written by the user repository:
+// id
+// user_id
+// operation
+// actor
+// request_id
+// changes
+// created_at
+
+type AuditRepository struct {
+	cfg *config.Config
+	db  *pgxpool.Pool
+}
+
+func NewRepository(cfg *config.Config, db *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+func (r *AuditRepository) GetList(ctx context.Context, params model.AuditListParams) ([]*model.UserAudit, error) {
+
+	result := []*model.UserAudit{}
+
+	where, args := buildListFilter(params)
+	args = append(args, params.Limit)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	rows, err := r.db.Query(timeoutCtx, fmt.Sprintf(`
+		SELECT
+			id,
+			user_id,
+			operation,
+			actor,
+			COALESCE(request_id, ''),
+			changes,
+			created_at
+		FROM user_audit
+		%s
+		ORDER BY id DESC
+		LIMIT $%d;
+	`, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			item    model.UserAudit
+			changes []byte
+		)
+
+		err = rows.Scan(
+			&item.Id,
+			&item.UserId,
+			&item.Operation,
+			&item.Actor,
+			&item.RequestId,
+			&changes,
+			&item.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(changes, &item.Changes)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &item)
+	}
+
+	return result, rows.Err()
+}
+
+// Count ignores params cursor, it returns the total of entries matching the filters
+func (r *AuditRepository) Count(ctx context.Context, params model.AuditListParams) (int64, error) {
+	params.Cursor = nil
+
+	where, args := buildListFilter(params)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var total int64
+
+	err := r.db.QueryRow(timeoutCtx, fmt.Sprintf(`
+		SELECT COUNT(*) FROM user_audit %s;
+	`, where), args...).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func buildListFilter(params model.AuditListParams) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if params.Cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("id < %s", arg(*params.Cursor)))
+	}
+
+	if params.UserId != nil {
+		conditions = append(conditions, fmt.Sprintf("user_id = %s", arg(*params.UserId)))
+	}
+
+	if params.Actor != nil {
+		conditions = append(conditions, fmt.Sprintf("actor = %s", arg(*params.Actor)))
+	}
+
+	if params.Operation != nil {
+		conditions = append(conditions, fmt.Sprintf("operation = %s", arg(*params.Operation)))
+	}
+
+	if params.From != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= %s", arg(*params.From)))
+	}
+
+	if params.To != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at < %s", arg(*params.To)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
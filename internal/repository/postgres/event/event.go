@@ -0,0 +1,58 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Channel is notified by the outbox_notify trigger for every inserted outbox row
+const Channel = "user_events"
+
+type EventRepository struct {
+	cfg *config.Config
+	db  *pgxpool.Pool
+}
+
+func NewRepository(cfg *config.Config, db *pgxpool.Pool) *EventRepository {
+	return &EventRepository{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+// Listen holds a connection of its own for as long as it runs, db timeout doesn't apply.
+// Notifications are delivered on commit, so fn sees events in commit order
+func (r *EventRepository) Listen(ctx context.Context, fn func(event *model.Event)) error {
+	pooled, err := r.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the connection keeps listening, it must not go back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, `LISTEN `+Channel+`;`)
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event model.Event
+		err = json.Unmarshal([]byte(notification.Payload), &event)
+		if err != nil {
+			return err
+		}
+
+		fn(&event)
+	}
+}
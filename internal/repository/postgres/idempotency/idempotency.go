@@ -0,0 +1,188 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// table idempotency_keys:
+// owner
+// key
+// fingerprint
+// status_code
+// response_headers
+// response_body
+// created_at
+// locked_until
+// expires_at
+
+type IdempotencyRepository struct {
+	cfg *config.Config
+	db  *pgxpool.Pool
+}
+
+func NewRepository(cfg *config.Config, db *pgxpool.Pool) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+// Reserve inserts the record or takes over an expired or abandoned one in a single statement,
+// so only one of concurrent requests with the same key gets reserved=true
+func (r *IdempotencyRepository) Reserve(ctx context.Context, record *model.IdempotencyRecord) (*model.IdempotencyRecord, bool, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var createdAt time.Time
+
+	err := r.db.QueryRow(timeoutCtx, `
+		INSERT INTO idempotency_keys (
+			owner,
+			key,
+			fingerprint,
+			locked_until,
+			expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (owner, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+			status_code = NULL,
+			response_headers = NULL,
+			response_body = NULL,
+			created_at = NOW(),
+			locked_until = EXCLUDED.locked_until,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < NOW()
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.locked_until < NOW())
+		RETURNING created_at;
+	`,
+		record.Owner,
+		record.Key,
+		record.Fingerprint,
+		record.LockedUntil,
+		record.ExpiresAt,
+	).Scan(&createdAt)
+	if err == nil {
+		return nil, true, nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+
+	existing, err := r.get(timeoutCtx, record.Owner, record.Key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (r *IdempotencyRepository) get(ctx context.Context, owner string, key string) (*model.IdempotencyRecord, error) {
+	var (
+		result  model.IdempotencyRecord
+		headers []byte
+	)
+
+	err := r.db.QueryRow(ctx, `
+		SELECT
+			owner,
+			key,
+			fingerprint,
+			status_code,
+			response_headers,
+			response_body,
+			created_at,
+			locked_until,
+			expires_at
+		FROM idempotency_keys
+		WHERE owner = $1 AND key = $2;
+	`, owner, key).Scan(
+		&result.Owner,
+		&result.Key,
+		&result.Fingerprint,
+		&result.StatusCode,
+		&headers,
+		&result.Body,
+		&result.CreatedAt,
+		&result.LockedUntil,
+		&result.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrSqlNoRows
+		}
+		return nil, err
+	}
+
+	if len(headers) > 0 {
+		err = json.Unmarshal(headers, &result.Headers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &result, nil
+}
+
+func (r *IdempotencyRepository) Complete(
+	ctx context.Context,
+	owner string,
+	key string,
+	statusCode int,
+	headers map[string]string,
+	body []byte,
+) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	_, err := r.db.Exec(timeoutCtx, `
+		UPDATE idempotency_keys
+		SET status_code = $3,
+			response_headers = $4,
+			response_body = $5
+		WHERE owner = $1 AND key = $2;
+	`,
+		owner,
+		key,
+		statusCode,
+		headers,
+		body,
+	)
+	return err
+}
+
+// Release forgets a reservation whose request failed, so a retry runs it again
+func (r *IdempotencyRepository) Release(ctx context.Context, owner string, key string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	_, err := r.db.Exec(timeoutCtx, `
+		DELETE FROM idempotency_keys
+		WHERE owner = $1 AND key = $2 AND status_code IS NULL;
+	`, owner, key)
+	return err
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	tag, err := r.db.Exec(timeoutCtx, `
+		DELETE FROM idempotency_keys
+		WHERE expires_at < NOW();
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// table rate_limits:
+// key
+// tat
+
+// RateLimitRepository shares the buckets between replicas, the db clock is used so
+// replicas with skewed clocks agree
+type RateLimitRepository struct {
+	cfg *config.Config
+	db  *pgxpool.Pool
+}
+
+func NewRepository(cfg *config.Config, db *pgxpool.Pool) *RateLimitRepository {
+	return &RateLimitRepository{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+// Take moves the theoretical arrival time in a single statement when the bucket has a token,
+// so concurrent requests of a client never spend more than burst
+func (r *RateLimitRepository) Take(ctx context.Context, key string, interval time.Duration, burst int) (*model.RateLimitResult, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var tat, now time.Time
+
+	err := r.db.QueryRow(timeoutCtx, `
+		INSERT INTO rate_limits (key, tat)
+		VALUES ($1, NOW() + $2::float8 * INTERVAL '1 second')
+		ON CONFLICT (key) DO UPDATE
+		SET tat = GREATEST(rate_limits.tat, NOW()) + $2::float8 * INTERVAL '1 second'
+		WHERE GREATEST(rate_limits.tat, NOW()) + $2::float8 * INTERVAL '1 second' <= NOW() + $3::float8 * INTERVAL '1 second'
+		RETURNING tat, NOW();
+	`,
+		key,
+		interval.Seconds(),
+		(time.Duration(burst)*interval).Seconds(),
+	).Scan(&tat, &now)
+	if err == nil {
+		return model.NewRateLimitResult(true, now, tat, interval, burst), nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	err = r.db.QueryRow(timeoutCtx, `
+		SELECT tat, NOW()
+		FROM rate_limits
+		WHERE key = $1;
+	`, key).Scan(&tat, &now)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrSqlNoRows
+		}
+		return nil, err
+	}
+
+	return model.NewRateLimitResult(false, now, tat, interval, burst), nil
+}
+
+// Peek reads the bucket with the db clock like Take, a missing row is a full bucket
+func (r *RateLimitRepository) Peek(ctx context.Context, key string, interval time.Duration, burst int) (*model.RateLimitResult, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var tat, now time.Time
+
+	err := r.db.QueryRow(timeoutCtx, `
+		SELECT GREATEST(COALESCE((SELECT tat FROM rate_limits WHERE key = $1), NOW()), NOW()), NOW();
+	`, key).Scan(&tat, &now)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := tat.Add(interval).Sub(now) <= time.Duration(burst)*interval
+	return model.NewRateLimitResult(allowed, now, tat, interval, burst), nil
+}
+
+// DeleteExpired removes full buckets, they behave the same as missing ones
+func (r *RateLimitRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	tag, err := r.db.Exec(timeoutCtx, `
+		DELETE FROM rate_limits
+		WHERE tat < NOW();
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -3,7 +3,13 @@ package postgres
 import (
 	"gravitum-test-app/config"
 	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/internal/repository/postgres/apikey"
+	"gravitum-test-app/internal/repository/postgres/audit"
+	"gravitum-test-app/internal/repository/postgres/event"
+	"gravitum-test-app/internal/repository/postgres/idempotency"
+	"gravitum-test-app/internal/repository/postgres/ratelimit"
 	"gravitum-test-app/internal/repository/postgres/user"
+	"gravitum-test-app/internal/repository/postgres/webhook"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 )
@@ -11,6 +17,12 @@ import (
 func NewRepository(cfg *config.Config, db *pgxpool.Pool) *repository.Repository {
 
 	return &repository.Repository{
-		User: user.NewRepository(cfg, db),
+		User:        user.NewRepository(cfg, db),
+		Audit:       audit.NewRepository(cfg, db),
+		Webhook:     webhook.NewRepository(cfg, db),
+		Event:       event.NewRepository(cfg, db),
+		ApiKey:      apikey.NewRepository(cfg, db),
+		Idempotency: idempotency.NewRepository(cfg, db),
+		RateLimit:   ratelimit.NewRepository(cfg, db),
 	}
 }
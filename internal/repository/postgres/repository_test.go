@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/migration"
+	"gravitum-test-app/internal/repository/repositorytest"
+	"gravitum-test-app/pkg/logger"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// APP_PROFILE=dev go test -v -run ^TestContract$ ./internal/repository/postgres
+func TestContract(t *testing.T) {
+	err := os.Chdir("../../..") // config/config.yml is resolved from project root
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.App.Profile != "dev" {
+		t.Skip("postgres contract runs with APP_PROFILE=dev only")
+	}
+
+	ctx := context.Background()
+
+	// the contract purges every expired user, so it gets a schema of its own
+	schema := fmt.Sprintf("contract%d", time.Now().UnixNano())
+
+	poolCfg, err := pgxpool.ParseConfig(cfg.GetDbConfig().GetDsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolCfg.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+
+	db, err := pgxpool.ConnectConfig(ctx, poolCfg)
+	if err != nil {
+		t.Fatalf("couldn't instantiate db: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(ctx, `CREATE SCHEMA `+schema+`;`)
+	if err != nil {
+		t.Fatalf("couldn't create schema: %v", err)
+	}
+	defer func() {
+		_, err := db.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE;`)
+		if err != nil {
+			t.Errorf("couldn't drop schema: %v", err)
+		}
+	}()
+
+	migrator, err := migration.New(db, logger.New(logger.GetLevelByString(cfg.Log.Level)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("couldn't apply migrations: %v", err)
+	}
+
+	repositorytest.Run(t, NewRepository(&cfg, db))
+}
@@ -3,20 +3,25 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
 	"gravitum-test-app/config"
 	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/search"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-// table users:
+// table users, every write adds a user_audit row and an outbox event in the same transaction:
 // id
 // name
 // surname
 // inserted_at
 // updated_at
+// deleted_at
+// version
 
 type UserRepository struct {
 	cfg *config.Config
@@ -30,7 +35,7 @@ func NewRepository(cfg *config.Config, db *pgxpool.Pool) *UserRepository {
 	}
 }
 
-func (r *UserRepository) CheckIfExists(ctx context.Context, id uint) (bool, error) {
+func (r *UserRepository) CheckIfExists(ctx context.Context, id uint, includeDeleted bool) (bool, error) {
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
 	defer cancel()
 
@@ -38,9 +43,9 @@ func (r *UserRepository) CheckIfExists(ctx context.Context, id uint) (bool, erro
 
 	err := r.db.QueryRow(timeoutCtx, `
 		SELECT EXISTS(
-			SELECT 1 FROM users WHERE id = $1
+			SELECT 1 FROM users WHERE id = $1 AND ($2 OR deleted_at IS NULL)
 		)
-	`, id).Scan(&exists)
+	`, id, includeDeleted).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
@@ -48,23 +53,45 @@ func (r *UserRepository) CheckIfExists(ctx context.Context, id uint) (bool, erro
 	return exists, nil
 }
 
-func (r *UserRepository) GetList(ctx context.Context) ([]*model.User, error) {
+func (r *UserRepository) GetList(ctx context.Context, params model.UserListParams) ([]*model.User, error) {
 
 	result := []*model.User{}
 
+	where, args, err := buildListFilter(params)
+	if err != nil {
+		return nil, err
+	}
+
+	sortColumn := sortColumns[params.SortBy]
+	direction := "ASC"
+	if params.SortDesc {
+		direction = "DESC"
+	}
+
+	args = append(args, params.Limit)
+	pagination := fmt.Sprintf("LIMIT $%d", len(args))
+	if params.Cursor == nil && params.Offset > 0 {
+		args = append(args, params.Offset)
+		pagination += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
 	defer cancel()
 
-	rows, err := r.db.Query(timeoutCtx, `
+	rows, err := r.db.Query(timeoutCtx, fmt.Sprintf(`
 		SELECT
 			id,
 			name,
 			surname,
 			inserted_at,
-			updated_at
+			updated_at,
+			deleted_at,
+			version
 		FROM users
-		ORDER BY inserted_at ASC;
-	`)
+		%s
+		ORDER BY %s %s, id %s
+		%s;
+	`, where, sortColumn, direction, direction, pagination), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -83,6 +110,8 @@ func (r *UserRepository) GetList(ctx context.Context) ([]*model.User, error) {
 				&item.Surname,
 				&item.InsertedAt,
 				&item.UpdatedAt,
+				&item.DeletedAt,
+				&item.Version,
 			)
 			if err != nil {
 				return nil, err
@@ -94,27 +123,177 @@ func (r *UserRepository) GetList(ctx context.Context) ([]*model.User, error) {
 	return result, rows.Err()
 }
 
-func (r *UserRepository) Get(ctx context.Context, id uint) (*model.User, error) {
-	var result model.User
+// Search uses the users_search_* indexes, the query words become a prefix tsquery
+// and the whole query is compared by pg_trgm word similarity for typos
+func (r *UserRepository) Search(ctx context.Context, params model.UserSearchParams) ([]*model.UserSearchResult, error) {
+	result := []*model.UserSearchResult{}
+
+	tokens := search.Tokens(params.Query)
+	if len(tokens) == 0 {
+		return result, nil
+	}
+
+	prefixes := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		prefixes = append(prefixes, "'"+token+"':*") // tokens hold letters and digits only
+	}
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
 	defer cancel()
 
-	err := r.db.QueryRow(timeoutCtx, `
+	rows, err := r.db.Query(timeoutCtx, `
+		SELECT
+			id,
+			name,
+			surname,
+			inserted_at,
+			updated_at,
+			deleted_at,
+			version,
+			(
+				(to_tsvector('simple', users_search_document(name, surname)) @@ to_tsquery('simple', $1))::int
+				+ word_similarity($2, users_search_document(name, surname))
+			)::float8 AS score
+		FROM users
+		WHERE deleted_at IS NULL
+			AND (
+				to_tsvector('simple', users_search_document(name, surname)) @@ to_tsquery('simple', $1)
+				OR $2 <% users_search_document(name, surname)
+			)
+		ORDER BY score DESC, id
+		LIMIT $3;
+	`, strings.Join(prefixes, " & "), strings.Join(tokens, " "), params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item model.UserSearchResult
+
+		err = rows.Scan(
+			&item.Id,
+			&item.Name,
+			&item.Surname,
+			&item.InsertedAt,
+			&item.UpdatedAt,
+			&item.DeletedAt,
+			&item.Version,
+			&item.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &item)
+	}
+
+	return result, rows.Err()
+}
+
+// Export isn't bound by Db.Timeout, a dump of a large table may take longer, it lasts as long as ctx does.
+// Rows are read off the connection while fn consumes them, so only one user is held in memory
+func (r *UserRepository) Export(ctx context.Context, params model.UserListParams, fn func(user *model.User) error) error {
+	params.Cursor = nil
+
+	where, args, err := buildListFilter(params)
+	if err != nil {
+		return err
+	}
+
+	sortColumn := sortColumns[params.SortBy]
+	direction := "ASC"
+	if params.SortDesc {
+		direction = "DESC"
+	}
+
+	rows, err := r.db.Query(ctx, fmt.Sprintf(`
+		SELECT
+			id,
+			name,
+			surname,
+			inserted_at,
+			updated_at,
+			deleted_at,
+			version
+		FROM users
+		%s
+		ORDER BY %s %s, id %s;
+	`, where, sortColumn, direction, direction), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(user)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Count ignores params pagination, it returns the total of users matching the filters
+func (r *UserRepository) Count(ctx context.Context, params model.UserListParams) (int64, error) {
+	params.Cursor = nil
+
+	where, args, err := buildListFilter(params)
+	if err != nil {
+		return 0, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var total int64
+
+	err = r.db.QueryRow(timeoutCtx, fmt.Sprintf(`
+		SELECT COUNT(*) FROM users %s;
+	`, where), args...).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func (r *UserRepository) Get(ctx context.Context, id uint, includeDeleted bool) (*model.User, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	return scanUser(r.db.QueryRow(timeoutCtx, `
 		SELECT
 			id,
 			name,
 			surname,
 			inserted_at,
-			updated_at
+			updated_at,
+			deleted_at,
+			version
 		FROM users
-		WHERE id = $1;
-	`, id).Scan(
+		WHERE id = $1 AND ($2 OR deleted_at IS NULL);
+	`, id, includeDeleted))
+}
+
+// scanUser reads the columns selected as id, name, surname, inserted_at, updated_at, deleted_at, version
+func scanUser(row pgx.Row) (*model.User, error) {
+	var result model.User
+
+	err := row.Scan(
 		&result.Id,
 		&result.Name,
 		&result.Surname,
 		&result.InsertedAt,
 		&result.UpdatedAt,
+		&result.DeletedAt,
+		&result.Version,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -130,26 +309,151 @@ func (r *UserRepository) Create(
 	ctx context.Context,
 	name string,
 	surname *string,
-) error {
+) (*model.User, error) {
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
 	defer cancel()
 
-	_, err := r.db.Exec(timeoutCtx, `
-		INSERT INTO users (
+	var result *model.User
+
+	err := r.db.BeginFunc(timeoutCtx, func(tx pgx.Tx) error {
+		var err error
+
+		result, err = scanUser(tx.QueryRow(timeoutCtx, `
+			INSERT INTO users (
+				name,
+				surname
+			)
+			VALUES ($1, $2)
+			RETURNING
+				id,
+				name,
+				surname,
+				inserted_at,
+				updated_at,
+				deleted_at,
+				version;
+		`,
 			name,
-			surname
+			surname,
+		))
+		if err != nil {
+			return err
+		}
+
+		return record(timeoutCtx, tx, model.AuditOperationCreate, nil, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CreateBatch streams users with COPY into a temporary table, moves them to users
+// and copies their audit entries and outbox events, the whole batch is a single transaction
+func (r *UserRepository) CreateBatch(ctx context.Context, users []model.NewUser) (int64, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var written int64
+
+	err := r.db.BeginFunc(timeoutCtx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(timeoutCtx, `
+			CREATE TEMPORARY TABLE users_import (
+				ord INTEGER NOT NULL,
+				name VARCHAR(100) NOT NULL,
+				surname VARCHAR(100) NULL
+			) ON COMMIT DROP;
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CopyFrom(
+			timeoutCtx,
+			pgx.Identifier{"users_import"},
+			[]string{"ord", "name", "surname"},
+			pgx.CopyFromSlice(len(users), func(i int) ([]interface{}, error) {
+				return []interface{}{i, users[i].Name, users[i].Surname}, nil
+			}),
 		)
-		VALUES ($1, $2);
-	`,
-		name,
-		surname,
-	)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(timeoutCtx, `
+			INSERT INTO users (
+				name,
+				surname
+			)
+			SELECT name, surname FROM users_import ORDER BY ord
+			RETURNING
+				id,
+				name,
+				surname,
+				inserted_at,
+				updated_at,
+				deleted_at,
+				version;
+		`)
+		if err != nil {
+			return err
+		}
+
+		created := make([]*model.User, 0, len(users))
+		for rows.Next() {
+			user, err := scanUser(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			created = append(created, user)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		var requestId interface{}
+		if id := model.RequestIdFromContext(ctx); id != "" {
+			requestId = id
+		}
+
+		_, err = tx.CopyFrom(
+			timeoutCtx,
+			pgx.Identifier{"user_audit"},
+			[]string{"user_id", "operation", "actor", "request_id", "changes"},
+			pgx.CopyFromSlice(len(created), func(i int) ([]interface{}, error) {
+				entry := model.NewUserAudit(ctx, model.AuditOperationCreate, nil, created[i])
+				return []interface{}{entry.UserId, entry.Operation, entry.Actor, requestId, entry.Changes}, nil
+			}),
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CopyFrom(
+			timeoutCtx,
+			pgx.Identifier{"outbox"},
+			[]string{"event_type", "payload"},
+			pgx.CopyFromSlice(len(created), func(i int) ([]interface{}, error) {
+				event := model.NewUserEvent(model.AuditOperationCreate, created[i])
+				return []interface{}{event.Type, event.Data}, nil
+			}),
+		)
+		if err != nil {
+			return err
+		}
+
+		written = int64(len(created))
+		return nil
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return written, nil
 }
 
 func (r *UserRepository) Update(
@@ -157,26 +461,358 @@ func (r *UserRepository) Update(
 	id uint,
 	name string,
 	surname *string,
-) error {
+	version uint,
+) (*model.User, error) {
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
 	defer cancel()
 
-	_, err := r.db.Exec(timeoutCtx, `
+	var result *model.User
+
+	err := r.db.BeginFunc(timeoutCtx, func(tx pgx.Tx) error {
+		before, err := lockUser(timeoutCtx, tx, id, false, version)
+		if err != nil {
+			return err
+		}
+
+		result, err = scanUser(tx.QueryRow(timeoutCtx, `
 			UPDATE users
 			SET name = $2,
 				surname = $3,
-				updated_at = $4
-			WHERE id = $1;
+				updated_at = $4,
+				version = version + 1
+			WHERE id = $1
+			RETURNING
+				id,
+				name,
+				surname,
+				inserted_at,
+				updated_at,
+				deleted_at,
+				version;
 		`,
-		id,
-		name,
-		surname,
-		time.Now(),
+			id,
+			name,
+			surname,
+			time.Now(),
+		))
+		if err != nil {
+			return err
+		}
+
+		return record(timeoutCtx, tx, model.AuditOperationUpdate, before, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Patch writes only the changed columns and bumps updated_at, deleted users are not patched
+func (r *UserRepository) Patch(ctx context.Context, id uint, changes model.UserChanges, version uint) (*model.User, error) {
+	if changes.IsEmpty() {
+		return r.Get(ctx, id, false)
+	}
+
+	var (
+		columns []string
+		args    = []interface{}{id}
+	)
+
+	if changes.Name != nil {
+		args = append(args, *changes.Name)
+		columns = append(columns, fmt.Sprintf("name = $%d", len(args)))
+	}
+
+	if changes.SurnameSet {
+		args = append(args, changes.Surname)
+		columns = append(columns, fmt.Sprintf("surname = $%d", len(args)))
+	}
+
+	args = append(args, time.Now())
+	columns = append(columns, fmt.Sprintf("updated_at = $%d", len(args)), "version = version + 1")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var result *model.User
+
+	err := r.db.BeginFunc(timeoutCtx, func(tx pgx.Tx) error {
+		before, err := lockUser(timeoutCtx, tx, id, false, version)
+		if err != nil {
+			return err
+		}
+
+		result, err = scanUser(tx.QueryRow(timeoutCtx, fmt.Sprintf(`
+			UPDATE users
+			SET %s
+			WHERE id = $1
+			RETURNING
+				id,
+				name,
+				surname,
+				inserted_at,
+				updated_at,
+				deleted_at,
+				version;
+		`, strings.Join(columns, ", ")), args...))
+		if err != nil {
+			return err
+		}
+
+		return record(timeoutCtx, tx, model.AuditOperationUpdate, before, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id uint, version uint) error {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	return r.db.BeginFunc(timeoutCtx, func(tx pgx.Tx) error {
+		before, err := lockUser(timeoutCtx, tx, id, false, version)
+		if err != nil {
+			return err
+		}
+
+		after, err := scanUser(tx.QueryRow(timeoutCtx, `
+			UPDATE users
+			SET deleted_at = $2,
+				version = version + 1
+			WHERE id = $1
+			RETURNING
+				id,
+				name,
+				surname,
+				inserted_at,
+				updated_at,
+				deleted_at,
+				version;
+		`,
+			id,
+			time.Now(),
+		))
+		if err != nil {
+			return err
+		}
+
+		return record(timeoutCtx, tx, model.AuditOperationDelete, before, after)
+	})
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id uint) error {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	return r.db.BeginFunc(timeoutCtx, func(tx pgx.Tx) error {
+		before, err := lockUser(timeoutCtx, tx, id, true, 0)
+		if err != nil {
+			return err
+		}
+
+		after, err := scanUser(tx.QueryRow(timeoutCtx, `
+			UPDATE users
+			SET deleted_at = NULL,
+				version = version + 1
+			WHERE id = $1
+			RETURNING
+				id,
+				name,
+				surname,
+				inserted_at,
+				updated_at,
+				deleted_at,
+				version;
+		`, id))
+		if err != nil {
+			return err
+		}
+
+		return record(timeoutCtx, tx, model.AuditOperationRestore, before, after)
+	})
+}
+
+// Purge writes a purge audit entry for every deleted row in the same statement, purge emits no event
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	tag, err := r.db.Exec(timeoutCtx, `
+		WITH purged AS (
+			DELETE FROM users
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			RETURNING id, name, surname, deleted_at
+		)
+		INSERT INTO user_audit (user_id, operation, actor, request_id, changes)
+		SELECT
+			id,
+			$2::text,
+			$3::text,
+			NULLIF($4::text, ''),
+			jsonb_build_object(
+				'name', jsonb_build_object('before', name, 'after', NULL),
+				'deleted_at', jsonb_build_object(
+					'before', to_char(deleted_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+					'after', NULL
+				)
+			)
+				|| CASE WHEN surname IS NULL THEN '{}'::jsonb
+					ELSE jsonb_build_object('surname', jsonb_build_object('before', surname, 'after', NULL)) END
+		FROM purged;
+	`, deletedBefore, model.AuditOperationPurge, model.ActorFromContext(ctx), model.RequestIdFromContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// lockUser reads the user FOR UPDATE, so the version check and the following write are atomic.
+// deleted selects soft deleted users instead of active ones, version 0 skips the check
+func lockUser(ctx context.Context, tx pgx.Tx, id uint, deleted bool, version uint) (*model.User, error) {
+	user, err := scanUser(tx.QueryRow(ctx, `
+		SELECT
+			id,
+			name,
+			surname,
+			inserted_at,
+			updated_at,
+			deleted_at,
+			version
+		FROM users
+		WHERE id = $1 AND (deleted_at IS NOT NULL) = $2
+		FOR UPDATE;
+	`, id, deleted))
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && user.Version != version {
+		return nil, model.ErrUserVersionMismatch
+	}
+
+	return user, nil
+}
+
+// record writes the audit entry and the outbox event of a write in its transaction,
+// actor and request id are taken from ctx
+func record(ctx context.Context, tx pgx.Tx, operation string, before *model.User, after *model.User) error {
+	entry := model.NewUserAudit(ctx, operation, before, after)
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO user_audit (user_id, operation, actor, request_id, changes)
+		VALUES ($1, $2, $3, NULLIF($4::text, ''), $5);
+	`,
+		entry.UserId,
+		entry.Operation,
+		entry.Actor,
+		entry.RequestId,
+		entry.Changes,
 	)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	event := model.NewUserEvent(operation, after)
+	if event == nil {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO outbox (event_type, payload)
+		VALUES ($1, $2);
+	`, event.Type, event.Data)
+	return err
+}
+
+// sort expressions must be NOT NULL for keyset comparison to work
+var sortColumns = map[string]string{
+	model.UserSortId:         "id",
+	model.UserSortName:       "name",
+	model.UserSortSurname:    "COALESCE(surname, '')",
+	model.UserSortInsertedAt: "inserted_at",
+	model.UserSortUpdatedAt:  "COALESCE(updated_at, 'epoch'::timestamptz)",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func buildListFilter(params model.UserListParams) (string, []interface{}, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !params.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if params.NamePrefix != nil {
+		prefix := likeEscaper.Replace(strings.ToLower(*params.NamePrefix)) + "%"
+		conditions = append(conditions, fmt.Sprintf("lower(name) LIKE %s", arg(prefix)))
+	}
+
+	if params.HasSurname != nil {
+		if *params.HasSurname {
+			conditions = append(conditions, "(surname IS NOT NULL AND surname <> '')")
+		} else {
+			conditions = append(conditions, "(surname IS NULL OR surname = '')")
+		}
+	}
+
+	if params.InsertedFrom != nil {
+		conditions = append(conditions, fmt.Sprintf("inserted_at >= %s", arg(*params.InsertedFrom)))
+	}
+
+	if params.InsertedTo != nil {
+		conditions = append(conditions, fmt.Sprintf("inserted_at < %s", arg(*params.InsertedTo)))
+	}
+
+	if params.Cursor != nil {
+		operator := ">"
+		if params.SortDesc {
+			operator = "<"
+		}
+
+		switch params.SortBy {
+		case model.UserSortId:
+			conditions = append(conditions, fmt.Sprintf("id %s %s::int", operator, arg(params.Cursor.Id)))
+		case model.UserSortName, model.UserSortSurname:
+			conditions = append(conditions, fmt.Sprintf(
+				"(%s, id) %s (%s::text, %s::int)",
+				sortColumns[params.SortBy], operator, arg(params.Cursor.Value), arg(params.Cursor.Id),
+			))
+		case model.UserSortInsertedAt, model.UserSortUpdatedAt:
+			value := time.Unix(0, 0).UTC()
+			if params.Cursor.Value != "" {
+				parsed, err := time.Parse(time.RFC3339Nano, params.Cursor.Value)
+				if err != nil {
+					return "", nil, model.ErrRequestInvalidCursor
+				}
+				value = parsed
+			}
+			conditions = append(conditions, fmt.Sprintf(
+				"(%s, id) %s (%s::timestamptz, %s::int)",
+				sortColumns[params.SortBy], operator, arg(value), arg(params.Cursor.Id),
+			))
+		default:
+			return "", nil, model.ErrRequestInvalidCursor
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
 }
@@ -0,0 +1,428 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// table webhooks:
+// id
+// url
+// secret
+// event_types
+// created_at
+
+// table webhook_deliveries:
+// id
+// webhook_id
+// event_id
+// status
+// attempts
+// next_attempt_at
+// last_status_code
+// last_error
+// delivered_at
+// created_at
+
+// table outbox, written by the user repository:
+// id
+// event_type
+// payload
+// created_at
+// dispatched_at
+
+type WebhookRepository struct {
+	cfg *config.Config
+	db  *pgxpool.Pool
+}
+
+func NewRepository(cfg *config.Config, db *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{
+		cfg: cfg,
+		db:  db,
+	}
+}
+
+func (r *WebhookRepository) GetList(ctx context.Context) ([]*model.Webhook, error) {
+
+	result := []*model.Webhook{}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	rows, err := r.db.Query(timeoutCtx, `
+		SELECT
+			id,
+			url,
+			event_types,
+			created_at
+		FROM webhooks
+		ORDER BY id ASC;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item model.Webhook
+
+		err = rows.Scan(
+			&item.Id,
+			&item.Url,
+			&item.EventTypes,
+			&item.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &item)
+	}
+	return result, rows.Err()
+}
+
+func (r *WebhookRepository) Get(ctx context.Context, id uint) (*model.Webhook, error) {
+	var result model.Webhook
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRow(timeoutCtx, `
+		SELECT
+			id,
+			url,
+			secret,
+			event_types,
+			created_at
+		FROM webhooks
+		WHERE id = $1;
+	`, id).Scan(
+		&result.Id,
+		&result.Url,
+		&result.Secret,
+		&result.EventTypes,
+		&result.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrSqlNoRows
+		}
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, url string, secret string, eventTypes []string) (*model.Webhook, error) {
+
+	result := model.Webhook{
+		Url:        url,
+		Secret:     secret,
+		EventTypes: eventTypes,
+	}
+	if result.EventTypes == nil {
+		result.EventTypes = []string{}
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	err := r.db.QueryRow(timeoutCtx, `
+		INSERT INTO webhooks (
+			url,
+			secret,
+			event_types
+		)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at;
+	`,
+		result.Url,
+		result.Secret,
+		result.EventTypes,
+	).Scan(&result.Id, &result.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Delete removes the webhook with its deliveries
+func (r *WebhookRepository) Delete(ctx context.Context, id uint) error {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	tag, err := r.db.Exec(timeoutCtx, `
+		DELETE FROM webhooks WHERE id = $1;
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return model.ErrSqlNoRows
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, webhookId uint, status *string, limit uint) ([]*model.WebhookDelivery, error) {
+
+	result := []*model.WebhookDelivery{}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	rows, err := r.db.Query(timeoutCtx, `
+		SELECT
+			d.id,
+			d.webhook_id,
+			d.status,
+			d.attempts,
+			d.next_attempt_at,
+			d.last_status_code,
+			d.last_error,
+			d.delivered_at,
+			d.created_at,
+			o.id,
+			o.event_type,
+			o.payload,
+			o.created_at
+		FROM webhook_deliveries d
+		JOIN outbox o ON o.id = d.event_id
+		WHERE d.webhook_id = $1 AND ($2::text IS NULL OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT $3;
+	`, webhookId, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, item)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *WebhookRepository) Replay(ctx context.Context, webhookId uint) (int64, error) {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	tag, err := r.db.Exec(timeoutCtx, `
+		UPDATE webhook_deliveries
+		SET status = $2,
+			attempts = 0,
+			next_attempt_at = NOW()
+		WHERE webhook_id = $1 AND status = $3;
+	`, webhookId, model.DeliveryStatusPending, model.DeliveryStatusDead)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// FanOut locks the events with SKIP LOCKED, so dispatchers of several instances share the outbox
+func (r *WebhookRepository) FanOut(ctx context.Context, limit int) (int64, error) {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	tag, err := r.db.Exec(timeoutCtx, `
+		WITH events AS (
+			SELECT id, event_type
+			FROM outbox
+			WHERE dispatched_at IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), queued AS (
+			INSERT INTO webhook_deliveries (webhook_id, event_id)
+			SELECT w.id, e.id
+			FROM events e
+			JOIN webhooks w ON cardinality(w.event_types) = 0 OR e.event_type = ANY(w.event_types)
+			ON CONFLICT (webhook_id, event_id) DO NOTHING
+		)
+		UPDATE outbox
+		SET dispatched_at = NOW()
+		WHERE id IN (SELECT id FROM events);
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (r *WebhookRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+
+	result := []*model.WebhookDelivery{}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	rows, err := r.db.Query(timeoutCtx, `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $3)
+		FROM outbox o, webhooks w
+		WHERE d.id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+			AND o.id = d.event_id
+			AND w.id = d.webhook_id
+		RETURNING
+			d.id,
+			d.webhook_id,
+			d.status,
+			d.attempts,
+			d.next_attempt_at,
+			d.last_status_code,
+			d.last_error,
+			d.delivered_at,
+			d.created_at,
+			o.id,
+			o.event_type,
+			o.payload,
+			o.created_at,
+			w.url,
+			w.secret;
+	`, model.DeliveryStatusPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanDelivery(rows, true)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, item)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *WebhookRepository) Complete(
+	ctx context.Context,
+	id uint,
+	attempt model.DeliveryAttempt,
+	status string,
+	nextAttemptAt time.Time,
+) error {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	_, err := r.db.Exec(timeoutCtx, `
+		UPDATE webhook_deliveries
+		SET status = $2::text,
+			attempts = attempts + 1,
+			next_attempt_at = $3,
+			last_status_code = NULLIF($4::int, 0),
+			last_error = NULLIF($5::text, ''),
+			delivered_at = CASE WHEN $2::text = $6::text THEN NOW() END
+		WHERE id = $1;
+	`,
+		id,
+		status,
+		nextAttemptAt,
+		attempt.StatusCode,
+		attempt.Error,
+		model.DeliveryStatusDelivered,
+	)
+	return err
+}
+
+// DeleteExpired runs in one transaction, deliveries go first so the events they referenced can follow
+func (r *WebhookRepository) DeleteExpired(ctx context.Context, before time.Time, undispatched bool) (int64, int64, error) {
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(r.cfg.Db.Timeout)*time.Second)
+	defer cancel()
+
+	var events, deliveries int64
+
+	err := r.db.BeginFunc(timeoutCtx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(timeoutCtx, `
+			DELETE FROM webhook_deliveries
+			WHERE status <> $2 AND next_attempt_at < $1;
+		`, before, model.DeliveryStatusPending)
+		if err != nil {
+			return err
+		}
+		deliveries = tag.RowsAffected()
+
+		tag, err = tx.Exec(timeoutCtx, `
+			DELETE FROM outbox o
+			WHERE o.created_at < $1
+				AND (o.dispatched_at IS NOT NULL OR $2)
+				AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = o.id);
+		`, before, undispatched)
+		if err != nil {
+			return err
+		}
+		events = tag.RowsAffected()
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return events, deliveries, nil
+}
+
+// scanDelivery reads the delivery and event columns, claimed rows also carry url and secret
+func scanDelivery(row pgx.Row, claimed bool) (*model.WebhookDelivery, error) {
+	var (
+		result model.WebhookDelivery
+		dest   = []interface{}{
+			&result.Id,
+			&result.WebhookId,
+			&result.Status,
+			&result.Attempts,
+			&result.NextAttemptAt,
+			&result.LastStatusCode,
+			&result.LastError,
+			&result.DeliveredAt,
+			&result.CreatedAt,
+			&result.Event.Id,
+			&result.Event.Type,
+			&result.Event.Data,
+			&result.Event.CreatedAt,
+		}
+	)
+
+	if claimed {
+		dest = append(dest, &result.Url, &result.Secret)
+	}
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
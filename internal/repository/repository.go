@@ -3,28 +3,161 @@ package repository
 import (
 	"context"
 	"gravitum-test-app/internal/model"
+	memoryapikey "gravitum-test-app/internal/repository/memory/apikey"
+	memoryaudit "gravitum-test-app/internal/repository/memory/audit"
+	memoryidempotency "gravitum-test-app/internal/repository/memory/idempotency"
+	memoryratelimit "gravitum-test-app/internal/repository/memory/ratelimit"
+	memoryuser "gravitum-test-app/internal/repository/memory/user"
+	memorywebhook "gravitum-test-app/internal/repository/memory/webhook"
+	"gravitum-test-app/internal/repository/postgres/apikey"
+	"gravitum-test-app/internal/repository/postgres/audit"
+	"gravitum-test-app/internal/repository/postgres/event"
+	"gravitum-test-app/internal/repository/postgres/idempotency"
+	"gravitum-test-app/internal/repository/postgres/ratelimit"
 	"gravitum-test-app/internal/repository/postgres/user"
+	"gravitum-test-app/internal/repository/postgres/webhook"
+	"time"
 )
 
 type UserRepository interface {
-	CheckIfExists(ctx context.Context, id uint) (bool, error)
-	Get(ctx context.Context, id uint) (*model.User, error)
-	GetList(ctx context.Context) ([]*model.User, error)
+	CheckIfExists(ctx context.Context, id uint, includeDeleted bool) (bool, error)
+	Get(ctx context.Context, id uint, includeDeleted bool) (*model.User, error)
+	// Search ranks active users by full-text match of the query words as prefixes plus trigram
+	// word similarity, users matching neither are left out. Highlight is left empty
+	Search(ctx context.Context, params model.UserSearchParams) ([]*model.UserSearchResult, error)
+	// Export calls fn for every user matching the list filters in list order, pagination is ignored.
+	// Users are read as fn consumes them, an error of fn stops the export and is returned
+	Export(ctx context.Context, params model.UserListParams, fn func(user *model.User) error) error
+	GetList(ctx context.Context, params model.UserListParams) ([]*model.User, error)
+	Count(ctx context.Context, params model.UserListParams) (int64, error)
 	Create(
 		ctx context.Context,
 		name string,
 		surname *string,
-	) error
+	) (*model.User, error)
+	// CreateBatch inserts all users or none of them, it returns the number of rows written
+	CreateBatch(ctx context.Context, users []model.NewUser) (int64, error)
+	// version 0 writes unconditionally, otherwise ErrUserVersionMismatch is returned
+	// when the stored version differs, the check and the write are atomic
 	Update(
 		ctx context.Context,
 		id uint,
 		name string,
 		surname *string,
+		version uint,
+	) (*model.User, error)
+	Patch(ctx context.Context, id uint, changes model.UserChanges, version uint) (*model.User, error)
+	Delete(ctx context.Context, id uint, version uint) error
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+// AuditRepository reads the audit log, entries are written by UserRepository
+// in the same transaction as the user
+type AuditRepository interface {
+	// GetList returns entries newest first, only the ones older than params.Cursor when it is set
+	GetList(ctx context.Context, params model.AuditListParams) ([]*model.UserAudit, error)
+	Count(ctx context.Context, params model.AuditListParams) (int64, error)
+}
+
+// WebhookRepository manages subscriptions and moves outbox events to their deliveries,
+// events are written by UserRepository in the same transaction as the user
+type WebhookRepository interface {
+	GetList(ctx context.Context) ([]*model.Webhook, error)
+	// Get returns the webhook with its secret
+	Get(ctx context.Context, id uint) (*model.Webhook, error)
+	Create(ctx context.Context, url string, secret string, eventTypes []string) (*model.Webhook, error)
+	Delete(ctx context.Context, id uint) error
+	// GetDeliveries lists deliveries of the webhook newest first, status nil lists all of them
+	GetDeliveries(ctx context.Context, webhookId uint, status *string, limit uint) ([]*model.WebhookDelivery, error)
+	// Replay moves dead deliveries of the webhook back to pending with attempts reset
+	Replay(ctx context.Context, webhookId uint) (int64, error)
+	// FanOut queues up to limit outbox events for every webhook subscribed to them,
+	// an event is queued once, it returns the number of events handled
+	FanOut(ctx context.Context, limit int) (int64, error)
+	// Claim returns up to limit pending deliveries that are due with their event, url and secret,
+	// they are postponed by lease so concurrent dispatchers skip them
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*model.WebhookDelivery, error)
+	// Complete records an attempt, increments attempts and moves the delivery to status,
+	// nextAttemptAt is used for pending ones
+	Complete(ctx context.Context, id uint, attempt model.DeliveryAttempt, status string, nextAttemptAt time.Time) error
+	// DeleteExpired removes deliveries finished before before and dispatched events created before it
+	// which no delivery refers to any more, undispatched also removes events never dispatched.
+	// It returns the number of events and deliveries deleted
+	DeleteExpired(ctx context.Context, before time.Time, undispatched bool) (int64, int64, error)
+}
+
+// EventRepository follows outbox events as they are committed, for postgres
+// the ones written by every instance of the app
+type EventRepository interface {
+	// Listen calls fn for every event committed after it started, it blocks until ctx
+	// is cancelled or the connection fails and returns the error
+	Listen(ctx context.Context, fn func(event *model.Event)) error
+}
+
+type ApiKeyRepository interface {
+	GetList(ctx context.Context) ([]*model.ApiKey, error)
+	GetByHash(ctx context.Context, keyHash string) (*model.ApiKey, error)
+	Create(
+		ctx context.Context,
+		name string,
+		prefix string,
+		keyHash string,
+		scopes []string,
+		expiresAt *time.Time,
+	) (*model.ApiKey, error)
+	Revoke(ctx context.Context, id uint) error
+	TouchLastUsed(ctx context.Context, id uint) error
+}
+
+type IdempotencyRepository interface {
+	// Reserve stores the record unless a not expired one with the same owner and key exists,
+	// that one is returned with reserved=false. An abandoned record is taken over like an expired one
+	Reserve(ctx context.Context, record *model.IdempotencyRecord) (existing *model.IdempotencyRecord, reserved bool, err error)
+	Complete(
+		ctx context.Context,
+		owner string,
+		key string,
+		statusCode int,
+		headers map[string]string,
+		body []byte,
 	) error
+	Release(ctx context.Context, owner string, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// RateLimitRepository keeps a token bucket per key as its theoretical arrival time (GCRA),
+// the time the bucket is full again, a bucket without a row is full
+type RateLimitRepository interface {
+	// Take spends a token when the bucket has one, interval is the time a token takes to refill.
+	// The check and the write are atomic
+	Take(ctx context.Context, key string, interval time.Duration, burst int) (*model.RateLimitResult, error)
+	// Peek tells if Take would be allowed without spending a token, a missing bucket is full
+	Peek(ctx context.Context, key string, interval time.Duration, burst int) (*model.RateLimitResult, error)
+	DeleteExpired(ctx context.Context) (int64, error)
 }
 
 type Repository struct {
-	User UserRepository
+	User        UserRepository
+	Audit       AuditRepository
+	Webhook     WebhookRepository
+	Event       EventRepository
+	ApiKey      ApiKeyRepository
+	Idempotency IdempotencyRepository
+	RateLimit   RateLimitRepository
 }
 
 var _ UserRepository = (*user.UserRepository)(nil)
+var _ AuditRepository = (*audit.AuditRepository)(nil)
+var _ WebhookRepository = (*webhook.WebhookRepository)(nil)
+var _ EventRepository = (*event.EventRepository)(nil)
+var _ ApiKeyRepository = (*apikey.ApiKeyRepository)(nil)
+var _ IdempotencyRepository = (*idempotency.IdempotencyRepository)(nil)
+var _ RateLimitRepository = (*ratelimit.RateLimitRepository)(nil)
+var _ UserRepository = (*memoryuser.UserRepository)(nil)
+var _ AuditRepository = (*memoryaudit.AuditRepository)(nil)
+var _ WebhookRepository = (*memorywebhook.WebhookRepository)(nil)
+var _ EventRepository = (*memorywebhook.WebhookRepository)(nil)
+var _ ApiKeyRepository = (*memoryapikey.ApiKeyRepository)(nil)
+var _ IdempotencyRepository = (*memoryidempotency.IdempotencyRepository)(nil)
+var _ RateLimitRepository = (*memoryratelimit.RateLimitRepository)(nil)
@@ -0,0 +1,952 @@
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run is the contract every repository implementation must satisfy.
+// Rows are namespaced by a unique name prefix, purges are not, so a shared database
+// must give the contract a schema of its own.
+func Run(t *testing.T, repo *repository.Repository) {
+	t.Run("UserCreateGet", func(t *testing.T) { testUserCreateGet(t, repo.User) })
+	t.Run("UserCreateBatch", func(t *testing.T) { testUserCreateBatch(t, repo.User) })
+	t.Run("UserUpdate", func(t *testing.T) { testUserUpdate(t, repo.User) })
+	t.Run("UserPatch", func(t *testing.T) { testUserPatch(t, repo.User) })
+	t.Run("UserList", func(t *testing.T) { testUserList(t, repo.User) })
+	t.Run("UserSearch", func(t *testing.T) { testUserSearch(t, repo.User) })
+	t.Run("UserExport", func(t *testing.T) { testUserExport(t, repo.User) })
+	t.Run("UserSoftDelete", func(t *testing.T) { testUserSoftDelete(t, repo.User) })
+	t.Run("UserPurge", func(t *testing.T) { testUserPurge(t, repo.User) })
+	t.Run("Audit", func(t *testing.T) { testAudit(t, repo.User, repo.Audit) })
+	t.Run("Webhook", func(t *testing.T) { testWebhook(t, repo.User, repo.Webhook) })
+	t.Run("ApiKey", func(t *testing.T) { testApiKey(t, repo.ApiKey) })
+	t.Run("Idempotency", func(t *testing.T) { testIdempotency(t, repo.Idempotency) })
+	t.Run("RateLimit", func(t *testing.T) { testRateLimit(t, repo.RateLimit) })
+}
+
+func uniquePrefix() string {
+	return fmt.Sprintf("contract%d", time.Now().UnixNano())
+}
+
+func createUser(t *testing.T, repo repository.UserRepository, name string, surname *string) *model.User {
+	ctx := context.Background()
+
+	user, err := repo.Create(ctx, name, surname)
+	require.NoError(t, err)
+
+	stored, err := repo.Get(ctx, user.Id, false)
+	require.NoError(t, err)
+	require.Equal(t, stored, user, "create must return the stored row")
+
+	return user
+}
+
+func listParams(prefix string) model.UserListParams {
+	return model.UserListParams{
+		Limit:      100,
+		SortBy:     model.UserSortId,
+		NamePrefix: &prefix,
+	}
+}
+
+func testUserCreateGet(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+	surname := "smith"
+
+	before := time.Now().Add(-time.Second)
+	first := createUser(t, repo, prefix+"a", &surname)
+	second := createUser(t, repo, prefix+"b", nil)
+
+	assert.Greater(t, second.Id, first.Id, "ids must auto increment")
+	assert.True(t, first.InsertedAt.After(before), "inserted_at must be set")
+	assert.Nil(t, first.UpdatedAt, "updated_at must be empty after create")
+	assert.Nil(t, first.DeletedAt, "deleted_at must be empty after create")
+	assert.Equal(t, uint(1), first.Version, "version must start at 1")
+	assert.Nil(t, second.Surname, "surname must stay nil")
+
+	user, err := repo.Get(ctx, first.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, prefix+"a", user.Name)
+	require.NotNil(t, user.Surname)
+	assert.Equal(t, surname, *user.Surname)
+	assert.True(t, user.InsertedAt.Equal(first.InsertedAt))
+
+	exists, err := repo.CheckIfExists(ctx, first.Id, false)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	missing := second.Id + 1_000_000
+
+	exists, err = repo.CheckIfExists(ctx, missing, true)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = repo.Get(ctx, missing, true)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows)
+}
+
+func testUserCreateBatch(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+	surname := "smith"
+
+	written, err := repo.CreateBatch(ctx, []model.NewUser{
+		{Name: prefix + "a", Surname: &surname},
+		{Name: prefix + "b"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), written)
+
+	list, err := repo.GetList(ctx, listParams(prefix))
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	assert.Equal(t, prefix+"a", list[0].Name)
+	require.NotNil(t, list[0].Surname)
+	assert.Equal(t, surname, *list[0].Surname)
+	assert.Nil(t, list[1].Surname, "surname must stay nil")
+	assert.Less(t, list[0].Id, list[1].Id, "ids must follow the batch order")
+
+	for _, user := range list {
+		assert.Equal(t, uint(1), user.Version, "version must start at 1")
+		assert.False(t, user.InsertedAt.IsZero(), "inserted_at must be set")
+	}
+
+	written, err = repo.CreateBatch(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), written, "empty batch")
+}
+
+func testUserUpdate(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+	surname := "smith"
+
+	user := createUser(t, repo, prefix+"a", &surname)
+
+	updated, err := repo.Update(ctx, user.Id, prefix+"b", nil, 0)
+	require.NoError(t, err)
+
+	stored, err := repo.Get(ctx, user.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, stored, updated, "update must return the stored row")
+	assert.Equal(t, prefix+"b", updated.Name)
+	assert.Nil(t, updated.Surname, "surname must be cleared")
+	require.NotNil(t, updated.UpdatedAt, "updated_at must be set")
+	assert.False(t, updated.UpdatedAt.Before(updated.InsertedAt))
+	assert.True(t, updated.InsertedAt.Equal(user.InsertedAt), "inserted_at must not change")
+	assert.Equal(t, user.Version+1, updated.Version, "version must be incremented")
+
+	// conditional writes
+	_, err = repo.Update(ctx, user.Id, prefix+"c", nil, user.Version)
+	assert.ErrorIs(t, err, model.ErrUserVersionMismatch, "stale version must be rejected")
+
+	_, err = repo.Patch(ctx, user.Id, model.UserChanges{Name: &surname}, user.Version)
+	assert.ErrorIs(t, err, model.ErrUserVersionMismatch, "stale version must be rejected")
+
+	err = repo.Delete(ctx, user.Id, user.Version)
+	assert.ErrorIs(t, err, model.ErrUserVersionMismatch, "stale version must be rejected")
+
+	_, err = repo.Update(ctx, user.Id, prefix+"c", nil, updated.Version)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, user.Id, updated.Version+1)
+	require.NoError(t, err)
+
+	_, err = repo.Update(ctx, user.Id, prefix+"d", nil, updated.Version+2)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows, "deleted user must not be updated")
+}
+
+func testUserPatch(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+	surname := "smith"
+
+	user := createUser(t, repo, prefix+"a", &surname)
+
+	unchanged, err := repo.Patch(ctx, user.Id, model.UserChanges{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, user, unchanged, "empty patch must return the user as is")
+
+	name := prefix + "b"
+	patched, err := repo.Patch(ctx, user.Id, model.UserChanges{Name: &name}, 0)
+	require.NoError(t, err)
+
+	stored, err := repo.Get(ctx, user.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, stored, patched, "patch must return the stored row")
+	assert.Equal(t, name, patched.Name)
+	require.NotNil(t, patched.Surname, "surname must not change")
+	assert.Equal(t, surname, *patched.Surname)
+	assert.NotNil(t, patched.UpdatedAt, "updated_at must be set")
+
+	patched, err = repo.Patch(ctx, user.Id, model.UserChanges{SurnameSet: true}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, name, patched.Name, "name must not change")
+	assert.Nil(t, patched.Surname, "surname must be cleared")
+
+	err = repo.Delete(ctx, user.Id, 0)
+	require.NoError(t, err)
+
+	_, err = repo.Patch(ctx, user.Id, model.UserChanges{Name: &name}, 0)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows, "deleted user must not be patched")
+}
+
+func testUserList(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+	surname := "smith"
+
+	c := createUser(t, repo, prefix+"c", &surname)
+	a := createUser(t, repo, prefix+"a", nil)
+	b := createUser(t, repo, prefix+"b", &surname)
+
+	params := listParams(prefix)
+
+	total, err := repo.Count(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+
+	list, err := repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{c.Id, a.Id, b.Id}, ids(list), "sort by id")
+
+	params.SortBy = model.UserSortName
+	list, err = repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{a.Id, b.Id, c.Id}, ids(list), "sort by name")
+
+	params.SortDesc = true
+	list, err = repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{c.Id, b.Id, a.Id}, ids(list), "sort by name desc")
+
+	params.SortBy = model.UserSortSurname
+	params.SortDesc = false
+	list, err = repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{a.Id, c.Id, b.Id}, ids(list), "sort by surname, null first then id")
+
+	// limit and offset
+	params = listParams(prefix)
+	params.Limit = 2
+	params.Offset = 1
+	list, err = repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{a.Id, b.Id}, ids(list), "limit offset")
+
+	// cursor walks every row exactly once
+	for _, sortBy := range model.UserSortFields {
+		for _, desc := range []bool{false, true} {
+			params = listParams(prefix)
+			params.SortBy = sortBy
+			params.SortDesc = desc
+
+			all, err := repo.GetList(ctx, params)
+			require.NoError(t, err)
+
+			params.Limit = 1
+			walked := []uint{}
+			for i := 0; i < 10; i++ {
+				page, err := repo.GetList(ctx, params)
+				require.NoError(t, err)
+				if len(page) == 0 {
+					break
+				}
+				walked = append(walked, page[0].Id)
+				cursor := model.NewUserCursor(page[0], sortBy, desc)
+				params.Cursor = &cursor
+			}
+
+			assert.Equal(t, ids(all), walked, "cursor pagination, sort=%s desc=%t", sortBy, desc)
+		}
+	}
+
+	// filters
+	hasSurname := true
+	params = listParams(prefix)
+	params.HasSurname = &hasSurname
+	list, err = repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{c.Id, b.Id}, ids(list), "has_surname=true")
+
+	hasSurname = false
+	list, err = repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{a.Id}, ids(list), "has_surname=false")
+
+	exact := prefix + "b"
+	params = listParams(exact)
+	list, err = repo.GetList(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{b.Id}, ids(list), "name prefix")
+
+	future := time.Now().Add(time.Hour)
+	params = listParams(prefix)
+	params.InsertedFrom = &future
+	total, err = repo.Count(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total, "inserted_from")
+
+	params = listParams(prefix)
+	params.InsertedTo = &future
+	total, err = repo.Count(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total, "inserted_to")
+}
+
+func testUserSearch(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	// a made up alphabet soup keeps rows of other tests and runs out of the results
+	word := fmt.Sprintf("Қызғалдақ%dқ", time.Now().UnixNano()%1_000_000)
+	surname := "Әбішұлы"
+
+	exact := createUser(t, repo, word, &surname)
+	createUser(t, repo, "Айгүль", &surname)
+	deleted := createUser(t, repo, word, nil)
+	require.NoError(t, repo.Delete(ctx, deleted.Id, 0))
+
+	find := func(query string) []*model.UserSearchResult {
+		result, err := repo.Search(ctx, model.UserSearchParams{Query: query, Limit: 10})
+		require.NoError(t, err)
+		return result
+	}
+
+	found := find(word)
+	require.Len(t, found, 1, "deleted users and other words are left out")
+	assert.Equal(t, exact.Id, found[0].Id)
+	assert.Equal(t, word, found[0].Name)
+	assert.Greater(t, found[0].Score, 1.0, "full-text match ranks above 1")
+
+	prefix := []rune(word)
+	found = find(string(prefix[:len(prefix)-3]) + " әбіш")
+	require.NotEmpty(t, found, "prefixes of every word match")
+	assert.Equal(t, exact.Id, found[0].Id)
+
+	typo := string(prefix[:4]) + string(prefix[5:])
+	found = find(typo)
+	require.Len(t, found, 1, "typo is tolerated")
+	assert.Equal(t, exact.Id, found[0].Id)
+	assert.Less(t, found[0].Score, 1.0, "fuzzy match ranks below 1")
+}
+
+func testUserExport(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+	surname := "smith"
+
+	c := createUser(t, repo, prefix+"c", &surname)
+	a := createUser(t, repo, prefix+"a", nil)
+	b := createUser(t, repo, prefix+"b", &surname)
+
+	export := func(params model.UserListParams) []uint {
+		result := []uint{}
+		err := repo.Export(ctx, params, func(user *model.User) error {
+			result = append(result, user.Id)
+			return nil
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	params := listParams(prefix)
+	params.Limit = 1
+	params.Offset = 1
+	params.SortBy = model.UserSortName
+	assert.Equal(t, []uint{a.Id, b.Id, c.Id}, export(params), "pagination is ignored")
+
+	hasSurname := true
+	params = listParams(prefix)
+	params.HasSurname = &hasSurname
+	params.SortDesc = true
+	assert.Equal(t, []uint{b.Id, c.Id}, export(params), "filters and order apply")
+
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.Export(ctx, listParams(prefix), func(user *model.User) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop, "error of fn is returned")
+	assert.Equal(t, 1, calls, "error of fn stops the export")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = repo.Export(cancelled, listParams(prefix), func(user *model.User) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func testUserSoftDelete(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+
+	user := createUser(t, repo, prefix+"a", nil)
+
+	err := repo.Delete(ctx, user.Id, 0)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, user.Id, 0)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows, "deleting twice")
+
+	exists, err := repo.CheckIfExists(ctx, user.Id, false)
+	require.NoError(t, err)
+	assert.False(t, exists, "deleted user must be hidden")
+
+	exists, err = repo.CheckIfExists(ctx, user.Id, true)
+	require.NoError(t, err)
+	assert.True(t, exists, "deleted user must be visible with include deleted")
+
+	_, err = repo.Get(ctx, user.Id, false)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows)
+
+	deleted, err := repo.Get(ctx, user.Id, true)
+	require.NoError(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+
+	params := listParams(prefix)
+	total, err := repo.Count(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+
+	params.IncludeDeleted = true
+	total, err = repo.Count(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	err = repo.Restore(ctx, user.Id)
+	require.NoError(t, err)
+
+	err = repo.Restore(ctx, user.Id)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows, "restoring active user")
+
+	restored, err := repo.Get(ctx, user.Id, false)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+}
+
+func testUserPurge(t *testing.T, repo repository.UserRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+
+	deleted := createUser(t, repo, prefix+"a", nil)
+	active := createUser(t, repo, prefix+"b", nil)
+
+	err := repo.Delete(ctx, deleted.Id, 0)
+	require.NoError(t, err)
+
+	_, err = repo.Purge(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	exists, err := repo.CheckIfExists(ctx, deleted.Id, true)
+	require.NoError(t, err)
+	assert.True(t, exists, "user deleted after retention point must stay")
+
+	purged, err := repo.Purge(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+
+	exists, err = repo.CheckIfExists(ctx, deleted.Id, true)
+	require.NoError(t, err)
+	assert.False(t, exists, "purged user must be gone")
+
+	exists, err = repo.CheckIfExists(ctx, active.Id, false)
+	require.NoError(t, err)
+	assert.True(t, exists, "active user must survive purge")
+}
+
+func testAudit(t *testing.T, users repository.UserRepository, audit repository.AuditRepository) {
+	prefix := uniquePrefix()
+	actor := "test:" + prefix
+	ctx := model.WithRequestId(model.WithActor(context.Background(), actor), prefix)
+	surname := "smith"
+
+	user, err := users.Create(ctx, prefix+"a", &surname)
+	require.NoError(t, err)
+
+	_, err = users.Update(ctx, user.Id, prefix+"b", &surname, 0)
+	require.NoError(t, err)
+
+	_, err = users.Patch(ctx, user.Id, model.UserChanges{SurnameSet: true}, 0)
+	require.NoError(t, err)
+
+	_, err = users.Update(ctx, user.Id, prefix+"c", nil, user.Version)
+	require.ErrorIs(t, err, model.ErrUserVersionMismatch)
+
+	require.NoError(t, users.Delete(ctx, user.Id, 0))
+	require.NoError(t, users.Restore(ctx, user.Id))
+	require.NoError(t, users.Delete(ctx, user.Id, 0))
+
+	_, err = users.Purge(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	history := model.AuditListParams{Limit: 100, UserId: &user.Id}
+
+	list, err := audit.GetList(ctx, history)
+	require.NoError(t, err)
+	require.Len(t, list, 7, "failed writes must not be audited")
+
+	operations := []string{}
+	for _, entry := range list {
+		operations = append(operations, entry.Operation)
+		assert.Equal(t, user.Id, entry.UserId)
+		assert.Equal(t, actor, entry.Actor)
+		assert.Equal(t, prefix, entry.RequestId)
+		assert.False(t, entry.CreatedAt.IsZero(), "created_at must be set")
+	}
+	assert.Equal(t, []string{
+		model.AuditOperationPurge,
+		model.AuditOperationDelete,
+		model.AuditOperationRestore,
+		model.AuditOperationDelete,
+		model.AuditOperationUpdate,
+		model.AuditOperationUpdate,
+		model.AuditOperationCreate,
+	}, operations, "entries must be newest first")
+
+	assert.Equal(t, map[string]model.AuditChange{
+		"name":    {Before: nil, After: prefix + "a"},
+		"surname": {Before: nil, After: surname},
+	}, list[6].Changes, "create must record the new values")
+	assert.Equal(t, map[string]model.AuditChange{
+		"name": {Before: prefix + "a", After: prefix + "b"},
+	}, list[5].Changes, "update must record only changed columns")
+	assert.Equal(t, map[string]model.AuditChange{
+		"surname": {Before: surname, After: nil},
+	}, list[4].Changes, "cleared surname must be null")
+
+	deletedAt := list[3].Changes["deleted_at"]
+	assert.Nil(t, deletedAt.Before)
+	assert.NotNil(t, deletedAt.After, "delete must record deleted_at")
+	assert.Equal(t, deletedAt.After, list[2].Changes["deleted_at"].Before, "restore must clear deleted_at")
+
+	assert.Equal(t, map[string]model.AuditChange{
+		"name":       {Before: prefix + "b", After: nil},
+		"deleted_at": {Before: list[1].Changes["deleted_at"].After, After: nil},
+	}, list[0].Changes, "purge must record the removed values")
+
+	total, err := audit.Count(ctx, history)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), total)
+
+	// filters
+	operation := model.AuditOperationDelete
+	list, err = audit.GetList(ctx, model.AuditListParams{Limit: 100, Actor: &actor, Operation: &operation})
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	other := actor + "other"
+	total, err = audit.Count(ctx, model.AuditListParams{Actor: &other})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+
+	from := time.Now().Add(time.Hour)
+	total, err = audit.Count(ctx, model.AuditListParams{Actor: &actor, From: &from})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total, "from must exclude older entries")
+
+	to := time.Now().Add(time.Hour)
+	total, err = audit.Count(ctx, model.AuditListParams{Actor: &actor, To: &to})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), total)
+
+	// keyset pagination
+	history.Limit = 4
+	first, err := audit.GetList(ctx, history)
+	require.NoError(t, err)
+	require.Len(t, first, 4)
+
+	history.Cursor = &first[3].Id
+	second, err := audit.GetList(ctx, history)
+	require.NoError(t, err)
+	require.Len(t, second, 3)
+	assert.Less(t, second[0].Id, first[3].Id)
+
+	total, err = audit.Count(ctx, history)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), total, "count must ignore the cursor")
+
+	// batch
+	written, err := users.CreateBatch(ctx, []model.NewUser{{Name: prefix + "x"}, {Name: prefix + "y", Surname: &surname}})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), written)
+
+	operation = model.AuditOperationCreate
+	list, err = audit.GetList(ctx, model.AuditListParams{Limit: 2, Actor: &actor, Operation: &operation})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, map[string]model.AuditChange{
+		"name":    {Before: nil, After: prefix + "y"},
+		"surname": {Before: nil, After: surname},
+	}, list[0].Changes)
+	assert.Equal(t, map[string]model.AuditChange{
+		"name": {Before: nil, After: prefix + "x"},
+	}, list[1].Changes)
+	assert.Equal(t, prefix, list[1].RequestId)
+}
+
+func testWebhook(t *testing.T, users repository.UserRepository, repo repository.WebhookRepository) {
+	ctx := context.Background()
+	prefix := uniquePrefix()
+
+	created, err := repo.Create(ctx, "http://localhost/"+prefix+"/created", "secret", []string{model.EventUserCreated})
+	require.NoError(t, err)
+	all, err := repo.Create(ctx, "http://localhost/"+prefix+"/all", "secret", nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = repo.Delete(ctx, created.Id)
+		_ = repo.Delete(ctx, all.Id)
+	}()
+
+	stored, err := repo.Get(ctx, created.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", stored.Secret)
+	assert.Equal(t, []string{model.EventUserCreated}, stored.EventTypes)
+
+	list, err := repo.GetList(ctx)
+	require.NoError(t, err)
+	for _, webhook := range list {
+		assert.Empty(t, webhook.Secret, "list must not expose secrets")
+	}
+
+	user := createUser(t, users, prefix+"a", nil)
+	_, err = users.Update(ctx, user.Id, prefix+"b", nil, 0)
+	require.NoError(t, err)
+
+	// earlier events of a shared outbox are queued too, so it is drained
+	for {
+		handled, err := repo.FanOut(ctx, 1000)
+		require.NoError(t, err)
+		if handled == 0 {
+			break
+		}
+	}
+
+	own := func(webhookId uint, status *string) []*model.WebhookDelivery {
+		deliveries, err := repo.GetDeliveries(ctx, webhookId, status, 1000)
+		require.NoError(t, err)
+
+		result := []*model.WebhookDelivery{}
+		for _, delivery := range deliveries {
+			var data model.User
+			require.NoError(t, json.Unmarshal(delivery.Event.Data, &data))
+			if data.Id == user.Id {
+				result = append(result, delivery)
+			}
+		}
+		return result
+	}
+
+	require.Len(t, own(created.Id, nil), 1, "only subscribed events must be queued")
+	deliveries := own(all.Id, nil)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, model.EventUserUpdated, deliveries[0].Event.Type, "deliveries must be newest first")
+	assert.Equal(t, model.EventUserCreated, deliveries[1].Event.Type)
+	assert.Equal(t, model.DeliveryStatusPending, deliveries[1].Status)
+
+	// claim leases due deliveries
+	claimed, err := repo.Claim(ctx, 10000, time.Minute)
+	require.NoError(t, err)
+	mine := map[uint]*model.WebhookDelivery{}
+	for _, delivery := range claimed {
+		if delivery.WebhookId == created.Id || delivery.WebhookId == all.Id {
+			mine[delivery.Id] = delivery
+		}
+	}
+	require.Contains(t, mine, deliveries[0].Id)
+	assert.Equal(t, all.Url, mine[deliveries[0].Id].Url)
+	assert.Equal(t, "secret", mine[deliveries[0].Id].Secret)
+
+	again, err := repo.Claim(ctx, 10000, time.Minute)
+	require.NoError(t, err)
+	for _, delivery := range again {
+		assert.NotContains(t, mine, delivery.Id, "leased deliveries must not be claimed twice")
+	}
+
+	ok := model.DeliveryAttempt{StatusCode: 200}
+	failed := model.DeliveryAttempt{StatusCode: 500, Error: "unexpected status 500"}
+
+	require.NoError(t, repo.Complete(ctx, deliveries[0].Id, ok, model.DeliveryStatusDelivered, time.Now()))
+	require.NoError(t, repo.Complete(ctx, deliveries[1].Id, failed, model.DeliveryStatusDead, time.Now()))
+
+	deliveries = own(all.Id, nil)
+	assert.Equal(t, model.DeliveryStatusDelivered, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+	assert.Nil(t, deliveries[0].LastError)
+	assert.Equal(t, model.DeliveryStatusDead, deliveries[1].Status)
+	require.NotNil(t, deliveries[1].LastStatusCode)
+	assert.Equal(t, 500, *deliveries[1].LastStatusCode)
+	require.NotNil(t, deliveries[1].LastError)
+	assert.Nil(t, deliveries[1].DeliveredAt)
+
+	dead := model.DeliveryStatusDead
+	require.Len(t, own(all.Id, &dead), 1)
+
+	replayed, err := repo.Replay(ctx, all.Id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), replayed)
+
+	deliveries = own(all.Id, nil)
+	assert.Equal(t, model.DeliveryStatusPending, deliveries[1].Status)
+	assert.Equal(t, 0, deliveries[1].Attempts, "replay must reset attempts")
+
+	claimed, err = repo.Claim(ctx, 10000, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, deliveryIds(claimed), deliveries[1].Id, "replayed delivery must be due")
+
+	// retry later
+	require.NoError(t, repo.Complete(ctx, deliveries[1].Id, failed, model.DeliveryStatusPending, time.Now().Add(time.Hour)))
+	claimed, err = repo.Claim(ctx, 10000, time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, deliveryIds(claimed), deliveries[1].Id, "retry must wait for next_attempt_at")
+
+	// the default retention, older rows of a shared database would be deleted by the app anyway
+	_, _, err = repo.DeleteExpired(ctx, time.Now().Add(-7*24*time.Hour), false)
+	require.NoError(t, err)
+	assert.Len(t, own(all.Id, nil), 2, "recent deliveries must be kept")
+
+	require.NoError(t, repo.Delete(ctx, all.Id))
+	assert.Empty(t, own(all.Id, nil), "deliveries must be deleted with the webhook")
+
+	_, err = repo.Get(ctx, all.Id)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows)
+	assert.ErrorIs(t, repo.Delete(ctx, all.Id), model.ErrSqlNoRows)
+}
+
+func testApiKey(t *testing.T, repo repository.ApiKeyRepository) {
+	ctx := context.Background()
+	hash := fmt.Sprintf("%064d", time.Now().UnixNano())
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+
+	key, err := repo.Create(ctx, "contract", "gta_test", hash, []string{model.ScopeUsersRead}, &expiresAt)
+	require.NoError(t, err)
+	assert.NotZero(t, key.Id)
+	assert.False(t, key.CreatedAt.IsZero())
+
+	_, err = repo.Create(ctx, "contract", "gta_test", hash, nil, nil)
+	assert.ErrorIs(t, err, model.ErrSqlUniqueViolation, "key hash must be unique")
+
+	found, err := repo.GetByHash(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, key.Id, found.Id)
+	assert.Equal(t, []string{model.ScopeUsersRead}, found.Scopes)
+	require.NotNil(t, found.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*found.ExpiresAt))
+	assert.Nil(t, found.LastUsedAt)
+
+	_, err = repo.GetByHash(ctx, "missing")
+	assert.ErrorIs(t, err, model.ErrSqlNoRows)
+
+	err = repo.TouchLastUsed(ctx, key.Id)
+	require.NoError(t, err)
+
+	found, err = repo.GetByHash(ctx, hash)
+	require.NoError(t, err)
+	assert.NotNil(t, found.LastUsedAt)
+
+	list, err := repo.GetList(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, apiKeyIds(list), key.Id)
+
+	err = repo.Revoke(ctx, key.Id)
+	require.NoError(t, err)
+
+	err = repo.Revoke(ctx, key.Id)
+	assert.ErrorIs(t, err, model.ErrSqlNoRows, "revoking twice")
+
+	found, err = repo.GetByHash(ctx, hash)
+	require.NoError(t, err)
+	assert.NotNil(t, found.RevokedAt)
+}
+
+func testIdempotency(t *testing.T, repo repository.IdempotencyRepository) {
+	ctx := context.Background()
+	key := uniquePrefix()
+
+	record := &model.IdempotencyRecord{
+		Owner:       "contract",
+		Key:         key,
+		Fingerprint: fmt.Sprintf("%064d", 1),
+		LockedUntil: time.Now().Add(time.Minute),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	existing, reserved, err := repo.Reserve(ctx, record)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Nil(t, existing)
+
+	existing, reserved, err = repo.Reserve(ctx, record)
+	require.NoError(t, err)
+	assert.False(t, reserved, "key must be reserved once")
+	require.NotNil(t, existing)
+	assert.Equal(t, record.Fingerprint, existing.Fingerprint)
+	assert.False(t, existing.IsCompleted(), "record must be in progress")
+
+	// another owner has its own key space
+	_, reserved, err = repo.Reserve(ctx, &model.IdempotencyRecord{Owner: "other", Key: key, Fingerprint: record.Fingerprint, LockedUntil: record.LockedUntil, ExpiresAt: record.ExpiresAt})
+	require.NoError(t, err)
+	assert.True(t, reserved, "keys must be scoped by owner")
+
+	err = repo.Release(ctx, record.Owner, key)
+	require.NoError(t, err)
+
+	_, reserved, err = repo.Reserve(ctx, record)
+	require.NoError(t, err)
+	assert.True(t, reserved, "released key must be reserved again")
+
+	err = repo.Complete(ctx, record.Owner, key, 201, map[string]string{"Location": "/api/users/1"}, []byte(`{"id":1}`))
+	require.NoError(t, err)
+
+	err = repo.Release(ctx, record.Owner, key)
+	require.NoError(t, err)
+
+	existing, reserved, err = repo.Reserve(ctx, record)
+	require.NoError(t, err)
+	assert.False(t, reserved, "completed key must not be released")
+	require.NotNil(t, existing)
+	require.True(t, existing.IsCompleted())
+	assert.Equal(t, 201, *existing.StatusCode)
+	assert.Equal(t, map[string]string{"Location": "/api/users/1"}, existing.Headers)
+	assert.Equal(t, []byte(`{"id":1}`), existing.Body)
+
+	// a request in progress past its lease is abandoned, a retry takes the key over
+	abandoned := &model.IdempotencyRecord{
+		Owner:       "contract",
+		Key:         key + "abandoned",
+		Fingerprint: record.Fingerprint,
+		LockedUntil: time.Now().Add(-time.Second),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	_, reserved, err = repo.Reserve(ctx, abandoned)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	retry := *record
+	retry.Key = abandoned.Key
+
+	_, reserved, err = repo.Reserve(ctx, &retry)
+	require.NoError(t, err)
+	assert.True(t, reserved, "abandoned key must be taken over")
+
+	_, reserved, err = repo.Reserve(ctx, &retry)
+	require.NoError(t, err)
+	assert.False(t, reserved, "key taken over must be leased again")
+
+	// expired keys are taken over and deleted
+	expired := &model.IdempotencyRecord{
+		Owner:       "contract",
+		Key:         key + "expired",
+		Fingerprint: record.Fingerprint,
+		ExpiresAt:   time.Now().Add(-time.Minute),
+	}
+
+	_, reserved, err = repo.Reserve(ctx, expired)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	_, reserved, err = repo.Reserve(ctx, expired)
+	require.NoError(t, err)
+	assert.True(t, reserved, "expired key must be reserved again")
+
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, deleted, int64(1))
+}
+
+func testRateLimit(t *testing.T, repo repository.RateLimitRepository) {
+	ctx := context.Background()
+	key := uniquePrefix()
+
+	for i := 0; i < 3; i++ {
+		result, err := repo.Take(ctx, key, time.Hour, 3)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed, "request %d is within the burst", i)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, 2-i, result.Remaining)
+		assert.Zero(t, result.RetryAfter)
+	}
+
+	result, err := repo.Take(ctx, key, time.Hour, 3)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "burst must be spent")
+	assert.Zero(t, result.Remaining)
+	assert.InDelta(t, time.Hour, result.RetryAfter, float64(time.Minute))
+	assert.InDelta(t, 3*time.Hour, result.Reset, float64(time.Minute))
+
+	peeked, err := repo.Peek(ctx, key, time.Hour, 3)
+	require.NoError(t, err)
+	assert.False(t, peeked.Allowed, "peek must see the spent bucket")
+
+	peeked, err = repo.Peek(ctx, key+"peek", time.Hour, 1)
+	require.NoError(t, err)
+	assert.True(t, peeked.Allowed, "a missing bucket is full")
+	assert.Equal(t, 1, peeked.Remaining)
+
+	result, err = repo.Take(ctx, key+"peek", time.Hour, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "peek must not spend a token")
+
+	result, err = repo.Take(ctx, key+"other", time.Hour, 3)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed, "keys must have buckets of their own")
+
+	// a token refills after the interval
+	result, err = repo.Take(ctx, key+"refill", 50*time.Millisecond, 1)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	result, err = repo.Take(ctx, key+"refill", 50*time.Millisecond, 1)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+
+	time.Sleep(100 * time.Millisecond)
+
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, deleted, int64(1), "full bucket must be deleted")
+
+	result, err = repo.Take(ctx, key+"refill", 50*time.Millisecond, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = repo.Take(ctx, key, time.Hour, 3)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed, "buckets being refilled must be kept")
+}
+
+func ids(list []*model.User) []uint {
+	result := []uint{}
+	for _, user := range list {
+		result = append(result, user.Id)
+	}
+	return result
+}
+
+func deliveryIds(list []*model.WebhookDelivery) []uint {
+	result := []uint{}
+	for _, delivery := range list {
+		result = append(result, delivery.Id)
+	}
+	return result
+}
+
+func apiKeyIds(list []*model.ApiKey) []uint {
+	result := []uint{}
+	for _, key := range list {
+		result = append(result, key.Id)
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"strings"
+	"time"
+)
+
+// KeyPrefix starts every generated secret, so leaked keys are easy to grep for
+const KeyPrefix = "gta_"
+
+type ApiKeyService struct {
+	cfg  *config.Config
+	repo repository.ApiKeyRepository
+}
+
+func NewService(
+	cfg *config.Config,
+	repo repository.ApiKeyRepository,
+) *ApiKeyService {
+	return &ApiKeyService{
+		cfg:  cfg,
+		repo: repo,
+	}
+}
+
+func (s *ApiKeyService) GetList(ctx context.Context) ([]*model.ApiKey, error) {
+	return s.repo.GetList(ctx)
+}
+
+// Create returns the stored key and its secret, the secret is never stored and can't be shown again
+func (s *ApiKeyService) Create(
+	ctx context.Context,
+	name string,
+	scopes []string,
+	expiresAt *time.Time,
+) (*model.ApiKey, string, error) {
+	for _, scope := range scopes {
+		if !model.IsValidApiKeyScope(scope) {
+			return nil, "", errors.Join(model.ErrApiKeyInvalidScope, errors.New(scope))
+		}
+	}
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret := KeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	prefix := secret[:len(KeyPrefix)+8]
+
+	key, err := s.repo.Create(ctx, name, prefix, Hash(secret), scopes, expiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+func (s *ApiKeyService) Revoke(ctx context.Context, id uint) error {
+	err := s.repo.Revoke(ctx, id)
+	if errors.Is(err, model.ErrSqlNoRows) {
+		return model.ErrNoApiKeyWithSuchId
+	}
+	return err
+}
+
+// Authenticate resolves the secret sent in X-API-SECRET-KEY header to an active key,
+// it doesn't write, callers record the use with TouchLastUsed
+func (s *ApiKeyService) Authenticate(ctx context.Context, secret string) (*model.ApiKey, error) {
+	if secret == "" {
+		return nil, model.ErrSecurityAbsentSecret
+	}
+
+	if !strings.HasPrefix(secret, KeyPrefix) {
+		return nil, model.ErrSecurityUnauthorizedInvalidHeader
+	}
+
+	key, err := s.repo.GetByHash(ctx, Hash(secret))
+	if err != nil {
+		if errors.Is(err, model.ErrSqlNoRows) {
+			return nil, model.ErrSecurityInvalidSecret
+		}
+		return nil, err
+	}
+
+	if !key.IsActive(time.Now()) {
+		return nil, model.ErrSecurityUnauthorized
+	}
+
+	return key, nil
+}
+
+// TouchLastUsed is best effort, a failure must not reject an authenticated key
+func (s *ApiKeyService) TouchLastUsed(ctx context.Context, id uint) error {
+	return s.repo.TouchLastUsed(ctx, id)
+}
+
+// Hash is sha256 since generated secrets carry 256 bits of entropy, a slow password hash adds nothing
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+)
+
+type AuditService struct {
+	cfg   *config.Config
+	repo  repository.AuditRepository
+	users repository.UserRepository
+}
+
+func NewService(
+	cfg *config.Config,
+	repo repository.AuditRepository,
+	users repository.UserRepository,
+) *AuditService {
+	return &AuditService{
+		cfg:   cfg,
+		repo:  repo,
+		users: users,
+	}
+}
+
+// GetList returns audit entries newest first, page.NextCursor is set when older entries exist
+func (s *AuditService) GetList(ctx context.Context, params model.AuditListParams) ([]*model.UserAudit, *model.Page, error) {
+	if params.Limit == 0 {
+		params.Limit = s.cfg.Db.Limit
+	}
+	if s.cfg.Db.MaxLimit > 0 && params.Limit > s.cfg.Db.MaxLimit {
+		params.Limit = s.cfg.Db.MaxLimit
+	}
+
+	total, err := s.repo.Count(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limit := params.Limit
+	params.Limit = limit + 1 // one extra row tells if there is a next page
+
+	list, err := s.repo.GetList(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &model.Page{
+		Total: total,
+		Limit: limit,
+	}
+
+	if uint(len(list)) > limit {
+		list = list[:limit]
+		nextCursor := model.EncodeAuditCursor(list[len(list)-1].Id)
+		page.NextCursor = &nextCursor
+	}
+
+	return list, page, nil
+}
+
+// History is the audit log of one user, it outlives purge of the user.
+// ErrNoUserWithSuchId is returned only when the user has neither a row nor history
+func (s *AuditService) History(ctx context.Context, userId uint, params model.AuditListParams) ([]*model.UserAudit, *model.Page, error) {
+	params.UserId = &userId
+
+	list, page, err := s.GetList(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if page.Total == 0 {
+		exists, err := s.users.CheckIfExists(ctx, userId, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !exists {
+			return nil, nil, model.ErrNoUserWithSuchId
+		}
+	}
+
+	return list, page, nil
+}
@@ -0,0 +1,108 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"time"
+)
+
+const (
+	pollMinDelay = 25 * time.Millisecond
+	pollMaxDelay = 500 * time.Millisecond
+)
+
+// defaultLease is used for a zero config, e.g. in tests
+const defaultLease = time.Minute
+
+type IdempotencyService struct {
+	cfg  *config.Config
+	repo repository.IdempotencyRepository
+}
+
+func NewService(
+	cfg *config.Config,
+	repo repository.IdempotencyRepository,
+) *IdempotencyService {
+	return &IdempotencyService{
+		cfg:  cfg,
+		repo: repo,
+	}
+}
+
+// Begin reserves the key for the caller and returns nil, or returns the recorded response to replay.
+// A request arriving while the first one with the same key is running waits for it
+// up to app.idempotencyWait seconds, so concurrent requests are serialized
+func (s *IdempotencyService) Begin(ctx context.Context, owner string, key string, fingerprint string) (*model.IdempotencyRecord, error) {
+	deadline := time.Now().Add(time.Duration(s.cfg.App.IdempotencyWait) * time.Second)
+	delay := pollMinDelay
+
+	for {
+		existing, reserved, err := s.repo.Reserve(ctx, &model.IdempotencyRecord{
+			Owner:       owner,
+			Key:         key,
+			Fingerprint: fingerprint,
+			LockedUntil: time.Now().Add(s.lease()),
+			ExpiresAt:   time.Now().Add(time.Duration(s.cfg.App.IdempotencyTtl) * time.Hour),
+		})
+		if err != nil {
+			// the record was released between the insert and the read, try to reserve again
+			if errors.Is(err, model.ErrSqlNoRows) {
+				continue
+			}
+			return nil, err
+		}
+
+		if reserved {
+			return nil, nil
+		}
+
+		if existing.Fingerprint != fingerprint {
+			return nil, model.ErrIdempotencyKeyReused
+		}
+
+		if existing.IsCompleted() {
+			return existing, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, model.ErrIdempotencyInProgress
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, pollMaxDelay)
+	}
+}
+
+func (s *IdempotencyService) Complete(
+	ctx context.Context,
+	owner string,
+	key string,
+	statusCode int,
+	headers map[string]string,
+	body []byte,
+) error {
+	return s.repo.Complete(ctx, owner, key, statusCode, headers, body)
+}
+
+func (s *IdempotencyService) Release(ctx context.Context, owner string, key string) error {
+	return s.repo.Release(ctx, owner, key)
+}
+
+func (s *IdempotencyService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpired(ctx)
+}
+
+func (s *IdempotencyService) lease() time.Duration {
+	if s.cfg.App.IdempotencyLease > 0 {
+		return time.Duration(s.cfg.App.IdempotencyLease) * time.Second
+	}
+	return defaultLease
+}
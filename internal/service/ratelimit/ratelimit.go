@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"time"
+)
+
+// defaultAuthFailureLimit is used for a zero config, e.g. in tests
+var defaultAuthFailureLimit = config.RateLimit{Rate: 0.1, Burst: 10}
+
+type RateLimitService struct {
+	cfg    *config.Config
+	repo   repository.RateLimitRepository
+	routes map[string]config.RateLimit
+}
+
+func NewService(
+	cfg *config.Config,
+	repo repository.RateLimitRepository,
+) *RateLimitService {
+	routes, _ := cfg.Security.RateLimitOverrides() // checked by config.Validate
+
+	return &RateLimitService{
+		cfg:    cfg,
+		repo:   repo,
+		routes: routes,
+	}
+}
+
+// Allow spends a token of the client bucket, route is "METHOD /route/template".
+// A route with an override in security.rateLimitRoutes has a bucket of its own per client
+func (s *RateLimitService) Allow(ctx context.Context, client string, route string) (*model.RateLimitResult, error) {
+	limit, key := s.cfg.Security.RateLimitDefault(), client
+	if override, ok := s.routes[route]; ok {
+		limit, key = override, client+" "+route
+	}
+
+	return s.take(ctx, key, limit)
+}
+
+// AllowAuth tells if the client may try to authenticate, checked before its key is looked up
+// so a client out of attempts costs no db lookup. It spends nothing, FailAuth does
+func (s *RateLimitService) AllowAuth(ctx context.Context, client string) (*model.RateLimitResult, error) {
+	limit := s.authFailureLimit()
+	return s.repo.Peek(ctx, authFailureKey(client), interval(limit), limit.Burst)
+}
+
+// FailAuth spends a token of the client auth failure bucket
+func (s *RateLimitService) FailAuth(ctx context.Context, client string) error {
+	_, err := s.take(ctx, authFailureKey(client), s.authFailureLimit())
+	return err
+}
+
+func (s *RateLimitService) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpired(ctx)
+}
+
+func (s *RateLimitService) take(ctx context.Context, key string, limit config.RateLimit) (*model.RateLimitResult, error) {
+	result, err := s.repo.Take(ctx, key, interval(limit), limit.Burst)
+	// the full bucket was deleted between the write and the read, take from a new one once,
+	// a second miss is returned rather than retried
+	if errors.Is(err, model.ErrSqlNoRows) {
+		result, err = s.repo.Take(ctx, key, interval(limit), limit.Burst)
+	}
+	return result, err
+}
+
+// authFailureKey keeps failures apart from the request buckets of the same client
+func authFailureKey(client string) string {
+	return "auth-failure " + client
+}
+
+func interval(limit config.RateLimit) time.Duration {
+	return time.Duration(float64(time.Second) / limit.Rate)
+}
+
+func (s *RateLimitService) authFailureLimit() config.RateLimit {
+	if limit := s.cfg.Security.AuthFailureLimit(); limit.Rate > 0 && limit.Burst > 0 {
+		return limit
+	}
+	return defaultAuthFailureLimit
+}
@@ -0,0 +1,32 @@
+package ratelimit
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// missingRepository never finds the bucket it just wrote
+type missingRepository struct {
+	repository.RateLimitRepository
+	takes int
+}
+
+func (r *missingRepository) Take(ctx context.Context, key string, interval time.Duration, burst int) (*model.RateLimitResult, error) {
+	r.takes++
+	return nil, model.ErrSqlNoRows
+}
+
+func TestAllowRetriesOnce(t *testing.T) {
+	repo := &missingRepository{}
+	service := NewService(&config.Config{Security: config.Security{RateLimitRate: 1, RateLimitBurst: 1}}, repo)
+
+	_, err := service.Allow(context.Background(), "ip:127.0.0.1", "GET /api/users/")
+	assert.ErrorIs(t, err, model.ErrSqlNoRows)
+	assert.Equal(t, 2, repo.takes)
+}
@@ -5,27 +5,105 @@ import (
 	"gravitum-test-app/config"
 	"gravitum-test-app/internal/model"
 	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/internal/service/apikey"
+	"gravitum-test-app/internal/service/audit"
+	"gravitum-test-app/internal/service/idempotency"
+	"gravitum-test-app/internal/service/ratelimit"
+	"gravitum-test-app/internal/service/stream"
 	"gravitum-test-app/internal/service/user"
+	"gravitum-test-app/internal/service/webhook"
+	"io"
+	"time"
 )
 
 type UserService interface {
-	GetList(ctx context.Context) ([]*model.User, error)
-	Get(ctx context.Context, id uint) (*model.User, error)
+	GetList(ctx context.Context, params model.UserListParams) ([]*model.User, *model.Page, error)
+	Get(ctx context.Context, id uint, includeDeleted bool) (*model.User, error)
+	Search(ctx context.Context, params model.UserSearchParams) ([]*model.UserSearchResult, error)
+	Export(ctx context.Context, params model.UserListParams, fn func(user *model.User) error) error
 	Create(
 		ctx context.Context,
-		name string,
+		name *string,
 		surname *string,
-	) error
+	) (*model.User, error)
 	Update(
 		ctx context.Context,
 		id uint,
-		name string,
+		name *string,
 		surname *string,
+		version uint,
+	) (*model.User, error)
+	Patch(ctx context.Context, id uint, contentType string, patch []byte, version uint) (*model.User, error)
+	Import(ctx context.Context, contentType string, body io.Reader) (*model.ImportReport, error)
+	Delete(ctx context.Context, id uint, version uint) error
+	Restore(ctx context.Context, id uint) error
+	Purge(ctx context.Context) (int64, error)
+}
+
+type AuditService interface {
+	GetList(ctx context.Context, params model.AuditListParams) ([]*model.UserAudit, *model.Page, error)
+	History(ctx context.Context, userId uint, params model.AuditListParams) ([]*model.UserAudit, *model.Page, error)
+}
+
+type WebhookService interface {
+	GetList(ctx context.Context) ([]*model.Webhook, error)
+	Create(ctx context.Context, url string, eventTypes []string) (*model.Webhook, error)
+	Delete(ctx context.Context, id uint) error
+	GetDeliveries(ctx context.Context, id uint, status *string, limit uint) ([]*model.WebhookDelivery, error)
+	Replay(ctx context.Context, id uint) (int64, error)
+	Test(ctx context.Context, id uint) (*model.DeliveryAttempt, error)
+	Dispatch(ctx context.Context) (int, error)
+	DeleteExpired(ctx context.Context) (int64, int64, error)
+}
+
+type StreamService interface {
+	Listen(ctx context.Context) error
+	Subscribe(lastEventId *uint) *model.Subscription
+	Close()
+}
+
+type ApiKeyService interface {
+	GetList(ctx context.Context) ([]*model.ApiKey, error)
+	Create(
+		ctx context.Context,
+		name string,
+		scopes []string,
+		expiresAt *time.Time,
+	) (*model.ApiKey, string, error)
+	Revoke(ctx context.Context, id uint) error
+	Authenticate(ctx context.Context, secret string) (*model.ApiKey, error)
+	TouchLastUsed(ctx context.Context, id uint) error
+}
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, owner string, key string, fingerprint string) (*model.IdempotencyRecord, error)
+	Complete(
+		ctx context.Context,
+		owner string,
+		key string,
+		statusCode int,
+		headers map[string]string,
+		body []byte,
 	) error
+	Release(ctx context.Context, owner string, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type RateLimitService interface {
+	Allow(ctx context.Context, client string, route string) (*model.RateLimitResult, error)
+	AllowAuth(ctx context.Context, client string) (*model.RateLimitResult, error)
+	FailAuth(ctx context.Context, client string) error
+	DeleteExpired(ctx context.Context) (int64, error)
 }
 
 type Service struct {
-	User UserService
+	User        UserService
+	Audit       AuditService
+	Webhook     WebhookService
+	Stream      StreamService
+	ApiKey      ApiKeyService
+	Idempotency IdempotencyService
+	RateLimit   RateLimitService
 }
 
 func NewService(
@@ -37,7 +115,38 @@ func NewService(
 			cfg,
 			repositories.User,
 		),
+		Audit: audit.NewService(
+			cfg,
+			repositories.Audit,
+			repositories.User,
+		),
+		Webhook: webhook.NewService(
+			cfg,
+			repositories.Webhook,
+		),
+		Stream: stream.NewService(
+			cfg,
+			repositories.Event,
+		),
+		ApiKey: apikey.NewService(
+			cfg,
+			repositories.ApiKey,
+		),
+		Idempotency: idempotency.NewService(
+			cfg,
+			repositories.Idempotency,
+		),
+		RateLimit: ratelimit.NewService(
+			cfg,
+			repositories.RateLimit,
+		),
 	}
 }
 
 var _ UserService = (*user.UserService)(nil)
+var _ AuditService = (*audit.AuditService)(nil)
+var _ WebhookService = (*webhook.WebhookService)(nil)
+var _ StreamService = (*stream.StreamService)(nil)
+var _ ApiKeyService = (*apikey.ApiKeyService)(nil)
+var _ IdempotencyService = (*idempotency.IdempotencyService)(nil)
+var _ RateLimitService = (*ratelimit.RateLimitService)(nil)
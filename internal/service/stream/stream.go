@@ -0,0 +1,138 @@
+package stream
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"sync"
+)
+
+// defaults for a zero config, e.g. in tests
+const defaultBufferSize = 1000
+
+// subscriberBuffer is how many events a subscriber may lag behind before it is dropped
+const subscriberBuffer = 256
+
+// StreamService fans committed user events out to subscribers, it keeps the latest
+// events so a reconnecting client resumes without gaps
+type StreamService struct {
+	cfg         *config.Config
+	repo        repository.EventRepository
+	mu          sync.Mutex
+	buffer      []*model.Event // oldest first, in commit order
+	subscribers map[chan *model.Event]struct{}
+	closed      bool
+}
+
+func NewService(
+	cfg *config.Config,
+	repo repository.EventRepository,
+) *StreamService {
+	return &StreamService{
+		cfg:         cfg,
+		repo:        repo,
+		subscribers: map[chan *model.Event]struct{}{},
+	}
+}
+
+// Listen publishes events until ctx is cancelled or the source fails.
+// Events committed while nobody listens are never seen, so the buffer is dropped and
+// subscribers are disconnected on return, resuming from an older id reports a reset
+func (s *StreamService) Listen(ctx context.Context) error {
+	defer s.reset()
+
+	return s.repo.Listen(ctx, s.publish)
+}
+
+// Subscribe starts a feed after lastEventId, nil subscribes to new events only
+func (s *StreamService) Subscribe(lastEventId *uint) *model.Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make(chan *model.Event, subscriberBuffer)
+	result := &model.Subscription{
+		Events: events,
+		Close: func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.drop(events)
+		},
+	}
+
+	if s.closed {
+		close(events)
+		return result
+	}
+	s.subscribers[events] = struct{}{}
+
+	if lastEventId == nil {
+		return result
+	}
+
+	// ids of concurrent transactions commit out of order, so the position is searched
+	result.Reset = true
+	for i := len(s.buffer) - 1; i >= 0; i-- {
+		if s.buffer[i].Id == *lastEventId {
+			result.Replay = append([]*model.Event{}, s.buffer[i+1:]...)
+			result.Reset = false
+			break
+		}
+	}
+
+	return result
+}
+
+// Close disconnects every subscriber and refuses new ones, it is called on shutdown
+// so open streams don't hold the http server
+func (s *StreamService) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for events := range s.subscribers {
+		s.drop(events)
+	}
+}
+
+func (s *StreamService) publish(event *model.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := s.cfg.Stream.BufferSize
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+
+	if len(s.buffer) >= size {
+		s.buffer = s.buffer[len(s.buffer)-size+1:]
+	}
+	s.buffer = append(s.buffer, event)
+
+	for events := range s.subscribers {
+		select {
+		case events <- event:
+		default:
+			// a slow client resumes from the buffer after reconnecting
+			s.drop(events)
+		}
+	}
+}
+
+func (s *StreamService) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buffer = nil
+	for events := range s.subscribers {
+		s.drop(events)
+	}
+}
+
+// drop must be called with the lock held, it is a no-op for a dropped subscriber
+func (s *StreamService) drop(events chan *model.Event) {
+	if _, ok := s.subscribers[events]; ok {
+		delete(s.subscribers, events)
+		close(events)
+	}
+}
@@ -0,0 +1,200 @@
+package user
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gravitum-test-app/internal/metrics"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"io"
+	"strings"
+)
+
+// maxNdjsonLine is the longest ndjson row accepted, a longer one stops the import
+const maxNdjsonLine = 64 * 1024
+
+// Import reads users from a csv or ndjson stream and copies valid rows in batches of
+// Db.InsertBatchSize, invalid rows are skipped and reported with their line number.
+// Only one batch is held in memory, batches copied before a failing one are kept and
+// the error is then a model.ImportError carrying the report up to the last copied line
+func (s *UserService) Import(ctx context.Context, contentType string, body io.Reader) (*model.ImportReport, error) {
+	importer := &importer{
+		ctx:       ctx,
+		repo:      s.repo,
+		batchSize: max(s.cfg.Db.InsertBatchSize, 1),
+		report:    model.ImportReport{Errors: []model.ImportRowError{}},
+	}
+
+	var err error
+
+	switch contentType {
+	case model.ImportCsvContentType:
+		err = importer.readCsv(body)
+	case model.ImportNdjsonContentType:
+		err = importer.readNdjson(body)
+	default:
+		return nil, model.ErrRequestUnsupportedMediaType
+	}
+	if err == nil {
+		err = importer.flush()
+	}
+
+	metrics.UsersCreatedTotal.Add(float64(importer.report.Accepted))
+	metrics.UsersImportRejectedTotal.Add(float64(importer.report.Rejected))
+
+	if err != nil && importer.report.Accepted > 0 {
+		return nil, &model.ImportError{Err: err, Report: importer.report}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &importer.report, nil
+}
+
+type importer struct {
+	ctx       context.Context
+	repo      repository.UserRepository
+	batchSize int
+	batch     []model.NewUser
+	last      int
+	report    model.ImportReport
+}
+
+// add validates a row like UserService.Create does, the returned error is fatal
+func (i *importer) add(line int, name *string, surname *string) error {
+	user, err := normalize(name, surname)
+	if err != nil {
+		i.report.Reject(line, err)
+		return nil
+	}
+
+	i.batch = append(i.batch, user)
+	i.last = line
+	if len(i.batch) >= i.batchSize {
+		return i.flush()
+	}
+
+	return nil
+}
+
+func (i *importer) flush() error {
+	if len(i.batch) == 0 {
+		return nil
+	}
+
+	written, err := i.repo.CreateBatch(i.ctx, i.batch)
+	if err != nil {
+		return err
+	}
+
+	i.report.Accepted += int(written)
+	i.report.CommittedLine = i.last
+	i.batch = i.batch[:0]
+
+	return nil
+}
+
+// readCsv expects a header with a name and an optional surname column, an empty surname cell is null
+func (i *importer) readCsv(body io.Reader) error {
+	reader := csv.NewReader(body)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return model.NewParamError(model.ErrRequestInvalidBodyParams, "header", "is missing")
+	}
+	if err != nil {
+		return errors.Join(err, model.ErrRequestInvalidBodyParams)
+	}
+
+	nameIndex, surnameIndex := -1, -1
+	for index, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+
+		switch {
+		case column == "name" && nameIndex < 0:
+			nameIndex = index
+		case column == "surname" && surnameIndex < 0:
+			surnameIndex = index
+		default:
+			return model.NewParamError(model.ErrRequestInvalidBodyParams, "header", fmt.Sprintf("unexpected column %q", column))
+		}
+	}
+
+	if nameIndex < 0 {
+		return model.NewParamError(model.ErrRequestInvalidBodyParams, "header", "name column is required")
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			i.report.Reject(parseErr.StartLine, model.NewParamError(model.ErrRequestInvalidBodyParams, "row", parseErr.Err.Error()))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		name := record[nameIndex]
+
+		var surname *string
+		if surnameIndex >= 0 && record[surnameIndex] != "" {
+			value := record[surnameIndex]
+			surname = &value
+		}
+
+		err = i.add(line, &name, surname)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readNdjson expects one CreateUserRequest object per line, blank lines are skipped
+func (i *importer) readNdjson(body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxNdjsonLine)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		row := bytes.TrimSpace(scanner.Bytes())
+		if len(row) == 0 {
+			continue
+		}
+
+		var request model.CreateUserRequest
+
+		err := json.Unmarshal(row, &request)
+		if err != nil {
+			i.report.Reject(line, model.NewParamError(model.ErrRequestInvalidBodyParams, "row", "must be a json object"))
+			continue
+		}
+
+		err = i.add(line, request.Name, request.Surname)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return model.NewParamError(model.ErrRequestInvalidBodyParams, "row", fmt.Sprintf("line %d is longer than %d bytes", line+1, maxNdjsonLine))
+	}
+
+	return err
+}
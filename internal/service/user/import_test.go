@@ -0,0 +1,56 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingRepository copies batches until failAt is reached
+type failingRepository struct {
+	repository.UserRepository
+	batches int
+	failAt  int
+}
+
+func (r *failingRepository) CreateBatch(ctx context.Context, users []model.NewUser) (int64, error) {
+	r.batches++
+	if r.batches == r.failAt {
+		return 0, errors.New("connection reset")
+	}
+	return int64(len(users)), nil
+}
+
+func TestImportStoppedReportsCommittedRows(t *testing.T) {
+	cfg := &config.Config{Db: config.Db{InsertBatchSize: 2}}
+	service := NewService(cfg, &failingRepository{failAt: 2})
+
+	body := "name,surname\nAda,\nAlan,\n,Blank\nGrace,\nLinus,\n"
+	report, err := service.Import(context.Background(), model.ImportCsvContentType, strings.NewReader(body))
+	require.Error(t, err)
+	assert.Nil(t, report)
+
+	var importErr *model.ImportError
+	require.ErrorAs(t, err, &importErr)
+	assert.Equal(t, 2, importErr.Report.Accepted)
+	assert.Equal(t, 1, importErr.Report.Rejected)
+	assert.Equal(t, 3, importErr.Report.CommittedLine, "the first batch ends on line 3")
+}
+
+func TestImportFailingFirstBatchHasNoReport(t *testing.T) {
+	cfg := &config.Config{Db: config.Db{InsertBatchSize: 2}}
+	service := NewService(cfg, &failingRepository{failAt: 1})
+
+	_, err := service.Import(context.Background(), model.ImportCsvContentType, strings.NewReader("name\nAda\nAlan\n"))
+	require.Error(t, err)
+
+	var importErr *model.ImportError
+	assert.False(t, errors.As(err, &importErr), "nothing was kept")
+}
@@ -1,10 +1,21 @@
 package user
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"gravitum-test-app/config"
+	"gravitum-test-app/internal/metrics"
 	"gravitum-test-app/internal/model"
 	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/pkg/helper"
+	"gravitum-test-app/pkg/patch"
+	"gravitum-test-app/pkg/search"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type UserService struct {
@@ -22,12 +33,55 @@ func NewService(
 	}
 }
 
-func (s *UserService) GetList(ctx context.Context) ([]*model.User, error) {
-	return s.repo.GetList(ctx)
+func (s *UserService) GetList(ctx context.Context, params model.UserListParams) ([]*model.User, *model.Page, error) {
+	params, err := sorting(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if params.Limit == 0 {
+		params.Limit = s.cfg.Db.Limit
+	}
+	if s.cfg.Db.MaxLimit > 0 && params.Limit > s.cfg.Db.MaxLimit {
+		params.Limit = s.cfg.Db.MaxLimit
+	}
+	if params.Cursor != nil {
+		if params.Cursor.SortBy != params.SortBy || params.Cursor.SortDesc != params.SortDesc {
+			return nil, nil, model.ErrRequestInvalidCursor
+		}
+		params.Offset = 0
+	}
+
+	total, err := s.repo.Count(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limit := params.Limit
+	params.Limit = limit + 1 // one extra row tells if there is a next page
+
+	list, err := s.repo.GetList(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &model.Page{
+		Total:  total,
+		Limit:  limit,
+		Offset: params.Offset,
+	}
+
+	if uint(len(list)) > limit {
+		list = list[:limit]
+		nextCursor := model.NewUserCursor(list[len(list)-1], params.SortBy, params.SortDesc).Encode()
+		page.NextCursor = &nextCursor
+	}
+
+	return list, page, nil
 }
 
-func (s *UserService) Get(ctx context.Context, id uint) (*model.User, error) {
-	exists, err := s.repo.CheckIfExists(ctx, id)
+func (s *UserService) Get(ctx context.Context, id uint, includeDeleted bool) (*model.User, error) {
+	exists, err := s.repo.CheckIfExists(ctx, id, includeDeleted)
 	if err != nil {
 		return nil, err
 	}
@@ -36,24 +90,284 @@ func (s *UserService) Get(ctx context.Context, id uint) (*model.User, error) {
 		return nil, model.ErrNoUserWithSuchId
 	}
 
-	return s.repo.Get(ctx, id)
+	return s.repo.Get(ctx, id, includeDeleted)
 }
 
+// Search ranks active users matching params.Query and highlights the matched words
+func (s *UserService) Search(ctx context.Context, params model.UserSearchParams) ([]*model.UserSearchResult, error) {
+	if params.Limit == 0 {
+		params.Limit = s.cfg.Db.Limit
+	}
+	if s.cfg.Db.MaxLimit > 0 && params.Limit > s.cfg.Db.MaxLimit {
+		params.Limit = s.cfg.Db.MaxLimit
+	}
+
+	if len(search.Tokens(params.Query)) == 0 {
+		return nil, model.NewParamError(model.ErrRequestInvalidQueryParams, "q", "must contain a letter or a digit")
+	}
+
+	list, err := s.repo.Search(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range list {
+		text := item.Name
+		if item.Surname != nil && *item.Surname != "" {
+			text += " " + *item.Surname
+		}
+		item.Highlight = search.Highlight(text, params.Query, "<mark>", "</mark>")
+	}
+
+	return list, nil
+}
+
+// Export streams every user matching the list filters, sorting defaults are the ones of GetList
+func (s *UserService) Export(ctx context.Context, params model.UserListParams, fn func(user *model.User) error) error {
+	params, err := sorting(params)
+	if err != nil {
+		return err
+	}
+	params.Limit = 0
+	params.Offset = 0
+	params.Cursor = nil
+
+	return s.repo.Export(ctx, params, fn)
+}
+
+// sorting validates the sort field and falls back to the sorting of the cursor
+// when none is given, then to the insertion order
+func sorting(params model.UserListParams) (model.UserListParams, error) {
+	if params.SortBy != "" && !model.IsValidUserSortField(params.SortBy) {
+		return params, model.NewParamError(model.ErrRequestInvalidSortField, "sort", "must be one of "+strings.Join(model.UserSortFields, ", "))
+	}
+
+	if params.Cursor != nil && params.SortBy == "" && !params.SortDesc {
+		params.SortBy = params.Cursor.SortBy
+		params.SortDesc = params.Cursor.SortDesc
+	}
+
+	if params.SortBy == "" {
+		params.SortBy = model.UserSortInsertedAt
+	}
+
+	return params, nil
+}
+
+// Create and Update validate the raw input, a nil name is reported as missing
 func (s *UserService) Create(
 	ctx context.Context,
-	name string,
+	name *string,
 	surname *string,
-) error {
-	return s.repo.Create(ctx, name, surname)
+) (*model.User, error) {
+	input, err := normalize(name, surname)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.Create(ctx, input.Name, input.Surname)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.UsersCreatedTotal.Inc()
+	return user, nil
 }
 
+// Update and Delete are conditional when version is not 0, see UserRepository
 func (s *UserService) Update(
 	ctx context.Context,
 	id uint,
-	name string,
+	name *string,
 	surname *string,
-) error {
-	exists, err := s.repo.CheckIfExists(ctx, id)
+	version uint,
+) (*model.User, error) {
+	input, err := normalize(name, surname)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.repo.CheckIfExists(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, model.ErrNoUserWithSuchId
+	}
+
+	user, err := s.repo.Update(ctx, id, input.Name, input.Surname, version)
+	if err != nil {
+		if errors.Is(err, model.ErrSqlNoRows) {
+			return nil, model.ErrNoUserWithSuchId
+		}
+		return nil, err
+	}
+
+	metrics.UsersUpdatedTotal.Inc()
+	return user, nil
+}
+
+// Patch applies a merge patch or a json patch on top of the stored user and persists
+// only the changed columns, plain application/json is treated as a merge patch.
+// Like Update the write is conditional only when version is not 0
+func (s *UserService) Patch(ctx context.Context, id uint, contentType string, body []byte, version uint) (*model.User, error) {
+	user, err := s.Get(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && user.Version != version {
+		return nil, model.ErrUserVersionMismatch
+	}
+
+	doc, err := json.Marshal(model.UpdateUserRequest{
+		Name:    &user.Name,
+		Surname: user.Surname,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+
+	switch contentType {
+	case patch.MergePatchContentType, "application/json":
+		patched, err = patch.Merge(doc, body)
+	case patch.JsonPatchContentType:
+		patched, err = patch.Apply(doc, body)
+	default:
+		return nil, model.ErrRequestUnsupportedMediaType
+	}
+	if err != nil {
+		if errors.Is(err, patch.ErrInvalidPatch) {
+			return nil, errors.Join(err, model.ErrRequestInvalidPatch)
+		}
+		return nil, errors.Join(err, model.ErrRequestPatchConflict)
+	}
+
+	var result model.UpdateUserRequest
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&result)
+	if err != nil {
+		return nil, errors.Join(err, model.ErrRequestInvalidPatch)
+	}
+
+	changes, err := diff(user, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if changes.IsEmpty() {
+		return user, nil
+	}
+
+	user, err = s.repo.Patch(ctx, id, changes, version)
+	if err != nil {
+		if errors.Is(err, model.ErrSqlNoRows) {
+			return nil, model.ErrNoUserWithSuchId
+		}
+		return nil, err
+	}
+
+	metrics.UsersUpdatedTotal.Inc()
+	return user, nil
+}
+
+// diff validates the patched document the same way as create and update do
+// and returns the columns that differ from the stored user
+func diff(user *model.User, patched model.UpdateUserRequest) (model.UserChanges, error) {
+	var changes model.UserChanges
+
+	result, err := normalize(patched.Name, patched.Surname)
+	if err != nil {
+		return changes, err
+	}
+
+	if result.Name != user.Name {
+		changes.Name = &result.Name
+	}
+
+	surname := result.Surname
+	if (surname == nil) != (user.Surname == nil) ||
+		(surname != nil && *surname != *user.Surname) {
+		changes.Surname = surname
+		changes.SurnameSet = true
+	}
+
+	return changes, nil
+}
+
+// normalize is the single validator of user input: markup is sanitized, spaces are trimmed,
+// a non blank name is required and both values must fit the columns
+func normalize(name *string, surname *string) (model.NewUser, error) {
+	var result model.NewUser
+
+	if name == nil {
+		return result, model.NewParamError(model.ErrRequestNameRequired, "name", "is required")
+	}
+
+	result.Name = strings.TrimSpace(helper.SanitizeInput(*name))
+	if len(result.Name) == 0 {
+		return result, model.NewParamError(model.ErrRequestNameRequired, "name", "must not be blank")
+	}
+
+	if surname != nil {
+		value := strings.TrimSpace(helper.SanitizeInput(*surname))
+		result.Surname = &value
+	}
+
+	return result, storable(result)
+}
+
+// storable rejects values the users columns can't hold, in an import a single one would fail the whole COPY
+func storable(user model.NewUser) error {
+	err := storableText("name", user.Name)
+	if err != nil || user.Surname == nil {
+		return err
+	}
+
+	return storableText("surname", *user.Surname)
+}
+
+func storableText(field string, value string) error {
+	if !utf8.ValidString(value) || strings.ContainsRune(value, 0) {
+		return model.NewParamError(model.ErrRequestInvalidBodyParams, field, "must be valid utf-8 text")
+	}
+
+	if utf8.RuneCountInString(value) > model.UserNameMaxLength {
+		return model.NewParamError(model.ErrRequestInvalidBodyParams, field, fmt.Sprintf("must be at most %d characters", model.UserNameMaxLength))
+	}
+
+	return nil
+}
+
+func (s *UserService) Delete(ctx context.Context, id uint, version uint) error {
+	exists, err := s.repo.CheckIfExists(ctx, id, false)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return model.ErrNoUserWithSuchId
+	}
+
+	err = s.repo.Delete(ctx, id, version)
+	if err != nil {
+		if errors.Is(err, model.ErrSqlNoRows) {
+			return model.ErrNoUserWithSuchId
+		}
+		return err
+	}
+
+	metrics.UsersDeletedTotal.Inc()
+	return nil
+}
+
+func (s *UserService) Restore(ctx context.Context, id uint) error {
+	exists, err := s.repo.CheckIfExists(ctx, id, true)
 	if err != nil {
 		return err
 	}
@@ -62,5 +376,32 @@ func (s *UserService) Update(
 		return model.ErrNoUserWithSuchId
 	}
 
-	return s.repo.Update(ctx, id, name, surname)
+	user, err := s.repo.Get(ctx, id, true)
+	if err != nil {
+		return err
+	}
+
+	if user.DeletedAt == nil {
+		return model.ErrUserNotDeleted
+	}
+
+	err = s.repo.Restore(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	metrics.UsersRestoredTotal.Inc()
+	return nil
+}
+
+// Purge hard deletes users which stayed soft deleted longer than db.softDeleteRetention hours
+func (s *UserService) Purge(ctx context.Context) (int64, error) {
+	retention := time.Duration(s.cfg.Db.SoftDeleteRetention) * time.Hour
+	purged, err := s.repo.Purge(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.UsersPurgedTotal.Add(float64(purged))
+	return purged, nil
 }
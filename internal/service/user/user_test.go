@@ -0,0 +1,89 @@
+package user
+
+import (
+	"context"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateValidatesInput(t *testing.T) {
+	// the repository is never reached by invalid input
+	service := NewService(&config.Config{}, &failingRepository{})
+
+	blank := " \t "
+	long := strings.Repeat("a", model.UserNameMaxLength+1)
+
+	tests := []struct {
+		name   *string
+		param  string
+		reason string
+	}{
+		{nil, "name", "is required"},
+		{&blank, "name", "must not be blank"},
+		{&long, "name", "must be at most 100 characters"},
+	}
+	for _, test := range tests {
+		_, err := service.Create(context.Background(), test.name, nil)
+
+		var paramErr *model.ParamError
+		require.ErrorAs(t, err, &paramErr)
+		assert.Equal(t, []model.InvalidParam{{Name: test.param, Reason: test.reason}}, paramErr.Params)
+	}
+}
+
+func TestSortingFollowsCursor(t *testing.T) {
+	cursor := &model.UserCursor{SortBy: model.UserSortName, SortDesc: true, Id: 1}
+
+	params, err := sorting(model.UserListParams{Cursor: cursor})
+	require.NoError(t, err)
+	assert.Equal(t, model.UserSortName, params.SortBy)
+	assert.True(t, params.SortDesc)
+
+	params, err = sorting(model.UserListParams{})
+	require.NoError(t, err)
+	assert.Equal(t, model.UserSortInsertedAt, params.SortBy)
+
+	_, err = sorting(model.UserListParams{SortBy: "password"})
+	assert.ErrorIs(t, err, model.ErrRequestInvalidSortField)
+}
+
+// versionRepository stores one user and records the version a patch was conditional on
+type versionRepository struct {
+	repository.UserRepository
+	user    model.User
+	patched *uint
+}
+
+func (r *versionRepository) CheckIfExists(ctx context.Context, id uint, includeDeleted bool) (bool, error) {
+	return id == r.user.Id, nil
+}
+
+func (r *versionRepository) Get(ctx context.Context, id uint, includeDeleted bool) (*model.User, error) {
+	user := r.user
+	return &user, nil
+}
+
+func (r *versionRepository) Patch(ctx context.Context, id uint, changes model.UserChanges, version uint) (*model.User, error) {
+	r.patched = &version
+	return r.Get(ctx, id, false)
+}
+
+func TestPatchIsConditionalOnIfMatchOnly(t *testing.T) {
+	repo := &versionRepository{user: model.User{Id: 1, Name: "Ada", Version: 3}}
+	service := NewService(&config.Config{}, repo)
+
+	_, err := service.Patch(context.Background(), 1, "application/json", []byte(`{"name":"Grace"}`), 0)
+	require.NoError(t, err)
+	require.NotNil(t, repo.patched)
+	assert.Equal(t, uint(0), *repo.patched, "no If-Match, the version just read is not a precondition")
+
+	_, err = service.Patch(context.Background(), 1, "application/json", []byte(`{"name":"Grace"}`), 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), *repo.patched)
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"gravitum-test-app/internal/model"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// blockedPrefixes are not covered by the netip.Addr predicates
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade nat, often internal
+}
+
+// isPublic tells if webhooks may be sent to addr, internal hosts and cloud metadata
+// endpoints such as 169.254.169.254 are refused
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDestination resolves host and refuses it when any of its addresses is not public
+func (s *WebhookService) checkDestination(ctx context.Context, host string) error {
+	if s.cfg.Webhook.AllowPrivate {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return model.NewParamError(model.ErrWebhookInvalidUrl, "url", "host does not resolve")
+	}
+
+	for _, addr := range addrs {
+		if !isPublic(addr) {
+			return model.NewParamError(model.ErrWebhookForbiddenDestination, "url", "must not point to a loopback, private or link-local address")
+		}
+	}
+
+	return nil
+}
+
+// newClient checks the address of every connection, so a dns change after registration
+// can't point a webhook at an internal host
+func (s *WebhookService) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			if s.cfg.Webhook.AllowPrivate {
+				return nil
+			}
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !isPublic(addr) {
+				return fmt.Errorf("%w: %s", model.ErrWebhookForbiddenDestination, address)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would be dialed instead of the receiver and the check above would be moot
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport: transport,
+		// a redirect would send the signed body to another url
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,311 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/metrics"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/internal/repository"
+	"gravitum-test-app/pkg/webhook"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SecretPrefix starts every generated signing secret
+const SecretPrefix = "whsec_"
+
+// defaults for a zero config, e.g. in tests
+const (
+	defaultBatchSize   = 100
+	defaultTimeout     = 10 * time.Second
+	defaultMaxAttempts = 10
+	defaultBackoffBase = 5 * time.Second
+	defaultBackoffMax  = time.Hour
+	defaultRetention   = 7 * 24 * time.Hour
+)
+
+type WebhookService struct {
+	cfg    *config.Config
+	repo   repository.WebhookRepository
+	client *http.Client
+}
+
+func NewService(
+	cfg *config.Config,
+	repo repository.WebhookRepository,
+) *WebhookService {
+	s := &WebhookService{
+		cfg:  cfg,
+		repo: repo,
+	}
+	s.client = s.newClient()
+
+	return s
+}
+
+func (s *WebhookService) GetList(ctx context.Context) ([]*model.Webhook, error) {
+	return s.repo.GetList(ctx)
+}
+
+// Create returns the webhook with its signing secret, later reads don't show it.
+// Urls resolving to loopback, private or link-local addresses are refused unless webhook.allowPrivate
+func (s *WebhookService) Create(ctx context.Context, rawUrl string, eventTypes []string) (*model.Webhook, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, model.NewParamError(model.ErrWebhookInvalidUrl, "url", "must be an absolute http or https url")
+	}
+
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, eventType := range eventTypes {
+		if !model.IsValidEventType(eventType) {
+			return nil, model.NewParamError(model.ErrWebhookInvalidEventType, "event_types", "unknown event type "+eventType)
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			unique = append(unique, eventType)
+		}
+	}
+
+	err = s.checkDestination(ctx, parsed.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.Create(ctx, rawUrl, SecretPrefix+base64.RawURLEncoding.EncodeToString(b), unique)
+}
+
+func (s *WebhookService) Delete(ctx context.Context, id uint) error {
+	err := s.repo.Delete(ctx, id)
+	if errors.Is(err, model.ErrSqlNoRows) {
+		return model.ErrNoWebhookWithSuchId
+	}
+	return err
+}
+
+func (s *WebhookService) GetDeliveries(ctx context.Context, id uint, status *string, limit uint) ([]*model.WebhookDelivery, error) {
+	_, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit == 0 {
+		limit = s.cfg.Db.Limit
+	}
+	if s.cfg.Db.MaxLimit > 0 && limit > s.cfg.Db.MaxLimit {
+		limit = s.cfg.Db.MaxLimit
+	}
+
+	return s.repo.GetDeliveries(ctx, id, status, limit)
+}
+
+// Replay sends dead deliveries of the webhook again, each gets a fresh set of attempts
+func (s *WebhookService) Replay(ctx context.Context, id uint) (int64, error) {
+	_, err := s.get(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.repo.Replay(ctx, id)
+}
+
+// Test sends a webhook.test event to the webhook right away, the attempt is not stored
+func (s *WebhookService) Test(ctx context.Context, id uint) (*model.DeliveryAttempt, error) {
+	hook, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := json.Marshal(map[string]uint{"webhook_id": hook.Id})
+	event := &model.Event{
+		Type:      model.EventWebhookTest,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	attempt := s.send(ctx, hook.Url, hook.Secret, 0, event)
+	return &attempt, nil
+}
+
+// Dispatch runs one round of the outbox: new events are queued for their webhooks,
+// then due deliveries are sent concurrently. Deliveries are leased while being sent,
+// when the process dies before the result is stored they are sent again after the lease,
+// so receivers get every event at least once and should dedupe by the X-Webhook-Id header.
+// It returns the number of deliveries attempted
+func (s *WebhookService) Dispatch(ctx context.Context) (int, error) {
+	_, err := s.repo.FanOut(ctx, s.batchSize())
+	if err != nil {
+		return 0, err
+	}
+
+	deliveries, err := s.repo.Claim(ctx, s.batchSize(), 2*s.timeout())
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(deliveries))
+
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		go func(i int, delivery *model.WebhookDelivery) {
+			defer wg.Done()
+
+			attempt := s.send(ctx, delivery.Url, delivery.Secret, delivery.Id, &delivery.Event)
+			errs[i] = s.complete(ctx, delivery, attempt)
+		}(i, delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), errors.Join(errs...)
+}
+
+// DeleteExpired drops events and finished deliveries older than Webhook.Retention hours.
+// With the dispatcher disabled events are never dispatched, so undispatched ones are dropped too
+func (s *WebhookService) DeleteExpired(ctx context.Context) (int64, int64, error) {
+	return s.repo.DeleteExpired(ctx, time.Now().Add(-s.retention()), !s.cfg.Webhook.Enabled)
+}
+
+// complete moves the delivery to delivered, back to pending with a backoff or to dead
+func (s *WebhookService) complete(ctx context.Context, delivery *model.WebhookDelivery, attempt model.DeliveryAttempt) error {
+	attempts := delivery.Attempts + 1
+	status := model.DeliveryStatusPending
+	nextAttemptAt := time.Now()
+
+	switch {
+	case attempt.Succeeded():
+		status = model.DeliveryStatusDelivered
+	case attempts >= s.maxAttempts():
+		status = model.DeliveryStatusDead
+	default:
+		nextAttemptAt = nextAttemptAt.Add(Backoff(attempts, s.backoffBase(), s.backoffMax()))
+	}
+
+	metrics.WebhookDeliveriesTotal.WithLabelValues(status).Inc()
+
+	return s.repo.Complete(ctx, delivery.Id, attempt, status, nextAttemptAt)
+}
+
+// send posts the event signed with secret, any 2xx response is a success
+func (s *WebhookService) send(ctx context.Context, target string, secret string, deliveryId uint, event *model.Event) model.DeliveryAttempt {
+	var attempt model.DeliveryAttempt
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(timeoutCtx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	sentAt := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gravitum-test-app-webhook")
+	req.Header.Set(webhook.IdHeader, strconv.FormatUint(uint64(deliveryId), 10))
+	req.Header.Set(webhook.EventHeader, event.Type)
+	req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(sentAt.Unix(), 10))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, sentAt, body))
+
+	resp, err := s.client.Do(req)
+	attempt.DurationMs = float64(time.Since(sentAt).Microseconds()) / 1000
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	// the body is drained so the connection is reused, its content is ignored
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if !attempt.Succeeded() {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return attempt
+}
+
+func (s *WebhookService) get(ctx context.Context, id uint) (*model.Webhook, error) {
+	hook, err := s.repo.Get(ctx, id)
+	if errors.Is(err, model.ErrSqlNoRows) {
+		return nil, model.ErrNoWebhookWithSuchId
+	}
+	return hook, err
+}
+
+// Backoff is the delay before attempt+1, base doubled for every failed attempt up to max
+func Backoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+func (s *WebhookService) batchSize() int {
+	if s.cfg.Webhook.BatchSize > 0 {
+		return s.cfg.Webhook.BatchSize
+	}
+	return defaultBatchSize
+}
+
+func (s *WebhookService) timeout() time.Duration {
+	if s.cfg.Webhook.Timeout > 0 {
+		return time.Duration(s.cfg.Webhook.Timeout) * time.Second
+	}
+	return defaultTimeout
+}
+
+func (s *WebhookService) maxAttempts() int {
+	if s.cfg.Webhook.MaxAttempts > 0 {
+		return s.cfg.Webhook.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+func (s *WebhookService) backoffBase() time.Duration {
+	if s.cfg.Webhook.BackoffBase > 0 {
+		return time.Duration(s.cfg.Webhook.BackoffBase) * time.Second
+	}
+	return defaultBackoffBase
+}
+
+func (s *WebhookService) backoffMax() time.Duration {
+	if s.cfg.Webhook.BackoffMax > 0 {
+		return time.Duration(s.cfg.Webhook.BackoffMax) * time.Second
+	}
+	return defaultBackoffMax
+}
+
+func (s *WebhookService) retention() time.Duration {
+	if s.cfg.Webhook.Retention > 0 {
+		return time.Duration(s.cfg.Webhook.Retention) * time.Hour
+	}
+	return defaultRetention
+}
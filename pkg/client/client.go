@@ -0,0 +1,241 @@
+// Package client is a Go client of the users http api. It unwraps the response envelope,
+// follows cursor pagination and decodes error responses into *Error, whose err.* code
+// matches the sentinels of this package with errors.Is.
+// Requests failing with 429, 5xx or a transport error are retried with exponential backoff,
+// creates carry an Idempotency-Key so their retries never create a user twice.
+// Updates and deletes can't be replayed safely, they are retried only after 429
+// or a transport error hit before the request was sent
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ApiKeyHeader    = "X-API-SECRET-KEY"
+	RequestIdHeader = "X-Request-ID"
+
+	idempotencyKeyHeader = "Idempotency-Key"
+	problemContentType   = "application/problem+json"
+
+	defaultMaxRetries = 3
+	defaultBackoff    = 200 * time.Millisecond
+	maxBackoff        = 10 * time.Second
+)
+
+type Client struct {
+	baseUrl    string
+	apiKey     string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+type Option func(c *Client)
+
+// WithApiKey sends key in ApiKeyHeader, needed when the server enables api keys
+func WithApiKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithHttpClient replaces http.DefaultClient, e.g. to set timeouts or a transport
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetry sets how many times a failed request is retried and the delay before the first retry,
+// doubled on every next one. 0 retries disables them
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// New returns a client of the api at baseUrl such as http://localhost:8080
+func New(baseUrl string, options ...Option) *Client {
+	c := &Client{
+		baseUrl:    strings.TrimRight(baseUrl, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// response is the envelope of every successful json response
+type response struct {
+	Data json.RawMessage `json:"data"`
+	Page *Page           `json:"page"`
+}
+
+// do sends the request with retries and unwraps the envelope, body is marshalled to json when not nil
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	query url.Values,
+	header http.Header,
+	body interface{},
+) (*response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	target := c.baseUrl + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	// a lost response of an update or a delete must not be answered by a retry with 412 or 404
+	replayable := method == http.MethodGet || header.Get(idempotencyKeyHeader) != ""
+
+	for attempt := 0; ; attempt++ {
+		var sent atomic.Bool
+		trace := &httptrace.ClientTrace{
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				sent.Store(info.Err == nil)
+			},
+		}
+
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, target, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.apiKey != "" {
+			req.Header.Set(ApiKeyHeader, c.apiKey)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.maxRetries || (sent.Load() && !replayable) {
+				return nil, err
+			}
+			if err = c.wait(ctx, attempt, ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || (replayable && resp.StatusCode >= http.StatusInternalServerError)
+		if retryable && attempt < c.maxRetries {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			if err = c.wait(ctx, attempt, resp.Header.Get("Retry-After")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return decode(resp)
+	}
+}
+
+// wait sleeps before the retry following attempt, Retry-After in seconds takes precedence over the backoff
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter string) error {
+	delay := c.backoff << attempt
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	// full jitter on the upper half, so clients failing together don't retry together
+	delay = delay/2 + rand.N(delay/2+1)
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func decode(resp *http.Response) (*response, error) {
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, decodeError(resp, raw)
+	}
+
+	var result response
+	if len(raw) > 0 {
+		if err = json.Unmarshal(raw, &result); err != nil {
+			return nil, err
+		}
+	}
+
+	return &result, nil
+}
+
+func decodeError(resp *http.Response, raw []byte) *Error {
+	result := &Error{
+		StatusCode: resp.StatusCode,
+		StatusText: http.StatusText(resp.StatusCode),
+		Code:       ErrResponseUnexpectedStatusCode.Error(),
+		RequestId:  resp.Header.Get(RequestIdHeader),
+	}
+
+	var body errorBody
+	if json.Unmarshal(raw, &body) != nil {
+		return result
+	}
+
+	switch {
+	case strings.HasPrefix(resp.Header.Get("Content-Type"), problemContentType) && body.Code != "":
+		result.Code = body.Code
+		result.Title = body.Title
+		result.InvalidParams = body.InvalidParams
+		if body.RequestId != "" {
+			result.RequestId = body.RequestId
+		}
+	case body.Errors != nil && body.Errors.Err != "":
+		result.Code = body.Errors.Err
+		result.StatusText = body.Errors.StatusText
+	}
+
+	return result
+}
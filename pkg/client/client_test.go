@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gravitum-test-app/config"
+	"gravitum-test-app/internal/app"
+	"gravitum-test-app/internal/model"
+	"gravitum-test-app/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer runs the app on the memory driver and serves its router with httptest,
+// handler wraps the router to inject failures
+func newTestServer(t *testing.T, cfg *config.Config, handler func(next http.Handler) http.Handler) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+
+	cfg.App.Host = "127.0.0.1"
+	cfg.App.Port = "0"
+	cfg.App.ShutdownTimeout = 1
+	cfg.App.IdempotencyTtl = 24
+	cfg.Db.Driver = config.DriverMemory
+	cfg.Db.Limit = 20
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := app.New(cfg, logger.New(logger.GetLevelByString("error")))
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.Run(ctx)
+	}()
+
+	select {
+	case <-a.Started():
+	case err := <-runErr:
+		cancel()
+		t.Fatal(err)
+	}
+
+	var router http.Handler = a.Server.Handler
+	if handler != nil {
+		router = handler(router)
+	}
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() {
+		server.Close()
+		cancel()
+		<-runErr
+	})
+
+	return server
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func TestUsers(t *testing.T) {
+	server := newTestServer(t, &config.Config{}, nil)
+	c := New(server.URL, WithRetry(0, 0))
+	ctx := context.Background()
+
+	created, err := c.CreateUser(ctx, CreateUserRequest{Name: "Ada", Surname: ptr("Lovelace")})
+	require.NoError(t, err)
+	assert.NotZero(t, created.Id)
+	assert.Equal(t, "Ada", created.Name)
+	assert.Equal(t, ptr("Lovelace"), created.Surname)
+
+	user, err := c.GetUser(ctx, created.Id)
+	require.NoError(t, err)
+	assert.Equal(t, created.Version, user.Version)
+
+	updated, err := c.UpdateUser(ctx, created.Id, UpdateUserRequest{Name: "Ada", Version: user.Version})
+	require.NoError(t, err)
+	assert.Nil(t, updated.Surname, "absent surname clears it")
+	assert.Greater(t, updated.Version, user.Version)
+
+	_, err = c.UpdateUser(ctx, created.Id, UpdateUserRequest{Name: "Grace", Version: user.Version})
+	assert.ErrorIs(t, err, ErrUserVersionMismatch)
+
+	require.NoError(t, c.DeleteUser(ctx, created.Id))
+
+	_, err = c.GetUser(ctx, created.Id)
+	assert.ErrorIs(t, err, ErrNoUserWithSuchId)
+
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, "err.user.no_user_with_such_id", apiErr.Code)
+	assert.NotEmpty(t, apiErr.RequestId)
+}
+
+func TestListUsers(t *testing.T) {
+	server := newTestServer(t, &config.Config{}, nil)
+	c := New(server.URL)
+	ctx := context.Background()
+
+	for _, name := range []string{"Carol", "Alice", "Eve", "Bob", "Dave"} {
+		_, err := c.CreateUser(ctx, CreateUserRequest{Name: name})
+		require.NoError(t, err)
+	}
+
+	var names []string
+	for user, err := range c.ListUsers(ctx, ListUsersParams{Limit: 2, Sort: SortName, Desc: true}) {
+		require.NoError(t, err)
+		names = append(names, user.Name)
+	}
+	assert.Equal(t, []string{"Eve", "Dave", "Carol", "Bob", "Alice"}, names)
+
+	names = nil
+	for user, err := range c.ListUsers(ctx, ListUsersParams{Limit: 2, Sort: SortName}) {
+		require.NoError(t, err)
+		names = append(names, user.Name)
+		if len(names) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"Alice", "Bob", "Carol"}, names)
+
+	users, page, err := c.ListUsersPage(ctx, ListUsersParams{Limit: 2, NamePrefix: ptr("a")}, "")
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "Alice", users[0].Name)
+	assert.EqualValues(t, 1, page.Total)
+	assert.Nil(t, page.NextCursor)
+
+	for _, err := range c.ListUsers(ctx, ListUsersParams{Sort: "age"}) {
+		assert.ErrorIs(t, err, ErrRequestInvalidSortField)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var requests, failures atomic.Int32
+	failures.Store(2)
+
+	// the first responses are lost after the router handled the request, like a proxy timing out
+	server := newTestServer(t, &config.Config{}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if failures.Add(-1) >= 0 {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+
+	c := New(server.URL, WithRetry(3, time.Millisecond))
+	created, err := c.CreateUser(ctx, CreateUserRequest{Name: "Ada"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, requests.Load())
+
+	_, page, err := c.ListUsersPage(ctx, ListUsersParams{}, "")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, page.Total, "retries replay the first create")
+
+	failures.Store(5)
+	requests.Store(0)
+	_, err = c.GetUser(ctx, created.Id)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.ErrorIs(t, err, ErrResponseUnexpectedStatusCode)
+	assert.EqualValues(t, 4, requests.Load())
+
+	failures.Store(5)
+	requests.Store(0)
+	_, err = New(server.URL, WithRetry(0, 0)).GetUser(ctx, created.Id)
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, requests.Load())
+}
+
+func TestRetrySkipsSentWrites(t *testing.T) {
+	var requests, failures atomic.Int32
+
+	// the router handles the request, then the connection drops or a proxy answers 502
+	server := newTestServer(t, &config.Config{}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if failures.Add(-1) >= 0 {
+				next.ServeHTTP(httptest.NewRecorder(), r)
+				if r.Method == http.MethodDelete {
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					conn.Close()
+					return
+				}
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+
+	c := New(server.URL, WithRetry(3, time.Millisecond))
+	created, err := c.CreateUser(ctx, CreateUserRequest{Name: "Ada"})
+	require.NoError(t, err)
+
+	failures.Store(1)
+	requests.Store(0)
+	_, err = c.UpdateUser(ctx, created.Id, UpdateUserRequest{Name: "Grace", Version: created.Version})
+	assert.ErrorIs(t, err, ErrResponseUnexpectedStatusCode, "the 502 is returned, a retry would get 412")
+	assert.EqualValues(t, 1, requests.Load())
+
+	failures.Store(1)
+	requests.Store(0)
+	err = c.DeleteUser(ctx, created.Id)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNoUserWithSuchId, "the transport error is returned, a retry would get 404")
+	assert.EqualValues(t, 1, requests.Load())
+
+	_, err = c.GetUser(ctx, created.Id)
+	assert.ErrorIs(t, err, ErrNoUserWithSuchId, "the first delete went through")
+}
+
+func TestRetryHonorsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := New(server.URL).GetUser(ctx, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestProblemJson(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.ProblemJson = true
+	server := newTestServer(t, cfg, nil)
+
+	_, err := New(server.URL).CreateUser(context.Background(), CreateUserRequest{Name: " "})
+	assert.ErrorIs(t, err, ErrRequestNameRequired)
+
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "Name is required", apiErr.Title)
+	assert.Equal(t, []InvalidParam{{Name: "name", Reason: "must not be blank"}}, apiErr.InvalidParams)
+	assert.NotEmpty(t, apiErr.RequestId)
+}
+
+// TestErrorCodes fails when the server catalog gets a code the client doesn't know
+func TestErrorCodes(t *testing.T) {
+	for _, definition := range model.ErrorCatalog() {
+		err := &Error{Code: definition.Code}
+		assert.NotNil(t, err.Unwrap(), definition.Code)
+	}
+	assert.True(t, errors.Is(&Error{Code: model.ErrorCodeInternal}, ErrInternal))
+	assert.Nil(t, (&Error{Code: "err.unknown"}).Unwrap())
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinels of the err.* codes of the api, match them with errors.Is:
+//
+//	if errors.Is(err, client.ErrNoUserWithSuchId) { ... }
+var (
+	ErrInternal                          = errors.New("err.internal")
+	ErrResponseUnexpectedStatusCode      = errors.New("err.response.unexpected_status_code")
+	ErrSecurityUnauthorized              = errors.New("err.security.unauthorized")
+	ErrSecurityUnauthorizedNoHeader      = errors.New("err.security.unauthorized-no-header")
+	ErrSecurityUnauthorizedInvalidHeader = errors.New("err.security.unauthorized-invalid-header")
+	ErrSecurityAbsentSecret              = errors.New("err.security.absent-secret")
+	ErrSecurityInvalidSecret             = errors.New("err.security.invalid-secret")
+	ErrSecurityInsufficientScope         = errors.New("err.security.insufficient-scope")
+	ErrSecurityApiKeyRequired            = errors.New("err.security.api-key-required")
+	ErrRequestInvalidUrlParams           = errors.New("err.request.invalid_url_params")
+	ErrRequestInvalidBodyParams          = errors.New("err.request.invalid_body_params")
+	ErrRequestInvalidQueryParams         = errors.New("err.request.invalid_query_params")
+	ErrRequestInvalidSortField           = errors.New("err.request.invalid_sort_field")
+	ErrRequestInvalidSortOrder           = errors.New("err.request.invalid_sort_order")
+	ErrRequestInvalidCursor              = errors.New("err.request.invalid_cursor")
+	ErrRequestNameRequired               = errors.New("err.request.name_required")
+	ErrRequestRouteNotFound              = errors.New("err.request.route_not_found")
+	ErrRequestUnsupportedMediaType       = errors.New("err.request.unsupported_media_type")
+	ErrRequestInvalidPatch               = errors.New("err.request.invalid_patch")
+	ErrRequestPatchConflict              = errors.New("err.request.patch_conflict")
+	ErrRequestInvalidExportFormat        = errors.New("err.request.invalid_export_format")
+	ErrRequestInvalidPrecondition        = errors.New("err.request.invalid_precondition")
+	ErrRequestBodyTooLarge               = errors.New("err.request.body_too_large")
+	ErrNoUserWithSuchId                  = errors.New("err.user.no_user_with_such_id")
+	ErrUserNotDeleted                    = errors.New("err.user.not_deleted")
+	ErrUserVersionMismatch               = errors.New("err.user.version_mismatch")
+	ErrNoApiKeyWithSuchId                = errors.New("err.api_key.no_api_key_with_such_id")
+	ErrApiKeyInvalidScope                = errors.New("err.api_key.invalid_scope")
+	ErrNoWebhookWithSuchId               = errors.New("err.webhook.no_webhook_with_such_id")
+	ErrWebhookInvalidUrl                 = errors.New("err.webhook.invalid_url")
+	ErrWebhookInvalidEventType           = errors.New("err.webhook.invalid_event_type")
+	ErrWebhookForbiddenDestination       = errors.New("err.webhook.forbidden_destination")
+	ErrIdempotencyInvalidKey             = errors.New("err.idempotency.invalid_key")
+	ErrIdempotencyKeyReused              = errors.New("err.idempotency.key_reused")
+	ErrIdempotencyInProgress             = errors.New("err.idempotency.in_progress")
+	ErrRateLimitExceeded                 = errors.New("err.rate_limit.exceeded")
+	ErrHealthShuttingDown                = errors.New("err.health.shutting_down")
+	ErrHealthMigrationsOutdated          = errors.New("err.health.migrations_outdated")
+	ErrSqlNoRows                         = errors.New("err.sql.no_rows")
+	ErrSqlUniqueViolation                = errors.New("err.sql.unique_violation")
+)
+
+var codes = map[string]error{}
+
+func init() {
+	for _, err := range []error{
+		ErrInternal,
+		ErrResponseUnexpectedStatusCode,
+		ErrSecurityUnauthorized,
+		ErrSecurityUnauthorizedNoHeader,
+		ErrSecurityUnauthorizedInvalidHeader,
+		ErrSecurityAbsentSecret,
+		ErrSecurityInvalidSecret,
+		ErrSecurityInsufficientScope,
+		ErrSecurityApiKeyRequired,
+		ErrRequestInvalidUrlParams,
+		ErrRequestInvalidBodyParams,
+		ErrRequestInvalidQueryParams,
+		ErrRequestInvalidSortField,
+		ErrRequestInvalidSortOrder,
+		ErrRequestInvalidCursor,
+		ErrRequestNameRequired,
+		ErrRequestRouteNotFound,
+		ErrRequestUnsupportedMediaType,
+		ErrRequestInvalidPatch,
+		ErrRequestPatchConflict,
+		ErrRequestInvalidExportFormat,
+		ErrRequestInvalidPrecondition,
+		ErrRequestBodyTooLarge,
+		ErrNoUserWithSuchId,
+		ErrUserNotDeleted,
+		ErrUserVersionMismatch,
+		ErrNoApiKeyWithSuchId,
+		ErrApiKeyInvalidScope,
+		ErrNoWebhookWithSuchId,
+		ErrWebhookInvalidUrl,
+		ErrWebhookInvalidEventType,
+		ErrWebhookForbiddenDestination,
+		ErrIdempotencyInvalidKey,
+		ErrIdempotencyKeyReused,
+		ErrIdempotencyInProgress,
+		ErrRateLimitExceeded,
+		ErrHealthShuttingDown,
+		ErrHealthMigrationsOutdated,
+		ErrSqlNoRows,
+		ErrSqlUniqueViolation,
+	} {
+		codes[err.Error()] = err
+	}
+}
+
+// Error is a non 2xx response, decoded from the errors envelope or an
+// application/problem+json body
+type Error struct {
+	StatusCode    int
+	StatusText    string
+	Code          string // err.* code, err.response.unexpected_status_code when the body couldn't be decoded
+	Title         string // problem+json only
+	RequestId     string
+	InvalidParams []InvalidParam // problem+json only
+}
+
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	if e.Title != "" {
+		return fmt.Sprintf("client: %d %s: %s", e.StatusCode, e.Code, e.Title)
+	}
+	return fmt.Sprintf("client: %d %s", e.StatusCode, e.Code)
+}
+
+// Unwrap returns the sentinel of the code, nil for codes unknown to this version of the client
+func (e *Error) Unwrap() error {
+	return codes[e.Code]
+}
+
+// errorBody decodes both error formats of the api
+type errorBody struct {
+	// errors envelope
+	Errors *struct {
+		StatusCode int    `json:"status_code"`
+		StatusText string `json:"status_text"`
+		Err        string `json:"err"`
+	} `json:"errors"`
+
+	// problem+json
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Code          string         `json:"code"`
+	RequestId     string         `json:"request_id"`
+	InvalidParams []InvalidParam `json:"invalid_params"`
+}
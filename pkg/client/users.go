@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	SortId         = "id"
+	SortName       = "name"
+	SortSurname    = "surname"
+	SortInsertedAt = "inserted_at"
+	SortUpdatedAt  = "updated_at"
+)
+
+type User struct {
+	Id         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Surname    *string    `json:"surname,omitempty"`
+	InsertedAt time.Time  `json:"inserted_at"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	Version    uint       `json:"version"` // incremented by every write
+}
+
+type Page struct {
+	Total      int64   `json:"total"`
+	Limit      uint    `json:"limit"`
+	Offset     uint    `json:"offset"`
+	NextCursor *string `json:"next_cursor,omitempty"`
+}
+
+// ListUsersParams filters and sorts the list, zero values are left to the server defaults
+type ListUsersParams struct {
+	Limit          uint   // page size, capped by the server
+	Sort           string // one of the Sort constants, inserted_at by default
+	Desc           bool
+	NamePrefix     *string
+	HasSurname     *bool
+	InsertedFrom   *time.Time // inclusive
+	InsertedTo     *time.Time // exclusive
+	IncludeDeleted bool
+}
+
+func (p ListUsersParams) query(cursor string) url.Values {
+	query := url.Values{}
+
+	if p.Limit > 0 {
+		query.Set("limit", strconv.FormatUint(uint64(p.Limit), 10))
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Desc {
+		query.Set("order", "desc")
+	}
+	if p.NamePrefix != nil {
+		query.Set("name_prefix", *p.NamePrefix)
+	}
+	if p.HasSurname != nil {
+		query.Set("has_surname", strconv.FormatBool(*p.HasSurname))
+	}
+	if p.InsertedFrom != nil {
+		query.Set("inserted_from", p.InsertedFrom.Format(time.RFC3339Nano))
+	}
+	if p.InsertedTo != nil {
+		query.Set("inserted_to", p.InsertedTo.Format(time.RFC3339Nano))
+	}
+	if p.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	return query
+}
+
+type CreateUserRequest struct {
+	Name    string  `json:"name"`
+	Surname *string `json:"surname,omitempty"`
+}
+
+// UpdateUserRequest replaces name and surname, a nil surname clears it
+type UpdateUserRequest struct {
+	Name    string  `json:"name"`
+	Surname *string `json:"surname,omitempty"`
+	Version uint    `json:"-"` // sent as If-Match, 0 skips the check
+}
+
+// ListUsersPage fetches one page, cursor is the NextCursor of the previous page or empty for the first one
+func (c *Client) ListUsersPage(ctx context.Context, params ListUsersParams, cursor string) ([]*User, *Page, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/api/users/", params.query(cursor), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := []*User{}
+	if err = json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, nil, err
+	}
+
+	return result, resp.Page, nil
+}
+
+// ListUsers iterates over every user matching params, fetching the pages as needed.
+// The iteration stops after the first error:
+//
+//	for user, err := range c.ListUsers(ctx, params) {
+//		if err != nil { ... }
+//	}
+func (c *Client) ListUsers(ctx context.Context, params ListUsersParams) iter.Seq2[*User, error] {
+	return func(yield func(*User, error) bool) {
+		cursor := ""
+		for {
+			users, page, err := c.ListUsersPage(ctx, params, cursor)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for _, user := range users {
+				if !yield(user, nil) {
+					return
+				}
+			}
+
+			if page == nil || page.NextCursor == nil || len(users) == 0 {
+				return
+			}
+			cursor = *page.NextCursor
+		}
+	}
+}
+
+func (c *Client) GetUser(ctx context.Context, id uint) (*User, error) {
+	resp, err := c.do(ctx, http.MethodGet, userPath(id), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeUser(resp)
+}
+
+// CreateUser is sent with a random Idempotency-Key, retries of the same call get the first response
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set(idempotencyKeyHeader, key)
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/users/", nil, header, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeUser(resp)
+}
+
+// UpdateUser fails with ErrUserVersionMismatch when req.Version is set and the user was changed meanwhile
+func (c *Client) UpdateUser(ctx context.Context, id uint, req UpdateUserRequest) (*User, error) {
+	header := http.Header{}
+	if req.Version > 0 {
+		header.Set("If-Match", `"`+strconv.FormatUint(uint64(req.Version), 10)+`"`)
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, userPath(id), nil, header, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeUser(resp)
+}
+
+// DeleteUser soft deletes the user
+func (c *Client) DeleteUser(ctx context.Context, id uint) error {
+	_, err := c.do(ctx, http.MethodDelete, userPath(id), nil, nil, nil)
+	return err
+}
+
+func userPath(id uint) string {
+	return "/api/users/" + strconv.FormatUint(uint64(id), 10)
+}
+
+func decodeUser(resp *response) (*User, error) {
+	var result User
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/microcosm-cc/bluemonday"
 )
 
+// policy is built once, bluemonday policies are safe for concurrent use
+var policy = bluemonday.UGCPolicy() // policy for user-generated content
+
 func SanitizeInput(input string) string {
-	p := bluemonday.UGCPolicy() // Create a policy for user-generated content
-	return p.Sanitize(input)
+	return policy.Sanitize(input)
 }
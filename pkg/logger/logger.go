@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"os"
 	"strings"
 
@@ -18,6 +19,28 @@ func New(level zerolog.Level) *Logger {
 	}
 }
 
+type ctxKey struct{}
+
+// With returns a child logger adding the field to every line
+func (c *Logger) With(key string, value interface{}) *Logger {
+	return &Logger{
+		logger: c.logger.With().Interface(key, value).Logger(),
+	}
+}
+
+// NewContext stores the logger in ctx, see Ctx
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// Ctx returns the request scoped logger stored in ctx or c itself
+func (c *Logger) Ctx(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok && l != nil {
+		return l
+	}
+	return c
+}
+
 func GetLevelByString(level string) zerolog.Level {
 	level = strings.ToLower(level)
 
@@ -83,3 +106,15 @@ func (c *Logger) Info(message string) {
 func (c *Logger) Debug(message string) {
 	c.logger.Debug().Msg(message)
 }
+
+func (c *Logger) ErrorFields(message string, fields map[string]interface{}) {
+	c.logger.Error().Fields(fields).Msg(message)
+}
+
+func (c *Logger) WarnFields(message string, fields map[string]interface{}) {
+	c.logger.Warn().Fields(fields).Msg(message)
+}
+
+func (c *Logger) InfoFields(message string, fields map[string]interface{}) {
+	c.logger.Info().Fields(fields).Msg(message)
+}
@@ -0,0 +1,379 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType of the prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets suit http and db latencies in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu      sync.RWMutex
+	names   map[string]struct{}
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names: map[string]struct{}{},
+	}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.names[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = struct{}{}
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText renders every metric in registration order
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.WriteText(w)
+	})
+}
+
+// counter
+
+type Counter struct {
+	bits uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add panics on negative values, counters only go up
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+type CounterVec struct {
+	desc
+	mu     sync.RWMutex
+	series map[string]*labeled[*Counter]
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).WithLabelValues()
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		series: map[string]*labeled[*Counter]{},
+	}
+	r.register(name, v)
+	return v
+}
+
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return getOrCreate(&v.mu, v.series, v.desc, values, func() *Counter { return &Counter{} })
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.header(w)
+	for _, s := range sorted(&v.mu, v.series) {
+		v.sample(w, "", s.values, nil, s.metric.Value())
+	}
+}
+
+// gauge
+
+type Gauge struct {
+	bits uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+func (g *Gauge) Inc() {
+	addFloat(&g.bits, 1)
+}
+
+func (g *Gauge) Dec() {
+	addFloat(&g.bits, -1)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+type GaugeVec struct {
+	desc
+	mu     sync.RWMutex
+	series map[string]*labeled[*Gauge]
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).WithLabelValues()
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{
+		desc:   desc{name: name, help: help, kind: "gauge", labels: labels},
+		series: map[string]*labeled[*Gauge]{},
+	}
+	r.register(name, v)
+	return v
+}
+
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return getOrCreate(&v.mu, v.series, v.desc, values, func() *Gauge { return &Gauge{} })
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.header(w)
+	for _, s := range sorted(&v.mu, v.series) {
+		v.sample(w, "", s.values, nil, s.metric.Value())
+	}
+}
+
+// func metrics read their value at scrape time, e.g. from pgxpool.Stat
+
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{desc: desc{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	m.header(w)
+	m.sample(w, "", nil, nil, m.fn())
+}
+
+// histogram
+
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.RWMutex
+	series  map[string]*labeled[*Histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	v := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  map[string]*labeled[*Histogram]{},
+	}
+	r.register(name, v)
+	return v
+}
+
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return getOrCreate(&v.mu, v.series, v.desc, values, func() *Histogram {
+		return &Histogram{
+			buckets: v.buckets,
+			counts:  make([]uint64, len(v.buckets)),
+		}
+	})
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.header(w)
+	for _, s := range sorted(&v.mu, v.series) {
+		h := s.metric
+
+		h.mu.Lock()
+		counts := append([]uint64{}, h.counts...)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += counts[i]
+			v.sample(w, "_bucket", s.values, []string{"le", formatFloat(upper)}, float64(cumulative))
+		}
+		v.sample(w, "_bucket", s.values, []string{"le", "+Inf"}, float64(count))
+		v.sample(w, "_sum", s.values, nil, sum)
+		v.sample(w, "_count", s.values, nil, float64(count))
+	}
+}
+
+// shared
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+type labeled[T any] struct {
+	values []string
+	metric T
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, helpEscaper.Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// sample writes one line, extra is an additional label pair such as le for buckets
+func (d desc) sample(w *bufio.Writer, suffix string, values []string, extra []string, value float64) {
+	w.WriteString(d.name)
+	w.WriteString(suffix)
+
+	if len(values) > 0 || len(extra) > 0 {
+		w.WriteByte('{')
+		for i, label := range d.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, labelEscaper.Replace(values[i]))
+		}
+		if len(extra) > 0 {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extra[0], extra[1])
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func getOrCreate[T any](mu *sync.RWMutex, series map[string]*labeled[T], d desc, values []string, create func() T) T {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	mu.RLock()
+	s, ok := series[key]
+	mu.RUnlock()
+	if ok {
+		return s.metric
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, ok = series[key]
+	if !ok {
+		s = &labeled[T]{values: append([]string{}, values...), metric: create()}
+		series[key] = s
+	}
+	return s.metric
+}
+
+func sorted[T any](mu *sync.RWMutex, series map[string]*labeled[T]) []*labeled[T] {
+	mu.RLock()
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*labeled[T], 0, len(keys))
+	for _, key := range keys {
+		result = append(result, series[key])
+	}
+	mu.RUnlock()
+
+	return result
+}
+
+func addFloat(bits *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		updated := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(bits, old, updated) {
+			return
+		}
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
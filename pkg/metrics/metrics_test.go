@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounterVec("http_requests_total", "Total requests.", "method", "route")
+	requests.WithLabelValues("GET", "/api/users/:id").Inc()
+	requests.WithLabelValues("GET", "/api/users/:id").Add(2)
+	requests.WithLabelValues("POST", `/a"b\`).Inc()
+
+	inFlight := r.NewGauge("in_flight", "Requests in flight.")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	r.NewGaugeFunc("pool_idle", "Idle\nconns.", func() float64 { return 4 })
+
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	latency.WithLabelValues("/").Observe(0.05)
+	latency.WithLabelValues("/").Observe(0.1)
+	latency.WithLabelValues("/").Observe(3)
+
+	var b strings.Builder
+	err := r.WriteText(&b)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/api/users/:id"} 3
+http_requests_total{method="POST",route="/a\"b\\"} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP pool_idle Idle\nconns.
+# TYPE pool_idle gauge
+pool_idle 4
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/",le="0.1"} 2
+latency_seconds_bucket{route="/",le="1"} 2
+latency_seconds_bucket{route="/",le="+Inf"} 3
+latency_seconds_sum{route="/"} 3.15
+latency_seconds_count{route="/"} 3
+`, b.String())
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("up_total", "Up.").Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "up_total 1\n")
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("a_total", "A.")
+	assert.Panics(t, func() { r.NewGauge("a_total", "A.") })
+}
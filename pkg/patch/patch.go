@@ -0,0 +1,359 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"gravitum-test-app/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json" // RFC 7396
+	JsonPatchContentType  = "application/json-patch+json"  // RFC 6902
+)
+
+var (
+	ErrInvalidPatch = errors.New("err.patch.invalid")        // patch document is malformed
+	ErrPathNotFound = errors.New("err.patch.path_not_found") // patch is valid, but doesn't fit the document
+	ErrTestFailed   = errors.New("err.patch.test_failed")
+)
+
+// Merge applies an RFC 7396 merge patch, null members remove keys from the document
+func Merge(doc []byte, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(patch, &changes)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidPatch, err.Error())
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target interface{}, changes interface{}) interface{} {
+	changesObject, ok := changes.(map[string]interface{})
+	if !ok {
+		return changes
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range changesObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = merge(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"` // stays empty when absent, null is kept as a literal
+}
+
+// Apply applies an RFC 6902 json patch, operations are atomic: on any error the document is not changed
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []operation
+
+	err = json.Unmarshal(patch, &operations)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidPatch, err.Error())
+	}
+
+	for i, op := range operations {
+		target, err = apply(target, op)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("operation %d", i))
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func apply(doc interface{}, op operation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.Wrap(ErrInvalidPatch, "path is missing")
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, errors.Wrap(ErrInvalidPatch, "value is missing")
+		}
+
+		var value interface{}
+		err = json.Unmarshal(op.Value, &value)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidPatch, err.Error())
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		}
+
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, errors.Wrap(ErrTestFailed, *op.Path)
+		}
+		return doc, nil
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.Wrap(ErrInvalidPatch, "from is missing")
+		}
+
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			value, err = deepCopy(value)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+
+		// a location cannot be moved into one of its children
+		if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+			return nil, errors.Wrap(ErrInvalidPatch, "from is a prefix of path")
+		}
+
+		doc, err = remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	}
+
+	return nil, errors.Wrap(ErrInvalidPatch, fmt.Sprintf("unknown op %q", op.Op))
+}
+
+// parsePointer splits an RFC 6901 json pointer into unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.Wrap(ErrInvalidPatch, fmt.Sprintf("invalid pointer %q", pointer))
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, errors.Wrap(ErrPathNotFound, token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := index(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, errors.Wrap(ErrPathNotFound, token)
+		}
+	}
+
+	return doc, nil
+}
+
+// update replaces the value at path with the result of fn, containers are modified in place
+func update(doc interface{}, path []string, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	if len(path) == 0 {
+		return fn(doc)
+	}
+
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		child, ok := container[path[0]]
+		if !ok {
+			return nil, errors.Wrap(ErrPathNotFound, path[0])
+		}
+
+		value, err := update(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[path[0]] = value
+		return container, nil
+	case []interface{}:
+		i, err := index(path[0], len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := update(container[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = value
+		return container, nil
+	}
+
+	return nil, errors.Wrap(ErrPathNotFound, path[0])
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	key := path[len(path)-1]
+
+	return update(doc, path[:len(path)-1], func(parent interface{}) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[key] = value
+			return container, nil
+		case []interface{}:
+			if key == "-" {
+				return append(container, value), nil
+			}
+
+			i, err := index(key, len(container))
+			if err != nil {
+				return nil, err
+			}
+
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		}
+
+		return nil, errors.Wrap(ErrPathNotFound, key)
+	})
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.Wrap(ErrInvalidPatch, "root cannot be removed")
+	}
+
+	key := path[len(path)-1]
+
+	return update(doc, path[:len(path)-1], func(parent interface{}) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := container[key]; !ok {
+				return nil, errors.Wrap(ErrPathNotFound, key)
+			}
+			delete(container, key)
+			return container, nil
+		case []interface{}:
+			i, err := index(key, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:i], container[i+1:]...), nil
+		}
+
+		return nil, errors.Wrap(ErrPathNotFound, key)
+	})
+}
+
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	key := path[len(path)-1]
+
+	return update(doc, path[:len(path)-1], func(parent interface{}) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := container[key]; !ok {
+				return nil, errors.Wrap(ErrPathNotFound, key)
+			}
+			container[key] = value
+			return container, nil
+		case []interface{}:
+			i, err := index(key, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			container[i] = value
+			return container, nil
+		}
+
+		return nil, errors.Wrap(ErrPathNotFound, key)
+	})
+}
+
+// index parses an array index token, leading zeros are not allowed by RFC 6901
+func index(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.Wrap(ErrPathNotFound, token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, errors.Wrap(ErrPathNotFound, token)
+	}
+
+	return i, nil
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	err = json.Unmarshal(b, &result)
+	return result, err
+}
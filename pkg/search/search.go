@@ -0,0 +1,168 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WordSimilarityThreshold is the default pg_trgm.word_similarity_threshold used by the <% operator
+const WordSimilarityThreshold = 0.6
+
+// folding makes names typed without the letters of their alphabet match:
+// ё is commonly written as е and Kazakh letters are typed with their Russian look-alikes.
+// The users_search_normalize sql function must use the same table
+var folding = strings.NewReplacer(
+	"ё", "е",
+	"ә", "а",
+	"ғ", "г",
+	"қ", "к",
+	"ң", "н",
+	"ө", "о",
+	"ұ", "у",
+	"ү", "у",
+	"һ", "х",
+	"і", "и",
+)
+
+// Normalize lowercases s and folds letters, see folding
+func Normalize(s string) string {
+	return folding.Replace(strings.ToLower(s))
+}
+
+// Words splits s into runs of letters and digits, the way pg_trgm does
+func Words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Tokens are the normalized words of a query
+func Tokens(query string) []string {
+	return Words(Normalize(query))
+}
+
+// trigrams extracts the pg_trgm trigram set of s: every word is padded with two spaces in front
+// and one behind
+func trigrams(s string) map[string]struct{} {
+	result := map[string]struct{}{}
+
+	for _, word := range Words(Normalize(s)) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			result[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+
+	return result
+}
+
+// WordSimilarity approximates pg_trgm word_similarity: the share of trigrams of query found in doc
+func WordSimilarity(query string, doc string) float64 {
+	queryTrigrams := trigrams(query)
+	if len(queryTrigrams) == 0 {
+		return 0
+	}
+
+	docTrigrams := trigrams(doc)
+
+	common := 0
+	for trigram := range queryTrigrams {
+		if _, ok := docTrigrams[trigram]; ok {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(queryTrigrams))
+}
+
+// Matches tells if every token is a prefix of a word of doc, like a 'token':* & .. tsquery does
+func Matches(tokens []string, doc string) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+
+	words := Tokens(doc)
+
+	for _, token := range tokens {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Highlight wraps the words of text matched by query with start and end. Words starting with a query
+// token are matched, when there are none the words similar to a token are, so typos get highlighted too
+func Highlight(text string, query string, start string, end string) string {
+	tokens := Tokens(query)
+
+	matched := highlight(text, start, end, func(word string) bool {
+		for _, token := range tokens {
+			if strings.HasPrefix(word, token) {
+				return true
+			}
+		}
+		return false
+	})
+	if matched != text {
+		return matched
+	}
+
+	return highlight(text, start, end, func(word string) bool {
+		for _, token := range tokens {
+			if WordSimilarity(token, word) >= WordSimilarityThreshold {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// highlight keeps text as is except for the wrapped words, match gets normalized words
+func highlight(text string, start string, end string, match func(word string) bool) string {
+	var b strings.Builder
+
+	wordStart := -1
+	flush := func(i int) {
+		if wordStart < 0 {
+			return
+		}
+
+		word := text[wordStart:i]
+		if match(Normalize(word)) {
+			b.WriteString(start)
+			b.WriteString(word)
+			b.WriteString(end)
+		} else {
+			b.WriteString(word)
+		}
+		wordStart = -1
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if wordStart < 0 {
+				wordStart = i
+			}
+		} else {
+			flush(i)
+			b.WriteString(text[i : i+size])
+		}
+
+		i += size
+	}
+	flush(len(text))
+
+	return b.String()
+}
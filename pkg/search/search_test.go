@@ -0,0 +1,44 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "семен", Normalize("Семён"))
+	assert.Equal(t, "айгуль нурланкызы", Normalize("Айгүль Нұрланқызы"))
+	assert.Equal(t, "аагкноуухи", Normalize("ӘәҒқҢөҰүҺі"))
+	assert.Equal(t, "john o'brien", Normalize("John O'Brien"))
+}
+
+func TestTokens(t *testing.T) {
+	assert.Equal(t, []string{"жанна", "д", "арк"}, Tokens("  Жанна, д'Арк! "))
+	assert.Empty(t, Tokens("!?- "))
+}
+
+func TestMatches(t *testing.T) {
+	assert.True(t, Matches(Tokens("ай нур"), "Айгүль Нұрланқызы"), "prefixes of every word")
+	assert.True(t, Matches(Tokens("семен"), "Семён Петров"), "ё is folded")
+	assert.False(t, Matches(Tokens("ай иван"), "Айгүль Нұрланқызы"), "every token must match")
+	assert.False(t, Matches(Tokens("гуль"), "Айгүль"), "inner part of a word")
+	assert.False(t, Matches(nil, "Айгүль"))
+}
+
+func TestWordSimilarity(t *testing.T) {
+	// pg_trgm: select word_similarity('word', 'two words') = 0.8
+	assert.InDelta(t, 0.8, WordSimilarity("word", "two words"), 0.0001)
+	assert.Equal(t, 1.0, WordSimilarity("Нурсултан", "Нұрсұлтан Әбішұлы"))
+	assert.GreaterOrEqual(t, WordSimilarity("Нурсултн", "Нұрсұлтан Әбішұлы"), WordSimilarityThreshold, "a missing letter")
+	assert.Less(t, WordSimilarity("Петр", "Нұрсұлтан Әбішұлы"), WordSimilarityThreshold)
+	assert.Equal(t, 0.0, WordSimilarity("", "Нұрсұлтан"))
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<mark>Айгүль</mark> <mark>Нұрланқызы</mark>", Highlight("Айгүль Нұрланқызы", "айгуль нурлан", "<mark>", "</mark>"))
+	assert.Equal(t, "<mark>Семён</mark> Петров", Highlight("Семён Петров", "Семе", "<mark>", "</mark>"))
+	assert.Equal(t, "John <mark>O</mark>'Brien", Highlight("John O'Brien", "o", "<mark>", "</mark>"))
+	assert.Equal(t, "<mark>Нұрсұлтан</mark> Әбішұлы", Highlight("Нұрсұлтан Әбішұлы", "Нурсултн", "<mark>", "</mark>"), "typo")
+	assert.Equal(t, "Иван Петров", Highlight("Иван Петров", "Сидоров", "<mark>", "</mark>"))
+}
@@ -0,0 +1,60 @@
+// Package webhook signs webhook requests and verifies them on the receiving side.
+// The signature is HMAC-SHA256 of "<timestamp>.<body>" with the subscription secret,
+// the timestamp is unix seconds sent in TimestampHeader so replays of old requests can be rejected
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	IdHeader        = "X-Webhook-Id"    // id of the delivery, stable across retries
+	EventHeader     = "X-Webhook-Event" // event type such as user.created
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature" // sha256=<hex>
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrExpiredTimestamp = errors.New("webhook: timestamp outside of tolerance")
+)
+
+// Sign returns the SignatureHeader value of body sent at timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the header values of a received request, tolerance 0 accepts any timestamp
+func Verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sentAt := time.Unix(seconds, 0)
+
+	if tolerance > 0 {
+		age := time.Since(sentAt)
+		if age > tolerance || age < -tolerance {
+			return ErrExpiredTimestamp
+		}
+	}
+
+	if !strings.HasPrefix(signature, signaturePrefix) ||
+		!hmac.Equal([]byte(Sign(secret, sentAt, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"user.created"}`)
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	signature := Sign("secret", now, body)
+	assert.Regexp(t, `^sha256=[0-9a-f]{64}$`, signature)
+	assert.Equal(t, signature, Sign("secret", now, body), "signature must be deterministic")
+
+	assert.NoError(t, Verify("secret", timestamp, signature, body, time.Minute))
+	assert.ErrorIs(t, Verify("other", timestamp, signature, body, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", timestamp, signature, []byte(`{}`), time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "nope", signature, body, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", timestamp, signature[len("sha256="):], body, time.Minute), ErrInvalidSignature)
+
+	old := now.Add(-time.Hour)
+	oldSignature := Sign("secret", old, body)
+	oldTimestamp := strconv.FormatInt(old.Unix(), 10)
+	assert.ErrorIs(t, Verify("secret", oldTimestamp, oldSignature, body, time.Minute), ErrExpiredTimestamp)
+	assert.NoError(t, Verify("secret", oldTimestamp, oldSignature, body, 0), "zero tolerance accepts any timestamp")
+}
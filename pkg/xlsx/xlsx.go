@@ -0,0 +1,203 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// epoch is day 0 of the 1900 date system, it absorbs the 1900 leap year bug of spreadsheets
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// styleDateTime is the index of the date time format in cellXfs of styles.xml
+const styleDateTime = 1
+
+var parts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+		`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+// Writer streams a workbook with a single sheet, rows go straight into the compressed sheet entry,
+// so memory use doesn't depend on the number of rows
+type Writer struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	buf   bytes.Buffer // the row being encoded
+	row   int
+}
+
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	archive := zip.NewWriter(w)
+
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="` + escape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	for _, part := range parts {
+		err := writePart(archive, part.name, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := writePart(archive, "xl/workbook.xml", workbook)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := bufio.NewWriter(entry)
+
+	_, err = sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		zip:   archive,
+		sheet: sheet,
+	}, nil
+}
+
+// Write appends a row, supported values are strings, integers, floats, bools, time.Time
+// and nil for an empty cell, pointers to them are dereferenced.
+// A row with an unsupported value is not written at all
+func (w *Writer) Write(values ...interface{}) error {
+	row := w.row + 1
+
+	w.buf.Reset()
+	fmt.Fprintf(&w.buf, `<row r="%d">`, row)
+
+	for i, value := range values {
+		ref := column(i) + strconv.Itoa(row)
+
+		switch v := deref(value).(type) {
+		case nil:
+		case string:
+			fmt.Fprintf(&w.buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(v))
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(&w.buf, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			fmt.Fprintf(&w.buf, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float32, float64:
+			fmt.Fprintf(&w.buf, `<c r="%s"><v>%v</v></c>`, ref, v)
+		case time.Time:
+			days := float64(v.UTC().Sub(epoch)) / float64(24*time.Hour)
+			fmt.Fprintf(&w.buf, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDateTime, strconv.FormatFloat(days, 'f', -1, 64))
+		default:
+			return fmt.Errorf("xlsx: unsupported value %T", value)
+		}
+	}
+
+	w.buf.WriteString(`</row>`)
+
+	_, err := w.sheet.Write(w.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	w.row = row
+	return nil
+}
+
+// Close finishes the sheet and the archive, it doesn't close the underlying writer
+func (w *Writer) Close() error {
+	_, err := w.sheet.WriteString(`</sheetData></worksheet>`)
+	if err != nil {
+		return err
+	}
+
+	err = w.sheet.Flush()
+	if err != nil {
+		return err
+	}
+
+	return w.zip.Close()
+}
+
+func writePart(archive *zip.Writer, name string, content string) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(entry, content)
+	return err
+}
+
+func deref(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *string:
+		if v != nil {
+			return *v
+		}
+		return nil
+	case *time.Time:
+		if v != nil {
+			return *v
+		}
+		return nil
+	}
+	return value
+}
+
+// column converts a zero based index to a column name: A, B, .., Z, AA, AB, ..
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// escape also replaces characters xml can't hold with U+FFFD
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
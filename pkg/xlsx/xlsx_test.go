@@ -0,0 +1,69 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "users & co")
+	require.NoError(t, err)
+
+	surname := " <Smith> "
+	require.NoError(t, w.Write("id", "name", "surname", "inserted_at", "deleted_at"))
+	require.NoError(t, w.Write(uint(1), "John", &surname, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), (*time.Time)(nil)))
+	assert.Error(t, w.Write(struct{}{}), "unsupported value")
+	require.NoError(t, w.Close())
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[file.Name] = content
+
+		// every part must be well formed
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err, file.Name) {
+				break
+			}
+		}
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		assert.Contains(t, files, name)
+	}
+
+	assert.Contains(t, string(files["xl/workbook.xml"]), `name="users &amp; co"`)
+
+	sheet := string(files["xl/worksheets/sheet1.xml"])
+	assert.Contains(t, sheet, `<c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="A2"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="C2" t="inlineStr"><is><t xml:space="preserve"> &lt;Smith&gt; </t></is></c>`)
+	assert.Contains(t, sheet, `<c r="D2" s="1"><v>45292.5</v></c>`, "2024-01-01 12:00 is serial 45292.5")
+	assert.NotContains(t, sheet, `r="E2"`, "nil is an empty cell")
+}
+
+func TestColumn(t *testing.T) {
+	for i, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, expected, column(i))
+	}
+}
@@ -1 +1 @@
-go run cmd/gravitum-test-app/main.go
\ No newline at end of file
+go run ./cmd/gravitum-test-app
\ No newline at end of file